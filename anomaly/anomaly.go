@@ -0,0 +1,77 @@
+// Package anomaly decides whether spending looks unusual compared with its
+// history: a single expense far above what a payee or category usually costs,
+// or a category running at several times its usual monthly spend.
+package anomaly
+
+import "sort"
+
+// Thresholds of the checks.
+const (
+	// MinSamples is how many past expenses a baseline needs before a single
+	// expense can be called unusual.
+	MinSamples = 5
+	// Sigmas is how many standard deviations above the mean an unusual
+	// expense is.
+	Sigmas = 3
+	// MinFactor keeps expenses of payees that always cost nearly the same
+	// from being flagged for small differences: an unusual expense is also
+	// at least this many times the mean.
+	MinFactor = 1.5
+	// MinMonths is how many past months with spending a category needs
+	// before its monthly spend can be called unusual.
+	MinMonths = 3
+	// SpikeFactor is how many times its usual monthly spend a category must
+	// reach within a month to be flagged.
+	SpikeFactor = 3
+)
+
+// Baseline summarizes past expense amounts.
+type Baseline struct {
+	Count  int
+	Mean   float64
+	StdDev float64
+}
+
+// Unusual reports whether amount is far above the baseline.
+func (b Baseline) Unusual(amount float64) bool {
+	if b.Count < MinSamples || b.Mean <= 0 {
+		return false
+	}
+	return amount > b.Mean+Sigmas*b.StdDev && amount >= MinFactor*b.Mean
+}
+
+// Ratio is how many times the mean amount is.
+func (b Baseline) Ratio(amount float64) float64 {
+	if b.Mean <= 0 {
+		return 0
+	}
+	return amount / b.Mean
+}
+
+// Spike reports whether a month's spend so far is unusually high compared
+// with the past months' totals. The usual monthly spend is the median over
+// months with spending, so one earlier spike doesn't raise the bar for good.
+func Spike(monthToDate float64, pastMonths []float64) (usual float64, spike bool) {
+	var spent []float64
+	for _, m := range pastMonths {
+		if m > 0 {
+			spent = append(spent, m)
+		}
+	}
+	if len(spent) < MinMonths {
+		return 0, false
+	}
+	usual = median(spent)
+	return usual, monthToDate >= SpikeFactor*usual
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,37 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var ErrUnsupportedType = errors.New("attachments: unsupported file type")
+
+// AllowedTypes are the content types that can be attached, as detected from
+// the file content. The type a browser claims for an upload is ignored.
+var AllowedTypes = map[string]bool{
+	"image/jpeg":                true,
+	"image/png":                 true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+// Sniff detects the content type of r from its first bytes and returns it
+// with a reader that still yields the whole content.
+func Sniff(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !AllowedTypes[contentType] {
+		return contentType, nil, ErrUnsupportedType
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
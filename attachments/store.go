@@ -0,0 +1,136 @@
+// Package attachments stores receipts and other files attached to
+// transactions in a local directory. Files are content-addressed: each is
+// saved under the SHA-256 of its content, so uploading the same receipt twice
+// stores it once.
+package attachments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrNotFound = errors.New("attachments: file not found")
+
+// Store keeps files in Dir, in subdirectories named after the first two
+// characters of their hash, and thumbnails of images under Dir/thumbs.
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, thumbDir), 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{Dir: dir}, nil
+}
+
+const thumbDir = "thumbs"
+
+// validHash reports whether s looks like a hex SHA-256, so that a hash read
+// from anywhere can never point outside the store.
+func validHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.Dir, hash[:2], hash)
+}
+
+func (s *Store) thumbPath(hash string) string {
+	return filepath.Join(s.Dir, thumbDir, hash+".jpg")
+}
+
+// Put saves the content of r and returns its hash and size. The content is
+// written to a temporary file first and only moved into place once complete.
+func (s *Store) Put(r io.Reader) (hash string, size int64, err error) {
+	tmp, err := os.CreateTemp(s.Dir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	hash = hex.EncodeToString(h.Sum(nil))
+	if _, err := os.Stat(s.path(hash)); err == nil {
+		// Already stored. Touch it so that cleanup treats it as a new upload.
+		now := time.Now()
+		return hash, size, os.Chtimes(s.path(hash), now, now)
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path(hash)), 0o750); err != nil {
+		return "", 0, err
+	}
+	if err = os.Rename(tmp.Name(), s.path(hash)); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+// Open returns the stored file with the hash, or its thumbnail.
+func (s *Store) Open(hash string, thumbnail bool) (*os.File, error) {
+	if !validHash(hash) {
+		return nil, ErrNotFound
+	}
+	p := s.path(hash)
+	if thumbnail {
+		p = s.thumbPath(hash)
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// RemoveUnreferenced deletes stored files and thumbnails whose hash is not in
+// keep. Files younger than minAge are left alone, since an upload in progress
+// stores its file before the attachment referencing it is saved. It returns
+// the number of files removed.
+func (s *Store) RemoveUnreferenced(keep map[string]bool, minAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-minAge)
+	var removed int
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		hash := name
+		if filepath.Base(filepath.Dir(p)) == thumbDir {
+			hash = name[:len(name)-len(filepath.Ext(name))]
+		}
+		if !validHash(hash) || keep[hash] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,99 @@
+package attachments
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+
+	// Decoders for the image types thumbnails are made of.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ThumbnailSize is the longest side of a thumbnail, in pixels.
+const ThumbnailSize = 240
+
+// ThumbnailTypes are the content types a thumbnail can be made of.
+var ThumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// MakeThumbnail stores a scaled-down JPEG of the image with the hash. Images
+// already smaller than ThumbnailSize keep their size.
+func (s *Store) MakeThumbnail(hash string) error {
+	f, err := s.Open(hash, false)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(s.Dir, "thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	if err := jpeg.Encode(out, scale(src, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), s.thumbPath(hash))
+}
+
+// scale shrinks img so that its longest side is at most max, averaging the
+// source pixels that fall into each thumbnail pixel. Transparent areas come
+// out white.
+func scale(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+	tw, th := w, h
+	if w > max || h > max {
+		if w >= h {
+			tw, th = max, h*max/w
+		} else {
+			tw, th = w*max/h, max
+		}
+	}
+	tw, th = maxInt(tw, 1), maxInt(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+maxInt((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+maxInt((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					// Blend onto white.
+					white := 0xffff - uint64(ca)
+					r += uint64(cr) + white
+					g += uint64(cg) + white
+					bl += uint64(cb) + white
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: 0xffff})
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
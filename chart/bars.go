@@ -0,0 +1,74 @@
+package chart
+
+import (
+	"html"
+	"html/template"
+	"math"
+)
+
+// Series names and colors one value of every bar group or one line.
+type Series struct {
+	Name  string
+	Color string
+}
+
+// BarGroup is one position on the x axis, such as a month, with one value
+// per series.
+type BarGroup struct {
+	Label  string
+	Values []float64
+}
+
+// Bars renders grouped bars, one group per label with a bar per series side
+// by side, and a legend above the plot.
+func Bars(title string, series []Series, groups []BarGroup, width, height int) template.HTML {
+	if len(groups) == 0 || len(series) == 0 {
+		return empty(width, height, title)
+	}
+
+	var values []float64
+	for _, g := range groups {
+		values = append(values, g.Values...)
+	}
+	left, right := float64(axisWidth), float64(width)-8
+	top, bottom := float64(legendRow+8), float64(height-labelHeight)
+	if right <= left || bottom <= top {
+		return empty(width, height, title)
+	}
+	s := newSVG(width, height, title)
+	sc := newScale(values, top, bottom)
+	s.axis(sc, left, right)
+
+	slot := (right - left) / float64(len(groups))
+	barWidth := slot * 0.8 / float64(len(series))
+	// Label every group when they fit, otherwise every few groups.
+	every := max(int(math.Ceil(float64(len(groups))*40/(right-left))), 1)
+
+	colors := make([]string, len(series))
+	for i, se := range series {
+		colors[i] = colorAt(se.Color, i)
+	}
+	for gi, g := range groups {
+		x := left + float64(gi)*slot + slot*0.1
+		for si := range series {
+			if si >= len(g.Values) {
+				break
+			}
+			v := g.Values[si]
+			y0, y1 := sc.y(0), sc.y(v)
+			s.add(`<rect x="%s" y="%s" width="%s" height="%s" fill="%s"><title>%s: %s</title></rect>`,
+				num(x+float64(si)*barWidth), num(math.Min(y0, y1)), num(barWidth), num(math.Abs(y0-y1)), colors[si],
+				html.EscapeString(g.Label+" "+series[si].Name), Amount(v))
+		}
+		if gi%every == 0 {
+			s.text(left+float64(gi)*slot+slot/2, float64(height)-4, "middle", g.Label)
+		}
+	}
+
+	names := make([]string, len(series))
+	for i, se := range series {
+		names[i] = se.Name
+	}
+	s.seriesLegend(left, float64(width), names, colors)
+	return s.html()
+}
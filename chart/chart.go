@@ -0,0 +1,160 @@
+// Package chart renders small charts as inline SVG, so pages can show them
+// without any JavaScript. The output only depends on the input, which keeps
+// it stable between renders.
+package chart
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// Palette is used for slices and series that don't set a color.
+var Palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// Standard colors for income, expense and totals, matching the page styles.
+const (
+	IncomeColor  = "#28a745"
+	ExpenseColor = "#dc3545"
+	TotalColor   = "#333333"
+)
+
+const (
+	fontSize    = 12
+	legendRow   = 18
+	axisWidth   = 56
+	labelHeight = 20
+)
+
+func colorAt(color string, i int) string {
+	if color != "" {
+		return color
+	}
+	return Palette[i%len(Palette)]
+}
+
+// num formats a coordinate with at most two decimals.
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// Amount formats a value for axis labels, abbreviating thousands and millions.
+func Amount(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e6:
+		return num(math.Round(v/1e4)/100) + "M"
+	case abs >= 1e4:
+		return num(math.Round(v/100)/10) + "k"
+	}
+	return num(math.Round(v*100) / 100)
+}
+
+// svg accumulates the markup of one chart.
+type svg struct {
+	sb strings.Builder
+}
+
+func newSVG(width, height int, label string) *svg {
+	s := &svg{}
+	fmt.Fprintf(&s.sb, `<svg xmlns="http://www.w3.org/2000/svg" class="chart" viewBox="0 0 %d %d" width="100%%" role="img" aria-label="%s">`,
+		width, height, html.EscapeString(label))
+	s.sb.WriteString("\n")
+	return s
+}
+
+func (s *svg) add(format string, args ...any) {
+	fmt.Fprintf(&s.sb, format, args...)
+	s.sb.WriteString("\n")
+}
+
+func (s *svg) text(x, y float64, anchor, content string) {
+	s.add(`<text x="%s" y="%s" font-size="%d" text-anchor="%s" fill="#555">%s</text>`,
+		num(x), num(y), fontSize, anchor, html.EscapeString(content))
+}
+
+// legend draws one colored square and label per entry, one per row, starting
+// at x, y.
+func (s *svg) legend(x, y float64, labels, colors []string) {
+	for i, label := range labels {
+		row := y + float64(i*legendRow)
+		s.add(`<rect x="%s" y="%s" width="10" height="10" fill="%s"/>`, num(x), num(row), colors[i])
+		s.text(x+16, row+10, "start", label)
+	}
+}
+
+// seriesLegend draws the legend of a bar or line chart in one row above the
+// plot, starting at x. Entries that would start past width are left out.
+func (s *svg) seriesLegend(x, width float64, labels, colors []string) {
+	for i, label := range labels {
+		col := x + float64(i*120)
+		if col+16 >= width {
+			return
+		}
+		s.add(`<rect x="%s" y="4" width="10" height="10" fill="%s"/>`, num(col), colors[i])
+		s.text(col+16, 14, "start", label)
+	}
+}
+
+func (s *svg) html() template.HTML {
+	s.sb.WriteString("</svg>")
+	return template.HTML(s.sb.String())
+}
+
+// empty is rendered when there is nothing to draw.
+func empty(width, height int, label string) template.HTML {
+	s := newSVG(width, height, label)
+	s.text(float64(width)/2, float64(height)/2, "middle", "No data")
+	return s.html()
+}
+
+// scale maps values in [lo, hi] onto [top, bottom] of the plot area, with hi
+// at the top.
+type scale struct {
+	lo, hi      float64
+	top, bottom float64
+}
+
+func newScale(values []float64, top, bottom float64) scale {
+	lo, hi := 0.0, 0.0
+	for _, v := range values {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	return scale{lo: lo, hi: hi, top: top, bottom: bottom}
+}
+
+func (sc scale) y(v float64) float64 {
+	return sc.bottom - (v-sc.lo)/(sc.hi-sc.lo)*(sc.bottom-sc.top)
+}
+
+// axis draws horizontal grid lines with labels at the bottom, zero (if in
+// range) and top of the scale.
+func (s *svg) axis(sc scale, left, right float64) {
+	ticks := []float64{sc.lo, sc.hi}
+	if sc.lo < 0 && sc.hi > 0 {
+		ticks = []float64{sc.lo, 0, sc.hi}
+	}
+	for _, t := range ticks {
+		y := sc.y(t)
+		dash := ` stroke-dasharray="4 4"`
+		if t == 0 {
+			dash = ""
+		}
+		s.add(`<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="#ccc"%s/>`, num(left), num(y), num(right), num(y), dash)
+		s.text(left-6, y+4, "end", Amount(t))
+	}
+}
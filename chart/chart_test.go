@@ -0,0 +1,163 @@
+package chart
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name.svg, or rewrites the file with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".svg")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./chart -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+var (
+	viewBoxAttr = regexp.MustCompile(`viewBox="0 0 ([\d.]+) ([\d.]+)"`)
+	elementTag  = regexp.MustCompile(`<(rect|line|circle|text|polyline)\b[^>]*>`)
+	coordAttr   = regexp.MustCompile(`\b(x|x1|x2|cx|y|y1|y2|cy|width|height|points)="([^"]*)"`)
+)
+
+// inside checks that every coordinate of the rects, lines, circles, texts and
+// polylines of svg lies within its viewBox.
+func inside(t *testing.T, svg string) {
+	t.Helper()
+	m := viewBoxAttr.FindStringSubmatch(svg)
+	if m == nil {
+		t.Fatalf("no viewBox in %s", svg)
+	}
+	width, _ := strconv.ParseFloat(m[1], 64)
+	height, _ := strconv.ParseFloat(m[2], 64)
+	check := func(el, axis string, v float64) {
+		limit := width
+		if axis == "y" {
+			limit = height
+		}
+		if v < 0 || v > limit {
+			t.Errorf("%s is outside the %gx%g viewBox: %s = %g", el, width, height, axis, v)
+		}
+	}
+
+	for _, el := range elementTag.FindAllString(svg, -1) {
+		attrs := make(map[string]float64)
+		for _, a := range coordAttr.FindAllStringSubmatch(el, -1) {
+			if a[1] == "points" {
+				for _, p := range strings.Fields(a[2]) {
+					xs, ys, _ := strings.Cut(p, ",")
+					x, _ := strconv.ParseFloat(xs, 64)
+					y, _ := strconv.ParseFloat(ys, 64)
+					check(el, "x", x)
+					check(el, "y", y)
+				}
+				continue
+			}
+			v, err := strconv.ParseFloat(a[2], 64)
+			if err != nil {
+				t.Errorf("%s: bad %s", el, a[1])
+				continue
+			}
+			attrs[a[1]] = v
+			switch a[1] {
+			case "x", "x1", "x2", "cx":
+				check(el, "x", v)
+			case "y", "y1", "y2", "cy":
+				check(el, "y", v)
+			case "width", "height":
+				if v < 0 {
+					t.Errorf("%s has a negative %s", el, a[1])
+				}
+			}
+		}
+		if strings.HasPrefix(el, "<rect") {
+			check(el, "x", attrs["x"]+attrs["width"])
+			check(el, "y", attrs["y"]+attrs["height"])
+		}
+	}
+}
+
+func TestDonut(t *testing.T) {
+	slices := []Slice{
+		{Label: "Groceries", Value: 420.5},
+		{Label: "Rent & utilities", Value: 1200},
+		{Label: "Coffee", Value: 38.25, Color: "#6f4e37"},
+		{Label: "Refunds", Value: -15},
+	}
+	golden(t, "donut", string(Donut("Expenses by category", slices, 480, 200)))
+	golden(t, "donut_single", string(Donut("One category", slices[:1], 480, 200)))
+}
+
+func TestBars(t *testing.T) {
+	series := []Series{{Name: "Income", Color: IncomeColor}, {Name: "Expense", Color: ExpenseColor}}
+	groups := []BarGroup{
+		{Label: "Jan", Values: []float64{3200, 2100.4}},
+		{Label: "Feb", Values: []float64{3200, 3500}},
+		{Label: "Mar", Values: []float64{-150, 1800}},
+	}
+	got := string(Bars("Income and expense", series, groups, 480, 220))
+	golden(t, "bars", got)
+	inside(t, got)
+}
+
+func TestLines(t *testing.T) {
+	lines := []Line{
+		{Series: Series{Name: "Checking", Color: TotalColor}, Values: []float64{1200, 950.5, 1800, 40000}},
+		{Series: Series{Name: "Minimum"}, Values: []float64{0, 0, 0, 0}, Width: 1},
+	}
+	got := string(Lines("Balance", lines, "Jan 1", "Jan 4", 480, 220))
+	golden(t, "lines", got)
+	inside(t, got)
+}
+
+func TestEmpty(t *testing.T) {
+	golden(t, "empty", string(Bars("Nothing", nil, nil, 480, 220)))
+}
+
+// Plots with no room left between the axes render as empty charts instead of
+// panicking or drawing outside the view box.
+func TestTooSmall(t *testing.T) {
+	series := []Series{{Name: "Expense"}}
+	groups := []BarGroup{{Label: "Jan", Values: []float64{10}}, {Label: "Feb", Values: []float64{20}}}
+	lines := []Line{{Series: Series{Name: "Balance"}, Values: []float64{1, 2}}}
+	for _, size := range [][2]int{{0, 200}, {40, 200}, {axisWidth + 8, 200}, {480, 30}} {
+		want := string(empty(size[0], size[1], "Tiny"))
+		if got := string(Bars("Tiny", series, groups, size[0], size[1])); got != want {
+			t.Errorf("Bars at %dx%d = %s, want the empty chart", size[0], size[1], got)
+		}
+		if got := string(Lines("Tiny", lines, "a", "b", size[0], size[1])); got != want {
+			t.Errorf("Lines at %dx%d = %s, want the empty chart", size[0], size[1], got)
+		}
+	}
+}
+
+// A plot just wide enough to draw, with far more groups than labels fit.
+func TestBarsNarrow(t *testing.T) {
+	groups := make([]BarGroup, 50)
+	for i := range groups {
+		groups[i] = BarGroup{Label: "x", Values: []float64{float64(i)}}
+	}
+	got := string(Bars("Narrow", []Series{{Name: "Expense"}}, groups, axisWidth+10, 100))
+	golden(t, "bars_narrow", got)
+	inside(t, got)
+	if n := strings.Count(got, ">x</text>"); n < 1 || n > 10 {
+		t.Errorf("%d of the 50 group labels are drawn, want a few", n)
+	}
+}
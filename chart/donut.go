@@ -0,0 +1,74 @@
+package chart
+
+import (
+	"html"
+	"html/template"
+	"math"
+)
+
+// Slice is one part of a donut chart.
+type Slice struct {
+	Label string
+	Value float64
+	Color string
+}
+
+// Donut renders slices as a donut chart with a legend to its right, and the
+// total in the middle. Slices with no positive value are left out.
+func Donut(title string, slices []Slice, width, height int) template.HTML {
+	var total float64
+	var shown []Slice
+	for _, sl := range slices {
+		if sl.Value > 0 {
+			total += sl.Value
+			shown = append(shown, sl)
+		}
+	}
+	if total == 0 {
+		return empty(width, height, title)
+	}
+
+	s := newSVG(width, height, title)
+	size := math.Min(float64(width)/2, float64(height))
+	cx, cy := size/2, float64(height)/2
+	outer := size/2 - 4
+	inner := outer * 0.6
+
+	labels := make([]string, len(shown))
+	colors := make([]string, len(shown))
+	angle := 0.0
+	for i, sl := range shown {
+		colors[i] = colorAt(sl.Color, i)
+		labels[i] = sl.Label + " (" + num(math.Round(sl.Value/total*1000)/10) + "%)"
+		if len(shown) == 1 {
+			// A full circle can't be drawn as a single arc.
+			s.add(`<circle cx="%s" cy="%s" r="%s" fill="none" stroke="%s" stroke-width="%s"><title>%s</title></circle>`,
+				num(cx), num(cy), num((outer+inner)/2), colors[i], num(outer-inner), html.EscapeString(labels[i]))
+			break
+		}
+		sweep := sl.Value / total * 2 * math.Pi
+		s.add(`<path d="%s" fill="%s"><title>%s</title></path>`,
+			donutSegment(cx, cy, outer, inner, angle, angle+sweep), colors[i], html.EscapeString(labels[i]))
+		angle += sweep
+	}
+	s.text(cx, cy+4, "middle", Amount(total))
+	s.legend(size+16, math.Max(4, cy-float64(len(shown)*legendRow)/2), labels, colors)
+	return s.html()
+}
+
+// donutSegment returns the path of a ring segment between two angles,
+// measured clockwise from twelve o'clock.
+func donutSegment(cx, cy, outer, inner, from, to float64) string {
+	point := func(r, a float64) string {
+		return num(cx+r*math.Sin(a)) + " " + num(cy-r*math.Cos(a))
+	}
+	large := "0"
+	if to-from > math.Pi {
+		large = "1"
+	}
+	return "M " + point(outer, from) +
+		" A " + num(outer) + " " + num(outer) + " 0 " + large + " 1 " + point(outer, to) +
+		" L " + point(inner, to) +
+		" A " + num(inner) + " " + num(inner) + " 0 " + large + " 0 " + point(inner, from) +
+		" Z"
+}
@@ -0,0 +1,62 @@
+package chart
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// Line is one series of a line chart. Values are evenly spaced on the x axis.
+type Line struct {
+	Series
+	Values []float64
+	// Width is the stroke width, 2 when zero.
+	Width float64
+}
+
+// Lines renders one or more series on a shared scale, with the first and last
+// x label under the plot and a legend above it.
+func Lines(title string, lines []Line, firstLabel, lastLabel string, width, height int) template.HTML {
+	points := 0
+	var values []float64
+	for _, l := range lines {
+		points = max(points, len(l.Values))
+		values = append(values, l.Values...)
+	}
+	if points < 2 {
+		return empty(width, height, title)
+	}
+
+	left, right := float64(axisWidth), float64(width)-8
+	top, bottom := float64(legendRow+8), float64(height-labelHeight)
+	if right <= left || bottom <= top {
+		return empty(width, height, title)
+	}
+	s := newSVG(width, height, title)
+	sc := newScale(values, top, bottom)
+	s.axis(sc, left, right)
+
+	step := (right - left) / float64(points-1)
+	for i, l := range lines {
+		coords := make([]string, len(l.Values))
+		for j, v := range l.Values {
+			coords[j] = num(left+float64(j)*step) + "," + num(sc.y(v))
+		}
+		strokeWidth := l.Width
+		if strokeWidth == 0 {
+			strokeWidth = 2
+		}
+		s.add(`<polyline points="%s" fill="none" stroke="%s" stroke-width="%s"><title>%s</title></polyline>`,
+			strings.Join(coords, " "), colorAt(l.Color, i), num(strokeWidth), html.EscapeString(l.Name))
+	}
+
+	s.text(left, float64(height)-4, "start", firstLabel)
+	s.text(right, float64(height)-4, "end", lastLabel)
+	names := make([]string, len(lines))
+	colors := make([]string, len(lines))
+	for i, l := range lines {
+		names[i], colors[i] = l.Name, colorAt(l.Color, i)
+	}
+	s.seriesLegend(left, float64(width), names, colors)
+	return s.html()
+}
@@ -0,0 +1,194 @@
+// Package classify suggests categories for new transactions with a naive
+// Bayes classifier trained on transactions that already have one.
+package classify
+
+import (
+	"finance-tracker/model"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Sample is a categorized transaction the classifier learns from.
+type Sample struct {
+	Name         string
+	Amount       float64
+	CategoryType string
+	Category     string
+}
+
+// Features turns a transaction into the words the classifier counts: the
+// lower-cased words of its name without bare numbers such as card or
+// reference numbers, its type, and a bucket for the size of the amount.
+func Features(name string, amount float64, categoryType string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var features []string
+	for _, w := range words {
+		if len(w) < 2 || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		features = append(features, w)
+	}
+	if categoryType != "" {
+		features = append(features, "type:"+strings.ToLower(categoryType))
+	}
+	return append(features, amountBucket(amount))
+}
+
+// amountBucket splits amounts into three buckets per power of ten, so 4 and 40
+// fall in different buckets but 40 and 45 in the same one.
+func amountBucket(amount float64) string {
+	if amount < 1 {
+		return "amount:<1"
+	}
+	return "amount:" + strconv.Itoa(int(math.Floor(math.Log10(amount)*3)))
+}
+
+// Model is a multinomial naive Bayes classifier. It is safe for concurrent
+// use and can be trained one sample at a time.
+type Model struct {
+	mu sync.RWMutex
+	// samples counts training samples per category, counts the occurrences of
+	// each feature per category and totals all features per category.
+	samples map[string]int
+	counts  map[string]map[string]int
+	totals  map[string]int
+	vocab   map[string]bool
+	n       int
+}
+
+func New() *Model {
+	return &Model{
+		samples: make(map[string]int),
+		counts:  make(map[string]map[string]int),
+		totals:  make(map[string]int),
+		vocab:   make(map[string]bool),
+	}
+}
+
+// Add trains the model on one more sample. Samples without a category are
+// ignored.
+func (m *Model) Add(s Sample) {
+	category := strings.TrimSpace(s.Category)
+	if category == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counts[category] == nil {
+		m.counts[category] = make(map[string]int)
+	}
+	for _, f := range Features(s.Name, s.Amount, s.CategoryType) {
+		m.counts[category][f]++
+		m.totals[category]++
+		m.vocab[f] = true
+	}
+	m.samples[category]++
+	m.n++
+}
+
+// Replace discards what the model learned and trains it on samples instead.
+func (m *Model) Replace(samples []Sample) {
+	fresh := New()
+	for _, s := range samples {
+		fresh.Add(s)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples, m.counts, m.totals, m.vocab, m.n = fresh.samples, fresh.counts, fresh.totals, fresh.vocab, fresh.n
+}
+
+// Len returns the number of samples the model was trained on.
+func (m *Model) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.n
+}
+
+// Suggest returns up to limit categories for the transaction, most likely
+// first. Confidence is the posterior probability of the category, so the
+// confidences of all categories add up to 1.
+func (m *Model) Suggest(name string, amount float64, categoryType string, limit int) []model.CategorySuggestion {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.n == 0 {
+		return nil
+	}
+
+	features := Features(name, amount, categoryType)
+	vocab := float64(len(m.vocab))
+	scores := make(map[string]float64, len(m.samples))
+	best := math.Inf(-1)
+	for category, n := range m.samples {
+		// Laplace smoothing keeps a feature never seen with a category from
+		// ruling it out entirely.
+		score := math.Log(float64(n) / float64(m.n))
+		total := float64(m.totals[category])
+		for _, f := range features {
+			score += math.Log((float64(m.counts[category][f]) + 1) / (total + vocab))
+		}
+		scores[category] = score
+		best = math.Max(best, score)
+	}
+
+	// Normalize the log scores into probabilities, subtracting the best score
+	// first so that exp doesn't underflow.
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - best)
+	}
+	suggestions := make([]model.CategorySuggestion, 0, len(scores))
+	for category, score := range scores {
+		suggestions = append(suggestions, model.CategorySuggestion{
+			Category:   category,
+			Confidence: math.Round(math.Exp(score-best)/sum*1000) / 1000,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Category < suggestions[j].Category
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// Evaluate measures how well the classifier does on transactions it hasn't
+// seen: every k-th sample is held out, a model is trained on the rest, and the
+// share of held-out samples whose top suggestion is their actual category is
+// returned together with the number held out.
+func Evaluate(samples []Sample, k int) (accuracy float64, heldOut int) {
+	if k < 2 {
+		return 0, 0
+	}
+	m := New()
+	var holdout []Sample
+	for i, s := range samples {
+		if i%k == k-1 {
+			holdout = append(holdout, s)
+		} else {
+			m.Add(s)
+		}
+	}
+
+	var correct int
+	for _, s := range holdout {
+		top := m.Suggest(s.Name, s.Amount, s.CategoryType, 1)
+		if len(top) == 1 && strings.EqualFold(top[0].Category, strings.TrimSpace(s.Category)) {
+			correct++
+		}
+	}
+	if len(holdout) == 0 {
+		return 0, 0
+	}
+	return float64(correct) / float64(len(holdout)), len(holdout)
+}
@@ -0,0 +1,121 @@
+package classify
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// labelled is a fixed set of categorized transactions, in the order they would
+// come out of the database.
+var labelled = []Sample{
+	{"TESCO STORES 2231", 54.20, "EXPENSE", "Groceries"},
+	{"Starbucks Coffee #4410", 4.85, "EXPENSE", "Coffee"},
+	{"Shell Oil 5521", 61.00, "EXPENSE", "Fuel"},
+	{"Netflix.com", 15.99, "EXPENSE", "Subscriptions"},
+	{"ACME Corp payroll", 3200, "INCOME", "Salary"},
+	{"Tesco Express", 12.40, "EXPENSE", "Groceries"},
+	{"Blue Bottle Coffee", 5.50, "EXPENSE", "Coffee"},
+	{"SHELL 0042 fuel", 58.30, "EXPENSE", "Fuel"},
+	{"Spotify premium", 9.99, "EXPENSE", "Subscriptions"},
+	{"ACME CORP salary", 3200, "INCOME", "Salary"},
+	{"Lidl market 17", 38.75, "EXPENSE", "Groceries"},
+	{"Starbucks 0913", 3.95, "EXPENSE", "Coffee"},
+	{"BP fuel station", 47.10, "EXPENSE", "Fuel"},
+	{"Netflix subscription", 15.99, "EXPENSE", "Subscriptions"},
+	{"Payroll ACME", 3250, "INCOME", "Salary"},
+	{"Tesco superstore", 83.60, "EXPENSE", "Groceries"},
+	{"Costa Coffee 88", 4.20, "EXPENSE", "Coffee"},
+	{"Shell fuel 7731", 64.90, "EXPENSE", "Fuel"},
+	{"Spotify", 9.99, "EXPENSE", "Subscriptions"},
+	{"ACME payroll March", 3200, "INCOME", "Salary"},
+	{"LIDL 2291", 41.15, "EXPENSE", "Groceries"},
+	{"Starbucks Coffee", 5.10, "EXPENSE", "Coffee"},
+	{"BP 1180", 52.00, "EXPENSE", "Fuel"},
+	{"Netflix", 17.99, "EXPENSE", "Subscriptions"},
+	{"ACME Corp payroll April", 3300, "INCOME", "Salary"},
+	{"Tesco Stores 118", 29.90, "EXPENSE", "Groceries"},
+	{"Blue Bottle 12", 6.00, "EXPENSE", "Coffee"},
+	{"Shell 9001", 55.55, "EXPENSE", "Fuel"},
+	{"Spotify family", 16.99, "EXPENSE", "Subscriptions"},
+	{"ACME salary May", 3200, "INCOME", "Salary"},
+}
+
+// minAccuracy is the share of held-out samples the classifier must get right.
+const minAccuracy = 0.8
+
+func TestEvaluate(t *testing.T) {
+	// The fixture cycles through five categories, so k must not be a multiple
+	// of five or every held-out sample would share a category.
+	for _, k := range []int{3, 7} {
+		accuracy, heldOut := Evaluate(labelled, k)
+		if heldOut != len(labelled)/k {
+			t.Errorf("k=%d: held out %d samples, want %d", k, heldOut, len(labelled)/k)
+		}
+		if accuracy < minAccuracy {
+			t.Errorf("k=%d: accuracy on %d held-out samples = %.2f, want at least %.2f", k, heldOut, accuracy, minAccuracy)
+		}
+	}
+	if accuracy, heldOut := Evaluate(labelled, 1); accuracy != 0 || heldOut != 0 {
+		t.Errorf("Evaluate with k=1 = %v, %d, want 0, 0", accuracy, heldOut)
+	}
+	if accuracy, heldOut := Evaluate(labelled[:1], 2); accuracy != 0 || heldOut != 0 {
+		t.Errorf("Evaluate with nothing held out = %v, %d, want 0, 0", accuracy, heldOut)
+	}
+}
+
+func TestEmptyModel(t *testing.T) {
+	m := New()
+	if got := m.Suggest("Tesco", 20, "EXPENSE", 3); got != nil {
+		t.Errorf("Suggest on an empty model = %v, want nil", got)
+	}
+
+	m.Add(Sample{Name: "Tesco", Amount: 20, CategoryType: "EXPENSE", Category: "  "})
+	if m.Len() != 0 {
+		t.Errorf("Len after adding an uncategorized sample = %d, want 0", m.Len())
+	}
+
+	m.Add(labelled[0])
+	m.Replace(nil)
+	if m.Len() != 0 || m.Suggest("Tesco", 20, "EXPENSE", 3) != nil {
+		t.Errorf("model still suggests after Replace(nil)")
+	}
+}
+
+func TestUnseenTokens(t *testing.T) {
+	m := New()
+	m.Replace(labelled)
+
+	// Words the model has never seen leave every category in play, with
+	// probabilities that still add up to 1.
+	got := m.Suggest("zzyzx qwerty", 20, "EXPENSE", 0)
+	if len(got) != 5 {
+		t.Fatalf("got %d suggestions, want one per category: %v", len(got), got)
+	}
+	var sum float64
+	for _, s := range got {
+		if math.IsNaN(s.Confidence) || s.Confidence <= 0 || s.Confidence >= 1 {
+			t.Errorf("%s has confidence %v, want it strictly between 0 and 1", s.Category, s.Confidence)
+		}
+		sum += s.Confidence
+	}
+	if math.Abs(sum-1) > 0.01 {
+		t.Errorf("confidences add up to %v, want 1", sum)
+	}
+
+	// An unseen word next to known ones doesn't change the answer.
+	for _, name := range []string{"Starbucks", "Starbucks zzyzx"} {
+		top := m.Suggest(name, 4.5, "EXPENSE", 1)
+		if len(top) != 1 || top[0].Category != "Coffee" {
+			t.Errorf("Suggest(%q) = %v, want Coffee", name, top)
+		}
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	got := strings.Join(Features("SQ *Blue Bottle #0423 a", 4.5, "EXPENSE"), " ")
+	want := "sq blue bottle type:expense amount:1"
+	if got != want {
+		t.Errorf("Features = %q, want %q", got, want)
+	}
+}
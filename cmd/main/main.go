@@ -2,14 +2,35 @@ package main
 
 import (
 	"context"
+	"finance-tracker/attachments"
 	"finance-tracker/database"
+	"finance-tracker/events"
 	"finance-tracker/handler"
+	"finance-tracker/jobs"
+	"finance-tracker/model"
+	"finance-tracker/notify"
+	"finance-tracker/repository"
 	"fmt"
 	"log"
 	"net/http"
 	"html/template"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// envInt reads an integer setting from the environment, falling back to def
+// when it is unset or invalid.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
 func main() {
 	//establish db connection
 	db, err := database.GetConn()
@@ -22,11 +43,89 @@ func main() {
 		log.Println("Database connection closes.")
 	}()
 
+	retentionDays := envInt("TRASH_RETENTION_DAYS", 30)
+	jobs.Every("purge-trash", 24*time.Hour, func(db *pgx.Conn) error {
+		transactions, sources, err := repository.PurgeTrash(db, time.Duration(retentionDays)*24*time.Hour)
+		if err == nil && transactions+sources > 0 {
+			log.Printf("Purged %d transactions and %d sources from the trash", transactions, sources)
+		}
+		return err
+	})
+
+	snapshotDays := envInt("SNAPSHOT_DAYS", 365)
+	jobs.Every("balance-snapshots", 24*time.Hour, func(db *pgx.Conn) error {
+		_, err := repository.RefreshBalanceSnapshots(db, time.Now().AddDate(0, 0, -snapshotDays))
+		return err
+	})
+
+	jobs.Every("category-model", 24*time.Hour, func(db *pgx.Conn) error {
+		n, err := repository.TrainCategoryModel(db)
+		if err == nil {
+			log.Printf("Category suggestions trained on %d transactions", n)
+		}
+		return err
+	})
+
+	attachmentDir := os.Getenv("ATTACHMENT_DIR")
+	if attachmentDir == "" {
+		attachmentDir = "data/attachments"
+	}
+	store, err := attachments.NewStore(attachmentDir)
+	if err != nil {
+		log.Fatalf("Cant open the attachment directory: %v\n", err)
+	}
+	maxAttachmentMB := envInt("ATTACHMENT_MAX_MB", 10)
+	jobs.Every("attachment-cleanup", 24*time.Hour, func(db *pgx.Conn) error {
+		hashes, err := repository.GetAttachmentHashes(db)
+		if err != nil {
+			return err
+		}
+		removed, err := store.RemoveUnreferenced(hashes, time.Hour)
+		if err == nil && removed > 0 {
+			log.Printf("Removed %d unreferenced attachment files", removed)
+		}
+		return err
+	})
+
+	// Queue notifications for the events recipients can subscribe to.
+	events.Subscribe(model.EventAlert, repository.NotifyAlert)
+	events.Subscribe(model.EventLowBalance, repository.NotifyLowBalance)
+	dispatcher := notify.NewDispatcher()
+	dispatcher.Register(model.ChannelWebhook, notify.NewWebhook())
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpFrom := os.Getenv("SMTP_FROM")
+		if smtpFrom == "" {
+			smtpFrom = "finance-tracker@localhost"
+		}
+		dispatcher.Register(model.ChannelEmail, notify.SMTP{
+			Host:     smtpHost,
+			Port:     envInt("SMTP_PORT", 25),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     smtpFrom,
+		})
+	}
+	jobs.Every("notifications", time.Minute, func(db *pgx.Conn) error {
+		sent, failed, err := repository.DeliverNotifications(db, dispatcher)
+		if sent+failed > 0 {
+			log.Printf("Delivered %d notifications, %d failed", sent, failed)
+		}
+		return err
+	})
+
+	billReminderDays := envInt("BILL_REMINDER_DAYS", 3)
+	jobs.Every("bill-reminders", 6*time.Hour, func(db *pgx.Conn) error {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		_, err := repository.QueueBillReminders(db, today, billReminderDays)
+		return err
+	})
+
 	//start the server
 	log.Println("Server is starting on http://localhost:8080/home")
 	fmt.Println("Homepage: http://localhost:8080/home")
 	
-	templates := template.Must(template.ParseFiles("templates/home.html"));
+	templates := template.Must(template.ParseGlob("templates/*.html"));
 
 
 
@@ -34,13 +133,99 @@ func main() {
     	http.Redirect(w, r, "/home", http.StatusMovedPermanently)
 	})
 	http.HandleFunc(("/home"), handler.GetSummaryHandler(db,templates))
-	http.HandleFunc(("/Balances"), handler.GetAllSourcesHandler(db))
+	handler.HandleToken(db, "/Balances", model.ScopeRead, handler.GetAllSourcesHandler(db))
 	http.HandleFunc(("/AddTransaction"), handler.AddTransactionHandler(db,templates))
 	http.HandleFunc(("/AddSource"), handler.AddSourceHandler(db))
 	http.HandleFunc(("/delete-transactions"), handler.DeleteTransactionsHandler(db))
 	http.HandleFunc(("/delete-sources"),handler.InactiveSoucesHandler(db))
+	// The token pages sit behind ADMIN_SECRET when it is set; without it they
+	// stay open but can't create admin tokens.
+	adminSecret := os.Getenv("ADMIN_SECRET")
+	allowAdmin := adminSecret != ""
+	http.HandleFunc(("/tokens"), handler.RequireSecret(adminSecret, handler.TokensHandler(db, templates, allowAdmin)))
+	http.HandleFunc(("/tokens/create"), handler.RequireSecret(adminSecret, handler.CreateTokenHandler(db, templates, allowAdmin)))
+	http.HandleFunc(("/tokens/revoke"), handler.RequireSecret(adminSecret, handler.RevokeTokensHandler(db)))
+	http.HandleFunc(("/sources"), handler.SourcesHandler(db, templates))
+	http.HandleFunc(("/sources/reactivate"), handler.ReactivateSourcesHandler(db))
+	http.HandleFunc(("/sources/rename"), handler.RenameSourceHandler(db))
+	http.HandleFunc(("/sources/close"), handler.CloseSourceHandler(db))
+	http.HandleFunc(("/sources/threshold"), handler.SetThresholdHandler(db))
+	http.HandleFunc(("/cards"), handler.CardsHandler(db, templates))
+	http.HandleFunc(("/cards/settings"), handler.SaveCardSettingsHandler(db))
+	http.HandleFunc(("/cards/pay"), handler.PayCardHandler(db))
+	http.HandleFunc(("/loans"), handler.LoansHandler(db, templates))
+	http.HandleFunc(("/loans/terms"), handler.SaveLoanTermsHandler(db))
+	http.HandleFunc(("/loans/pay"), handler.LoanPaymentHandler(db))
+	http.HandleFunc(("/reports"), handler.ReportsHandler(db, templates))
+	http.HandleFunc(("/forecast"), handler.ForecastHandler(db, templates))
+	http.HandleFunc(("/forecast/recurring"), handler.AddRecurringHandler(db))
+	http.HandleFunc(("/forecast/recurring/delete"), handler.DeleteRecurringHandler(db))
+	http.HandleFunc(("/goals"), handler.GoalsHandler(db, templates))
+	http.HandleFunc(("/goals/create"), handler.CreateGoalHandler(db))
+	http.HandleFunc(("/goals/allocate"), handler.AllocateGoalHandler(db))
+	http.HandleFunc(("/goals/delete"), handler.DeleteGoalsHandler(db))
+	http.HandleFunc(("/rules"), handler.RulesHandler(db, templates))
+	http.HandleFunc(("/rules/create"), handler.CreateRuleHandler(db))
+	http.HandleFunc(("/rules/update"), handler.UpdateRulesHandler(db))
+	http.HandleFunc(("/rules/apply"), handler.ApplyRulesHandler(db))
+	http.HandleFunc(("/transactions/split"), handler.SplitHandler(db, templates))
+	http.HandleFunc(("/transactions/split/save"), handler.SaveSplitsHandler(db))
+	http.HandleFunc(("/transactions/details"), handler.TransactionDetailsHandler(db, templates, maxAttachmentMB))
+	http.HandleFunc(("/transactions/details/save"), handler.SaveTransactionDetailsHandler(db))
+	http.HandleFunc(("/attachments"), handler.AttachmentHandler(db, store))
+	http.HandleFunc(("/attachments/upload"), handler.UploadAttachmentHandler(db, store, int64(maxAttachmentMB)<<20))
+	http.HandleFunc(("/attachments/delete"), handler.DeleteAttachmentsHandler(db))
+	http.HandleFunc(("/fields"), handler.FieldsHandler(db, templates))
+	http.HandleFunc(("/fields/create"), handler.CreateFieldHandler(db))
+	http.HandleFunc(("/fields/delete"), handler.DeleteFieldsHandler(db))
+	http.HandleFunc(("/payees"), handler.PayeesHandler(db, templates))
+	http.HandleFunc(("/payees/create"), handler.CreatePayeeHandler(db))
+	http.HandleFunc(("/payees/match"), handler.MatchPayeesHandler(db))
+	http.HandleFunc(("/payees/merge"), handler.MergePayeesHandler(db))
+	http.HandleFunc(("/payees/view"), handler.PayeeHandler(db, templates))
+	http.HandleFunc(("/payees/update"), handler.UpdatePayeeHandler(db))
+	http.HandleFunc(("/payees/alias"), handler.AddPayeeAliasHandler(db))
+	http.HandleFunc(("/payees/alias/delete"), handler.DeletePayeeAliasHandler(db))
+	http.HandleFunc(("/transactions/payee"), handler.AssignPayeeHandler(db))
+	http.HandleFunc(("/subscriptions"), handler.SubscriptionsHandler(db, templates))
+	http.HandleFunc(("/bills"), handler.BillsHandler(db, templates))
+	http.HandleFunc(("/bills/feeds/create"), handler.CreateCalendarFeedHandler(db, templates))
+	http.HandleFunc(("/bills/feeds/revoke"), handler.RevokeCalendarFeedsHandler(db))
+	http.HandleFunc(("/bills.ics"), handler.CalendarFeedHandler(db))
+	http.HandleFunc(("/alerts"), handler.AlertsHandler(db, templates))
+	http.HandleFunc(("/alerts/dismiss"), handler.DismissAlertHandler(db))
+	http.HandleFunc(("/notifications"), handler.NotificationsHandler(db, templates, dispatcher))
+	http.HandleFunc(("/notifications/recipients/create"), handler.AddRecipientHandler(db))
+	http.HandleFunc(("/notifications/recipients/delete"), handler.DeleteRecipientHandler(db))
+	http.HandleFunc(("/notifications/preferences"), handler.RecipientPreferencesHandler(db))
+	http.HandleFunc(("/notifications/test"), handler.TestNotificationHandler(db, dispatcher))
+	http.HandleFunc(("/notifications/retry"), handler.RetryNotificationHandler(db))
+	http.HandleFunc(("/duplicates"), handler.DuplicatesHandler(db, templates))
+	http.HandleFunc(("/duplicates/resolve"), handler.ResolveDuplicatesHandler(db))
+	http.HandleFunc(("/audit"), handler.AuditHandler(db, templates))
+	http.HandleFunc(("/trash"), handler.TrashHandler(db, templates, retentionDays))
+	http.HandleFunc(("/trash/restore-transactions"), handler.RestoreTransactionsHandler(db))
+	http.HandleFunc(("/trash/restore-sources"), handler.RestoreSourcesHandler(db))
+	http.HandleFunc(("/trash/undo"), handler.UndoDeleteHandler(db))
+
+	// JSON API, authenticated with bearer tokens
+	handler.HandleToken(db, "/api/transactions", model.ScopeRead, handler.APITransactionsHandler(db))
+	handler.HandleToken(db, "/api/forecast", model.ScopeRead, handler.APIForecastHandler(db))
+	handler.HandleToken(db, "/api/tokens", model.ScopeAdmin, handler.APIGetTokensHandler(db))
+	handler.HandleToken(db, "/api/balance-history", model.ScopeRead, handler.APIBalanceHistoryHandler(db))
+	handler.HandleToken(db, "/api/reports", model.ScopeRead, handler.APIReportHandler(db))
+	handler.HandleToken(db, "/api/category-suggestions", model.ScopeRead, handler.APICategorySuggestionsHandler())
+	handler.HandleToken(db, "/api/payees", model.ScopeRead, handler.APIPayeesHandler(db))
+	handler.HandleToken(db, "/api/subscriptions", model.ScopeRead, handler.APISubscriptionsHandler(db))
+	handler.HandleToken(db, "/api/bills", model.ScopeRead, handler.APIBillsHandler(db))
+	handler.HandleToken(db, "/api/alerts", model.ScopeRead, handler.APIAlertsHandler(db))
+	handler.HandleToken(db, "/api/notifications", model.ScopeRead, handler.APINotificationsHandler(db))
+	handler.HandleToken(db, "/api/attachments", model.ScopeRead, handler.APIAttachmentsHandler(db, store))
+	handler.HandleToken(db, "/api/audit", model.ScopeAdmin, handler.APIAuditHandler(db))
 
-	err = http.ListenAndServe(":8080", nil)
+	// Request bodies may hold an upload plus the rest of its form.
+	maxBody := int64(maxAttachmentMB)<<20 + 1<<20
+	err = http.ListenAndServe(":8080", handler.SecureHeaders(handler.MaxBodySize(maxBody, handler.CSRFProtect(http.DefaultServeMux))))
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
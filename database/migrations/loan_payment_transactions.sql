@@ -0,0 +1,13 @@
+-- Links loan payments to the transactions they recorded, so that a payment is
+-- trashed, restored and purged together with them. Payments recorded before
+-- this stay unlinked.
+--
+--   psql "$DATABASE_URL" -f database/migrations/loan_payment_transactions.sql
+
+BEGIN;
+
+ALTER TABLE LOAN_PAYMENT ADD COLUMN IF NOT EXISTS TRANSFER_ID UUID;
+ALTER TABLE LOAN_PAYMENT ADD COLUMN IF NOT EXISTS INTEREST_TRANSACTION_ID UUID
+    REFERENCES TRANSACTION(TRANSACTION_ID) ON DELETE SET NULL;
+
+COMMIT;
@@ -0,0 +1,95 @@
+// Package dedupe decides whether two transactions are likely the same one
+// entered twice, and groups likely duplicates into clusters.
+package dedupe
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MinSimilarity is the least name similarity at which two transactions with
+// the same source, type and amount on close dates count as duplicates.
+const MinSimilarity = 0.5
+
+// words returns the lower-cased words of a name, leaving out bare numbers
+// such as card or reference numbers that differ between otherwise identical
+// entries.
+func words(name string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.IndexFunc(w, unicode.IsLetter) >= 0 {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+// Similarity returns how alike two transaction names are, from 0 to 1: the
+// share of the shorter name's words that also appear in the other, so that
+// "Coffee" and "Starbucks coffee" are alike. Names without any words are
+// only alike when they are equal.
+func Similarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+			return 1
+		}
+		return 0
+	}
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+	var common int
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(wa))
+}
+
+// Similar reports whether two names are alike enough for a duplicate.
+func Similar(a, b string) bool {
+	return Similarity(a, b) >= MinSimilarity
+}
+
+// Clusters joins pairs of duplicates into groups, so that when A duplicates B
+// and B duplicates C all three end up in one cluster. Clusters are returned in
+// the order their first member first appears in pairs.
+func Clusters[T comparable](pairs [][2]T) [][]T {
+	parent := make(map[T]T)
+	var order []T
+	var find func(T) T
+	find = func(x T) T {
+		if _, ok := parent[x]; !ok {
+			parent[x] = x
+			order = append(order, x)
+		}
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+	for _, p := range pairs {
+		ra, rb := find(p[0]), find(p[1])
+		if ra != rb {
+			parent[rb] = ra
+		}
+	}
+
+	index := make(map[T]int)
+	var clusters [][]T
+	for _, x := range order {
+		root := find(x)
+		i, ok := index[root]
+		if !ok {
+			i = len(clusters)
+			index[root] = i
+			clusters = append(clusters, nil)
+		}
+		clusters[i] = append(clusters[i], x)
+	}
+	return clusters
+}
@@ -0,0 +1,64 @@
+// Package events lets parts of the system react to things that happen
+// elsewhere without the code raising them knowing who listens. Events are
+// published inside the database transaction that caused them, and handlers
+// run synchronously in it, so whatever a handler writes commits or rolls back
+// together with the change.
+package events
+
+import (
+	"finance-tracker/model"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Event is something that happened. Name is what handlers subscribe to.
+type Event interface {
+	Name() string
+}
+
+// Handler reacts to an event. An error rolls back the transaction the event
+// was published in.
+type Handler func(tx pgx.Tx, e Event) error
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string][]Handler)
+)
+
+// Subscribe registers h for events with the given name. Handlers are usually
+// registered at startup and run in the order they were registered.
+func Subscribe(name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[name] = append(handlers[name], h)
+}
+
+// Publish runs the handlers subscribed to e, stopping at the first error.
+func Publish(tx pgx.Tx, e Event) error {
+	mu.RLock()
+	hs := handlers[e.Name()]
+	mu.RUnlock()
+	for _, h := range hs {
+		if err := h(tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LowBalance is published when a source's available funds (or credit) drop
+// below its low-balance threshold. It is not repeated while the source stays
+// below the threshold.
+type LowBalance struct {
+	Account model.Account
+}
+
+func (LowBalance) Name() string { return model.EventLowBalance }
+
+// AlertRaised is published when a spending alert is recorded.
+type AlertRaised struct {
+	Alert model.Alert
+}
+
+func (AlertRaised) Name() string { return model.EventAlert }
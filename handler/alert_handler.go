@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// dashboardAlerts is how many of the newest open alerts the dashboard shows.
+const dashboardAlerts = 5
+
+// AlertsHandler lists the spending alerts; dismissed ones too with
+// ?show_dismissed=true.
+func AlertsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		showDismissed := r.URL.Query().Get("show_dismissed") == "true"
+		alerts, err := repository.GetAlerts(db, showDismissed, 0)
+		if err != nil {
+			http.Error(w, "Failed to fetch alerts", http.StatusInternalServerError)
+			return
+		}
+		data := model.AlertsPageData{
+			Alerts:        alerts,
+			ShowDismissed: showDismissed,
+			CSRFToken:     csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "alerts.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// DismissAlertHandler hides an alert and goes back to the page it was
+// dismissed from: the dashboard or the alert list.
+func DismissAlertHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(r.PostFormValue("alert_id"))
+		if err != nil {
+			http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+			return
+		}
+
+		err = repository.DismissAlert(db, actorFromRequest(r), id)
+		if errors.Is(err, repository.ErrAlertNotFound) {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Failed to dismiss alert: %v", err)
+			http.Error(w, "Failed to dismiss alert", http.StatusInternalServerError)
+			return
+		}
+		redirect := "/"
+		if r.PostFormValue("from") == "alerts" {
+			redirect = "/alerts"
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	}
+}
+
+// APIAlertsHandler serves GET /api/alerts: the open alerts, newest first, or
+// every alert with ?all=true.
+func APIAlertsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		alerts, err := repository.GetAlerts(db, r.URL.Query().Get("all") == "true", 0)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch alerts")
+			return
+		}
+		writeJSON(w, http.StatusOK, alerts)
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type tokenContextKey struct{}
+
+// tokenFromRequest returns the API token that authenticated the request, if any.
+func tokenFromRequest(r *http.Request) (model.APIToken, bool) {
+	t, ok := r.Context().Value(tokenContextKey{}).(model.APIToken)
+	return t, ok
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// RequireToken only lets requests through that carry a valid bearer token
+// with at least the given scope.
+func RequireToken(db *pgx.Conn, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plaintext := bearerToken(r)
+		if plaintext == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finance-tracker"`)
+			writeJSONError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		token, err := repository.AuthenticateAPIToken(db, plaintext)
+		if errors.Is(err, repository.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finance-tracker", error="invalid_token"`)
+			writeJSONError(w, http.StatusUnauthorized, "invalid or revoked token")
+			return
+		} else if err != nil {
+			log.Printf("Failed to authenticate token: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "an internal server error occurred")
+			return
+		}
+
+		if !token.HasScope(scope) {
+			writeJSONError(w, http.StatusForbidden, "token lacks the '"+scope+"' scope")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tokenContextKey{}, token)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// tokenRoutes holds the paths registered with HandleToken. CSRFProtect only
+// exempts bearer-token requests to these paths, where a forged request without
+// a valid token is refused anyway. It is only written while routes are
+// registered at startup.
+var tokenRoutes = make(map[string]bool)
+
+// HandleToken registers h for pattern on the default mux behind RequireToken
+// with the given scope.
+func HandleToken(db *pgx.Conn, pattern, scope string, h http.HandlerFunc) {
+	tokenRoutes[pattern] = true
+	http.HandleFunc(pattern, RequireToken(db, scope, h))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to serialize response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func APIGetTransactionsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter model.TransactionFilter
+		if err := decoder.Decode(&filter, r.URL.Query()); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid filter")
+			return
+		}
+		transactions, err := repository.GetTransactions(db, filter)
+		if errors.Is(err, repository.ErrUnknownField) {
+			writeJSONError(w, http.StatusBadRequest, "unknown custom field")
+			return
+		} else if errors.Is(err, repository.ErrPayeeNotFound) {
+			writeJSONError(w, http.StatusBadRequest, "unknown payee")
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch transactions")
+			return
+		}
+		writeJSON(w, http.StatusOK, transactions)
+	}
+}
+
+func APIAddTransactionHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body model.APITransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if body.TransactionDate == "" {
+			body.TransactionDate = time.Now().Format("2006-01-02")
+		}
+		if _, err := time.Parse("2006-01-02", body.TransactionDate); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "transaction_date must be formatted as YYYY-MM-DD")
+			return
+		}
+
+		req := model.AddTransactionRequest{
+			Amount:          strconv.FormatFloat(body.Amount, 'f', -1, 64),
+			CategoryType:    body.CategoryType,
+			CategoryName:    body.CategoryName,
+			SourceName:      body.SourceName,
+			TransactionDate: body.TransactionDate,
+			Category:        body.Category,
+			Notes:           body.Notes,
+			Tags:            strings.Join(body.Tags, ","),
+			Fields:          body.Fields,
+			AllowDuplicate:  body.AllowDuplicate,
+			Splits:          body.Splits,
+		}
+
+		err := repository.AddTransactions(db, actorFromRequest(r), req)
+		if errors.Is(err, repository.ErrPossibleDuplicate) {
+			// Nothing was added; the client resends with allow_duplicate
+			// set if the transaction really happened twice.
+			duplicates, findErr := repository.FindPossibleDuplicates(db, req)
+			if findErr != nil {
+				log.Printf("Failed to load possible duplicates: %v", findErr)
+				writeJSONError(w, http.StatusInternalServerError, "an internal server error occurred")
+				return
+			}
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"error":      err.Error(),
+				"warning":    "possible_duplicate",
+				"duplicates": duplicates,
+			})
+			return
+		} else if errors.Is(err, repository.ErrNotEnoughBalance) || errors.Is(err, repository.ErrNegativeAmount) ||
+			errors.Is(err, repository.ErrInvalidSplit) || errors.Is(err, repository.ErrUnknownField) ||
+			errors.Is(err, repository.ErrInvalidFieldValue) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		} else if err != nil {
+			log.Printf("Failed to add transaction via API: %v", err)
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "created"})
+	}
+}
+
+// APITransactionsHandler serves GET (read scope) and POST (write scope) on
+// /api/transactions. It is registered with the read scope and checks the
+// write scope itself.
+func APITransactionsHandler(db *pgx.Conn) http.HandlerFunc {
+	get := APIGetTransactionsHandler(db)
+	post := APIAddTransactionHandler(db)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			get(w, r)
+		case http.MethodPost:
+			if token, _ := tokenFromRequest(r); !token.HasScope(model.ScopeWrite) {
+				writeJSONError(w, http.StatusForbidden, "token lacks the '"+model.ScopeWrite+"' scope")
+				return
+			}
+			post(w, r)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+func APIGetTokensHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		tokens, err := repository.GetAllAPITokens(db)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch tokens")
+			return
+		}
+		writeJSON(w, http.StatusOK, tokens)
+	}
+}
+
+// APICategorySuggestionsHandler serves GET /api/category-suggestions: the
+// likely categories for a transaction given its name, amount and type, with
+// their confidence.
+func APICategorySuggestionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		query := r.URL.Query()
+		name := strings.TrimSpace(query.Get("name"))
+		if name == "" {
+			writeJSONError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		var amount float64
+		if v := query.Get("amount"); v != "" {
+			var err error
+			if amount, err = strconv.ParseFloat(v, 64); err != nil || amount < 0 {
+				writeJSONError(w, http.StatusBadRequest, "amount must be a non-negative number")
+				return
+			}
+		}
+		limit := suggestionLimit
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = n
+		}
+		writeJSON(w, http.StatusOK, repository.SuggestCategories(name, amount, query.Get("transaction_type"), limit))
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/attachments"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var attachmentErrorMessages = map[string]string{
+	"missing_file":     "Choose a file to attach.",
+	"too_large":        "That file is larger than the upload limit.",
+	"unsupported_type": "Only JPEG, PNG, GIF and WebP images, PDFs and plain text files can be attached.",
+}
+
+// attachmentFileName cleans up the name a browser sent for an upload: any
+// directory part is dropped and the name is kept to a sensible length.
+func attachmentFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if r := []rune(name); len(r) > 200 {
+		name = string(r[:200])
+	}
+	return name
+}
+
+// UploadAttachmentHandler stores a file uploaded from the details page of a
+// transaction. The content type is detected from the file itself, and images
+// get a thumbnail.
+func UploadAttachmentHandler(db *pgx.Conn, store *attachments.Store, maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(r.PostFormValue("transaction_id"))
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+		redirectError := func(key string) {
+			q := url.Values{"id": {id.String()}, "error": {key}}
+			http.Redirect(w, r, "/transactions/details?"+q.Encode(), http.StatusSeeOther)
+		}
+
+		file, header, err := r.FormFile("file")
+		if errors.Is(err, http.ErrMissingFile) {
+			redirectError("missing_file")
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if header.Size > maxBytes {
+			redirectError("too_large")
+			return
+		}
+		contentType, content, err := attachments.Sniff(file)
+		if errors.Is(err, attachments.ErrUnsupportedType) {
+			redirectError("unsupported_type")
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return
+		}
+
+		hash, size, err := store.Put(content)
+		if err != nil {
+			log.Printf("Failed to store attachment: %v", err)
+			http.Error(w, "Failed to store attachment", http.StatusInternalServerError)
+			return
+		}
+		a := model.Attachment{
+			TransactionID: id,
+			FileName:      attachmentFileName(header.Filename),
+			ContentType:   contentType,
+			Size:          size,
+			SHA256:        hash,
+		}
+		if attachments.ThumbnailTypes[contentType] {
+			// A file that only looks like an image is still attached, just
+			// without a thumbnail.
+			if err := store.MakeThumbnail(hash); err != nil {
+				log.Printf("Failed to make thumbnail of %s: %v", hash, err)
+			} else {
+				a.HasThumbnail = true
+			}
+		}
+
+		_, err = repository.AddAttachment(db, actorFromRequest(r), a)
+		if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("Failed to save attachment: %v", err)
+			http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/transactions/details?id="+id.String(), http.StatusSeeOther)
+	}
+}
+
+// serveAttachment sends an attachment's file, or its thumbnail. Files are
+// always sent as downloads; only thumbnails are shown inline.
+func serveAttachment(w http.ResponseWriter, r *http.Request, store *attachments.Store, a model.Attachment, thumbnail bool) {
+	if thumbnail && !a.HasThumbnail {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := store.Open(a.SHA256, thumbnail)
+	if errors.Is(err, attachments.ErrNotFound) {
+		log.Printf("Attachment %s is missing its file %s", a.AttachmentID, a.SHA256)
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("Failed to open attachment: %v", err)
+		http.Error(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	if thumbnail {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Disposition", "inline")
+	} else {
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.FileName}))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", a.CreatedAt, f)
+}
+
+// AttachmentHandler serves GET /attachments?id=...: the attached file, or
+// its thumbnail with thumbnail=true.
+func AttachmentHandler(db *pgx.Conn, store *attachments.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := uuid.Parse(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return
+		}
+		a, err := repository.GetAttachment(db, id)
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch attachment", http.StatusInternalServerError)
+			return
+		}
+		serveAttachment(w, r, store, a, r.URL.Query().Get("thumbnail") == "true")
+	}
+}
+
+func DeleteAttachmentsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		transactionID, err := uuid.Parse(r.PostForm.Get("transaction_id"))
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["attachment_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid attachment ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			if _, err := repository.DeleteAttachments(db, actorFromRequest(r), ids); err != nil {
+				log.Printf("Failed to delete attachments: %v", err)
+				http.Error(w, "Failed to delete attachments", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, "/transactions/details?id="+transactionID.String(), http.StatusSeeOther)
+	}
+}
+
+// APIAttachmentsHandler serves GET /api/attachments: the attachments of a
+// transaction with transaction_id=..., or the file of one attachment with
+// id=... (its thumbnail with thumbnail=true as well).
+func APIAttachmentsHandler(db *pgx.Conn, store *attachments.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		query := r.URL.Query()
+		if v := query.Get("id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid attachment id")
+				return
+			}
+			a, err := repository.GetAttachment(db, id)
+			if errors.Is(err, repository.ErrAttachmentNotFound) {
+				writeJSONError(w, http.StatusNotFound, "attachment not found")
+				return
+			} else if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "failed to fetch attachment")
+				return
+			}
+			serveAttachment(w, r, store, a, query.Get("thumbnail") == "true")
+			return
+		}
+
+		transactionID, err := uuid.Parse(query.Get("transaction_id"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "transaction_id or id is required")
+			return
+		}
+		list, err := repository.GetAttachments(db, transactionID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch attachments")
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
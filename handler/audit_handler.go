@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// actorFromRequest describes who is making the request for the audit log.
+// Requests authenticated with an API token are attributed to that token,
+// everything else to the browser session.
+func actorFromRequest(r *http.Request) model.Actor {
+	name := "web"
+	if t, ok := tokenFromRequest(r); ok {
+		name = "token:" + t.Name
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return model.Actor{Name: name, OriginIP: ip, UserAgent: r.UserAgent()}
+}
+
+func decodeAuditFilter(r *http.Request) (model.AuditFilter, error) {
+	var f model.AuditFilter
+	err := decoder.Decode(&f, r.URL.Query())
+	return f, err
+}
+
+func AuditHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f, err := decodeAuditFilter(r)
+		if err != nil {
+			http.Error(w, "Invalid filter", http.StatusBadRequest)
+			return
+		}
+		entries, err := repository.GetAuditLog(db, f)
+		if errors.Is(err, repository.ErrInvalidAuditFilter) {
+			http.Error(w, "Invalid filter: dates must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Failed to fetch audit log: %v", err)
+			http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+			return
+		}
+
+		err = tmpl.ExecuteTemplate(w, "audit.html", model.AuditPageData{Entries: entries, Filter: f, Actions: repository.AuditActions})
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func APIAuditHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		f, err := decodeAuditFilter(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid filter")
+			return
+		}
+		entries, err := repository.GetAuditLog(db, f)
+		if errors.Is(err, repository.ErrInvalidAuditFilter) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			log.Printf("Failed to fetch audit log: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch audit log")
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
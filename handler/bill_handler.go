@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/ical"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// calendarFeedDays is how far ahead the iCalendar feed lists bills. Calendar
+// apps refresh the feed on their own schedule, so it covers a whole year.
+const calendarFeedDays = 365
+
+// calendarFeedURL is the address a calendar app subscribes to for a feed
+// token, on the host the request was made to.
+func calendarFeedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || secureCookies() {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: "/bills.ics", RawQuery: url.Values{"token": {token}}.Encode()}
+	return u.String()
+}
+
+func renderBillsPage(w http.ResponseWriter, r *http.Request, db *pgx.Conn, tmpl *template.Template, data model.BillsPageData) {
+	if data.Days == 0 {
+		data.Days = forecastRange(r)
+	}
+	from := today()
+	bills, err := repository.GetUpcomingBills(db, from, from.AddDate(0, 0, data.Days))
+	if err != nil {
+		http.Error(w, "Failed to fetch bills", http.StatusInternalServerError)
+		return
+	}
+	feeds, err := repository.GetCalendarFeeds(db)
+	if err != nil {
+		http.Error(w, "Failed to fetch calendar feeds", http.StatusInternalServerError)
+		return
+	}
+	data.Bills = bills
+	data.Feeds = feeds
+	for _, b := range bills {
+		data.Total += b.Amount
+	}
+	data.CSRFToken = csrfToken(r)
+	if data.FormErrors == nil {
+		data.FormErrors = make(map[string]string)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "bills.html", data)
+	if err != nil {
+		log.Printf("Failed to render template: %v", err)
+	}
+}
+
+func BillsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		renderBillsPage(w, r, db, tmpl, model.BillsPageData{})
+	}
+}
+
+func CreateCalendarFeedHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var req model.CreateCalendarFeedRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			log.Printf("!!! Failed to decode form data: %v", err)
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+
+		data := model.BillsPageData{FormErrors: make(map[string]string)}
+		plaintext, _, err := repository.CreateCalendarFeed(db, req)
+		if errors.Is(err, repository.ErrEmptyFeedName) {
+			data.FormErrors["name"] = "Please give the calendar feed a name."
+		} else if err != nil {
+			log.Printf("Failed to create calendar feed: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+
+		// The feed URL holds the token, so it is only shown on this response.
+		if plaintext != "" {
+			data.NewFeedURL = calendarFeedURL(r, plaintext)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		renderBillsPage(w, r, db, tmpl, data)
+	}
+}
+
+func RevokeCalendarFeedsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["feed_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid feed ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			http.Redirect(w, r, "/bills", http.StatusSeeOther)
+			return
+		}
+
+		if _, err := repository.RevokeCalendarFeeds(db, ids); err != nil {
+			log.Printf("Failed to revoke calendar feeds: %v", err)
+			http.Error(w, "Failed to revoke calendar feeds", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/bills", http.StatusSeeOther)
+	}
+}
+
+// CalendarFeedHandler serves GET /bills.ics?token=...: the upcoming bills as
+// an iCalendar feed. Calendar apps can't send an Authorization header, so the
+// feed is authenticated by its own token in the URL rather than an API token.
+func CalendarFeedHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		feed, err := repository.AuthenticateCalendarFeed(db, r.URL.Query().Get("token"))
+		if errors.Is(err, repository.ErrInvalidCalendarFeed) {
+			http.Error(w, "Invalid or revoked calendar feed", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to authenticate calendar feed", http.StatusInternalServerError)
+			return
+		}
+
+		from := today()
+		bills, err := repository.GetUpcomingBills(db, from, from.AddDate(0, 0, calendarFeedDays))
+		if err != nil {
+			http.Error(w, "Failed to fetch bills", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if err := ical.Write(w, "Bills - "+feed.Name, bills, time.Now()); err != nil {
+			log.Printf("Failed to write calendar feed: %v", err)
+		}
+	}
+}
+
+// APIBillsHandler serves GET /api/bills: the bills due within the next days
+// (default 30), soonest first.
+func APIBillsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		from := today()
+		bills, err := repository.GetUpcomingBills(db, from, from.AddDate(0, 0, forecastRange(r)))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch bills")
+			return
+		}
+		writeJSON(w, http.StatusOK, bills)
+	}
+}
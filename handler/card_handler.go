@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// statementCycles is how many past statements the cards page shows per card.
+const statementCycles = 6
+
+var cardErrorMessages = map[string]string{
+	"invalid_days":       "Statement and due days must be between 1 and 31.",
+	"invalid_min":        "Minimum payment must be a percentage between 0 and 100 and a non-negative amount.",
+	"not_a_card":         "That source is not a credit card.",
+	"nothing_due":        "Nothing is due on this card. Enter an amount to pay anyway.",
+	"not_enough_balance": "The paying source doesn't have enough balance.",
+	"invalid_payment":    "Choose an active source other than the card to pay from.",
+	"not_a_bank_account": "Card payments must come from a checking or savings account.",
+}
+
+func cardErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidStatementDay):
+		return "invalid_days"
+	case errors.Is(err, repository.ErrInvalidMinPayment):
+		return "invalid_min"
+	case errors.Is(err, repository.ErrNotACreditCard):
+		return "not_a_card"
+	case errors.Is(err, repository.ErrNothingDue):
+		return "nothing_due"
+	case errors.Is(err, repository.ErrNotEnoughBalance):
+		return "not_enough_balance"
+	case errors.Is(err, repository.ErrNotABankAccount):
+		return "not_a_bank_account"
+	case errors.Is(err, repository.ErrSameSource), errors.Is(err, repository.ErrSourceInactive),
+		errors.Is(err, repository.ErrSourceNotFound), errors.Is(err, repository.ErrNegativeAmount):
+		return "invalid_payment"
+	}
+	return ""
+}
+
+func CardsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cards, err := repository.GetCreditCards(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch credit cards", http.StatusInternalServerError)
+			return
+		}
+		var views []model.CardView
+		for _, card := range cards {
+			statements, err := repository.GetCardStatements(db, card, statementCycles, time.Now())
+			if err != nil {
+				http.Error(w, "Failed to compute statements", http.StatusInternalServerError)
+				return
+			}
+			views = append(views, model.CardView{Card: card, Configured: card.StatementDay > 0, Statements: statements})
+		}
+
+		sources, err := repository.GetAllSources(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+			return
+		}
+		var paymentSources []string
+		for _, s := range sources {
+			if s.IsBankAccount() {
+				paymentSources = append(paymentSources, s.SourceName)
+			}
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := cardErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["cards"] = msg
+		}
+
+		data := model.CardsPageData{
+			Cards:          views,
+			PaymentSources: paymentSources,
+			FormErrors:     formErrors,
+			CSRFToken:      csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "cards.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func handleCardMutation(w http.ResponseWriter, r *http.Request, fn func() error) {
+	err := fn()
+	if key := cardErrorKey(err); key != "" {
+		http.Redirect(w, r, "/cards?error="+key, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Printf("An unexpected error occurred: %v", err)
+		http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/cards", http.StatusSeeOther)
+}
+
+func SaveCardSettingsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CardSettingsRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/cards?error=invalid_days", http.StatusSeeOther)
+			return
+		}
+		handleCardMutation(w, r, func() error {
+			return repository.SaveCardSettings(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+func PayCardHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.PayCardRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		handleCardMutation(w, r, func() error {
+			_, err := repository.PayCard(db, actorFromRequest(r), req)
+			return err
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var duplicateErrorMessages = map[string]string{
+	"invalid_merge":      "Choose the transaction to keep. Only transactions with the same source, type and amount can be merged.",
+	"not_enough_balance": "Merging would take back income a source has already spent, leaving it without enough balance.",
+	"source_inactive":    "Transactions of an inactive source can't be merged. Reactivate the source first.",
+}
+
+func DuplicatesHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		clusters, err := repository.GetDuplicateClusters(db)
+		if err != nil {
+			http.Error(w, "Failed to find duplicates", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := duplicateErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["duplicates"] = msg
+		}
+		merged, err := strconv.Atoi(r.URL.Query().Get("merged"))
+
+		data := model.DuplicatesPageData{
+			Clusters:   clusters,
+			WindowDays: repository.DuplicateWindowDays,
+			FormErrors: formErrors,
+			Merged:     merged,
+			ShowMerged: err == nil,
+			CSRFToken:  csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "duplicates.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// ResolveDuplicatesHandler merges a duplicate cluster into the transaction
+// chosen to keep, or dismisses it, depending on the submitted action.
+func ResolveDuplicatesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["transaction_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid transaction ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) < 2 {
+			http.Redirect(w, r, "/duplicates", http.StatusSeeOther)
+			return
+		}
+
+		actor := actorFromRequest(r)
+		switch r.PostFormValue("action") {
+		case "merge":
+			keep, err := uuid.Parse(r.PostFormValue("keep"))
+			if err != nil {
+				http.Redirect(w, r, "/duplicates?error=invalid_merge", http.StatusSeeOther)
+				return
+			}
+			_, n, err := repository.MergeDuplicates(db, actor, keep, ids)
+			if errors.Is(err, repository.ErrInvalidMerge) {
+				http.Redirect(w, r, "/duplicates?error=invalid_merge", http.StatusSeeOther)
+				return
+			} else if errors.Is(err, repository.ErrNotEnoughBalance) {
+				http.Redirect(w, r, "/duplicates?error=not_enough_balance", http.StatusSeeOther)
+				return
+			} else if errors.Is(err, repository.ErrSourceInactive) {
+				http.Redirect(w, r, "/duplicates?error=source_inactive", http.StatusSeeOther)
+				return
+			} else if err != nil {
+				log.Printf("Failed to merge duplicates: %v", err)
+				http.Error(w, "Failed to merge duplicates", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/duplicates?merged="+strconv.FormatInt(n, 10), http.StatusSeeOther)
+		case "dismiss":
+			if _, err := repository.DismissDuplicates(db, actor, ids); err != nil {
+				log.Printf("Failed to dismiss duplicates: %v", err)
+				http.Error(w, "Failed to dismiss duplicates", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/duplicates", http.StatusSeeOther)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+		}
+	}
+}
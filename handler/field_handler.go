@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var fieldErrorMessages = map[string]string{
+	"invalid_field": "A custom field needs a name and a type.",
+	"duplicate":     "A custom field with that name already exists.",
+	"invalid_value": "A value does not match the type of its field.",
+	"unknown_field": "That custom field no longer exists.",
+}
+
+func fieldErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidField):
+		return "invalid_field"
+	case errors.Is(err, repository.ErrDuplicateField):
+		return "duplicate"
+	case errors.Is(err, repository.ErrInvalidFieldValue):
+		return "invalid_value"
+	case errors.Is(err, repository.ErrUnknownField):
+		return "unknown_field"
+	}
+	return ""
+}
+
+func FieldsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fields, err := repository.GetCustomFields(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch custom fields", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := fieldErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["fields"] = msg
+		}
+		data := model.FieldsPageData{
+			Fields:     fields,
+			FieldTypes: model.FieldTypes,
+			FormErrors: formErrors,
+			CSRFToken:  csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "fields.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func CreateFieldHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CreateFieldRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/fields?error=invalid_field", http.StatusSeeOther)
+			return
+		}
+
+		err := repository.CreateCustomField(db, actorFromRequest(r), req)
+		if key := fieldErrorKey(err); key != "" {
+			http.Redirect(w, r, "/fields?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/fields", http.StatusSeeOther)
+	}
+}
+
+func DeleteFieldsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["field_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid field ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			if _, err := repository.DeleteCustomFields(db, actorFromRequest(r), ids); err != nil {
+				log.Printf("Failed to delete custom fields: %v", err)
+				http.Error(w, "Failed to delete custom fields", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, "/fields", http.StatusSeeOther)
+	}
+}
+
+// TransactionDetailsHandler shows the notes, tags and custom field values of
+// a transaction for editing, with its payee and attachments.
+func TransactionDetailsHandler(db *pgx.Conn, tmpl *template.Template, maxAttachmentMB int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := uuid.Parse(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		t, fields, err := repository.GetTransactionDetails(db, id)
+		if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+			return
+		}
+		attachments, err := repository.GetAttachments(db, id)
+		if err != nil {
+			http.Error(w, "Failed to fetch attachments", http.StatusInternalServerError)
+			return
+		}
+		payees, err := repository.GetPayees(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch payees", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := fieldErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["details"] = msg
+		}
+		if msg, ok := attachmentErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["attachments"] = msg
+		}
+		if msg, ok := payeeErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["payee"] = msg
+		}
+		data := model.TransactionDetailsPageData{
+			Transaction:     t,
+			Fields:          fields,
+			Attachments:     attachments,
+			Payees:          payees,
+			MaxAttachmentMB: maxAttachmentMB,
+			FormErrors:      formErrors,
+			CSRFToken:       csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "details.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func SaveTransactionDetailsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.TransactionDetailsRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.TransactionID)
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		// Custom field inputs are named field_<field id>.
+		values := make(map[uuid.UUID]string)
+		for key, v := range r.PostForm {
+			name, ok := strings.CutPrefix(key, "field_")
+			if !ok || len(v) == 0 {
+				continue
+			}
+			fieldID, err := uuid.Parse(name)
+			if err != nil {
+				http.Error(w, "Invalid field ID found", http.StatusBadRequest)
+				return
+			}
+			values[fieldID] = v[0]
+		}
+
+		err = repository.SaveTransactionDetails(db, actorFromRequest(r), id, req.Notes, req.Tags, values)
+		if key := fieldErrorKey(err); key != "" {
+			q := url.Values{"id": {id.String()}, "error": {key}}
+			http.Redirect(w, r, "/transactions/details?"+q.Encode(), http.StatusSeeOther)
+			return
+		} else if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("Failed to save transaction details: %v", err)
+			http.Error(w, "Failed to save transaction details", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/home?show_all_transactions=true", http.StatusSeeOther)
+	}
+}
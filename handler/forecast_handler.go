@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/chart"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Forecast defaults: how far ahead to project, and how much history the
+// average discretionary spend is taken from.
+const (
+	forecastDays        = 30
+	maxForecastDays     = 365
+	forecastHistoryDays = 90
+)
+
+var forecastErrorMessages = map[string]string{
+	"invalid_recurring": "A recurring transaction needs a name, type, positive amount, frequency and start date.",
+	"invalid_source":    "Choose an active source.",
+}
+
+// today is the current date at midnight UTC, matching how DATE columns are
+// read from the database.
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// forecastRange reads the days query parameter, defaulting to forecastDays.
+func forecastRange(r *http.Request) int {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days <= 0 {
+		return forecastDays
+	}
+	return min(days, maxForecastDays)
+}
+
+// forecastChart draws the projected balance of a source against the lowest
+// balance it may have.
+func forecastChart(sf model.SourceForecast) template.HTML {
+	floor := 0.0
+	if model.IsLiability(sf.SourceType) && sf.CreditLimit != nil {
+		floor = -*sf.CreditLimit
+	}
+	balance := chart.Line{Series: chart.Series{Name: "Projected balance", Color: chart.TotalColor}}
+	minimum := chart.Line{Series: chart.Series{Name: "Minimum allowed", Color: chart.ExpenseColor}, Width: 1}
+	balance.Values = append(balance.Values, sf.StartBalance)
+	minimum.Values = append(minimum.Values, floor)
+	for _, d := range sf.Days {
+		balance.Values = append(balance.Values, d.Balance)
+		minimum.Values = append(minimum.Values, floor)
+	}
+	last := ""
+	if len(sf.Days) > 0 {
+		last = sf.Days[len(sf.Days)-1].Date.Format("Jan 2")
+	}
+	return chart.Lines("Projected balance of "+sf.SourceName, []chart.Line{balance, minimum}, "Today", last, chartWidth, chartHeight)
+}
+
+func ForecastHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		forecast, err := repository.GetForecast(db, forecastRange(r), forecastHistoryDays, today())
+		if err != nil {
+			http.Error(w, "Failed to compute forecast", http.StatusInternalServerError)
+			return
+		}
+		recurring, err := repository.GetRecurringTransactions(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch recurring transactions", http.StatusInternalServerError)
+			return
+		}
+		sources, err := repository.GetAllSoucesName(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := forecastErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["recurring"] = msg
+		}
+
+		charts := make(map[string]template.HTML)
+		for _, sf := range forecast.Sources {
+			charts[sf.SourceName] = forecastChart(sf)
+		}
+
+		data := model.ForecastPageData{
+			Forecast:         forecast,
+			Charts:           charts,
+			Recurring:        recurring,
+			AvailableSources: sources,
+			Frequencies:      model.RecurFrequencies,
+			FormErrors:       formErrors,
+			CSRFToken:        csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "forecast.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func AddRecurringHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.AddRecurringRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/forecast?error=invalid_recurring", http.StatusSeeOther)
+			return
+		}
+
+		err := repository.AddRecurringTransaction(db, actorFromRequest(r), req)
+		if errors.Is(err, repository.ErrInvalidRecurring) {
+			http.Redirect(w, r, "/forecast?error=invalid_recurring", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, repository.ErrSourceNotFound) || errors.Is(err, repository.ErrSourceInactive) {
+			http.Redirect(w, r, "/forecast?error=invalid_source", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/forecast", http.StatusSeeOther)
+	}
+}
+
+func DeleteRecurringHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["recurring_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid recurring transaction ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			if _, err := repository.DeleteRecurringTransactions(db, actorFromRequest(r), ids); err != nil {
+				log.Printf("Failed to delete recurring transactions: %v", err)
+				http.Error(w, "Failed to delete recurring transactions", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, "/forecast", http.StatusSeeOther)
+	}
+}
+
+func APIForecastHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		forecast, err := repository.GetForecast(db, forecastRange(r), forecastHistoryDays, today())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to compute forecast")
+			return
+		}
+		writeJSON(w, http.StatusOK, forecast)
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// goalContributions is how many recent contributions the goals page lists.
+const goalContributions = 50
+
+var goalErrorMessages = map[string]string{
+	"invalid_goal":     "A goal needs a name, a positive target amount and a target date.",
+	"duplicate_goal":   "A goal with that name already exists.",
+	"not_found":        "That goal or source does not exist.",
+	"not_asset":        "Only checking, savings and cash sources can fund goals.",
+	"not_enough":       "The source doesn't have that much unallocated balance.",
+	"release_too_much": "You can't release more than is allocated to the goal from that source.",
+	"invalid_amount":   "Enter a positive amount.",
+}
+
+func goalErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidGoal):
+		return "invalid_goal"
+	case errors.Is(err, repository.ErrDuplicateGoal):
+		return "duplicate_goal"
+	case errors.Is(err, repository.ErrGoalNotFound), errors.Is(err, repository.ErrSourceNotFound),
+		errors.Is(err, repository.ErrSourceInactive):
+		return "not_found"
+	case errors.Is(err, repository.ErrGoalSourceNotAsset):
+		return "not_asset"
+	case errors.Is(err, repository.ErrNotEnoughUnallocated):
+		return "not_enough"
+	case errors.Is(err, repository.ErrReleaseTooLarge):
+		return "release_too_much"
+	case errors.Is(err, repository.ErrNegativeAmount):
+		return "invalid_amount"
+	}
+	return ""
+}
+
+func GoalsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		goals, err := repository.GetGoals(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch goals", http.StatusInternalServerError)
+			return
+		}
+		sources, err := repository.GetSourceAllocations(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch source allocations", http.StatusInternalServerError)
+			return
+		}
+		contributions, err := repository.GetGoalContributions(db, goalContributions)
+		if err != nil {
+			http.Error(w, "Failed to fetch contributions", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := goalErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["goals"] = msg
+		}
+
+		var overAllocated []model.SourceAllocation
+		for _, s := range sources {
+			if s.OverAllocated > 0 {
+				overAllocated = append(overAllocated, s)
+			}
+		}
+
+		data := model.GoalsPageData{
+			Goals:         goals,
+			Sources:       sources,
+			OverAllocated: overAllocated,
+			Contributions: contributions,
+			Today:         today(),
+			FormErrors:    formErrors,
+			CSRFToken:     csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "goals.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func handleGoalMutation(w http.ResponseWriter, r *http.Request, fn func() error) {
+	err := fn()
+	if key := goalErrorKey(err); key != "" {
+		http.Redirect(w, r, "/goals?error="+key, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Printf("An unexpected error occurred: %v", err)
+		http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/goals", http.StatusSeeOther)
+}
+
+func CreateGoalHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CreateGoalRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/goals?error=invalid_goal", http.StatusSeeOther)
+			return
+		}
+		handleGoalMutation(w, r, func() error {
+			return repository.CreateGoal(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+func AllocateGoalHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.AllocateGoalRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/goals?error=invalid_amount", http.StatusSeeOther)
+			return
+		}
+		handleGoalMutation(w, r, func() error {
+			return repository.AllocateToGoal(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+func DeleteGoalsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["goal_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid goal ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			if _, err := repository.DeleteGoals(db, actorFromRequest(r), ids); err != nil {
+				log.Printf("Failed to delete goals: %v", err)
+				http.Error(w, "Failed to delete goals", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, "/goals", http.StatusSeeOther)
+	}
+}
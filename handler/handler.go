@@ -5,9 +5,12 @@ import (
 	"errors"
 	"finance-tracker/model"
 	"finance-tracker/repository"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +20,12 @@ import (
 
 var decoder = schema.NewDecoder()
 
+func init() {
+	// Forms carry fields such as csrf_token that are not part of the
+	// request structs.
+	decoder.IgnoreUnknownKeys(true)
+}
+
 func AddSourceHandler(db *pgx.Conn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -39,12 +48,21 @@ func AddSourceHandler(db *pgx.Conn) http.HandlerFunc {
 			return
 		}
 
-		err = repository.AddSource(db, req)
+		err = repository.AddSource(db, actorFromRequest(r), req)
 
 		if errors.Is(err, repository.ErrDuplicateSource) {
 			log.Print("Duplicate source error, redirecting")
 			http.Redirect(w, r, "/home?error=source_already_exist", http.StatusSeeOther)
 			return
+		} else if errors.Is(err, repository.ErrSourceInactive) {
+			http.Redirect(w, r, "/home?error=source_inactive", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, repository.ErrCreditLimitRequired) {
+			http.Redirect(w, r, "/home?error=credit_limit_required", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, repository.ErrInvalidSourceType) {
+			http.Redirect(w, r, "/home?error=invalid_source_type", http.StatusSeeOther)
+			return
 		} else if errors.Is(err, repository.ErrInvalidBalance) {
 			http.Redirect(w, r, "/home?error=negative_balance", http.StatusSeeOther)
 			return
@@ -60,6 +78,137 @@ func AddSourceHandler(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
+// dashboardData loads everything home.html shows. The popups are controlled
+// by the show_all_transactions and show_all_sources query parameters.
+func dashboardData(db *pgx.Conn, r *http.Request) (model.PageData, error) {
+	transactions, err := repository.GetAllTransactions(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching transactions: %w", err)
+	}
+
+	summary, err := repository.GetSummary(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching balance: %w", err)
+	}
+	limit := 5
+	if len(transactions) < limit {
+		limit = len(transactions)
+	}
+	limitedTransactions := transactions[:limit]
+
+	var AllSources []model.Account
+	sourcePopup := r.URL.Query().Get("show_all_sources") == "true"
+	if sourcePopup {
+		AllSources, err = repository.GetAllSources(db)
+		if err != nil {
+			return model.PageData{}, fmt.Errorf("fetching source balances: %w", err)
+		}
+	}
+
+	sources, err := repository.GetAllSoucesName(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching sources: %w", err)
+	}
+
+	cardDues, err := repository.GetUpcomingCardDues(db, time.Now())
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching card due dates: %w", err)
+	}
+
+	history, err := repository.GetNetWorthHistory(db, today().AddDate(0, 0, -historyDays), today())
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching net worth history: %w", err)
+	}
+
+	forecast, err := repository.GetForecast(db, forecastDays, forecastHistoryDays, today())
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching forecast: %w", err)
+	}
+
+	subscriptions, err := repository.GetSubscriptions(db, today())
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("detecting subscriptions: %w", err)
+	}
+	var missed []model.Subscription
+	for _, s := range subscriptions {
+		if s.Status == model.SubscriptionMissed {
+			missed = append(missed, s)
+		}
+	}
+	lowBalances, err := repository.GetLowBalanceSources(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching low balances: %w", err)
+	}
+	alerts, err := repository.GetAlerts(db, false, dashboardAlerts)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching alerts: %w", err)
+	}
+
+	// The transaction list popup can be narrowed by tag, text, custom field
+	// and payee; the dashboard itself always shows the latest transactions.
+	var filter model.TransactionFilter
+	if err := decoder.Decode(&filter, r.URL.Query()); err != nil {
+		return model.PageData{}, fmt.Errorf("decoding transaction filter: %w", err)
+	}
+	allTransactions := transactions
+	if filter.Active() {
+		allTransactions, err = repository.GetTransactions(db, filter)
+		if errors.Is(err, repository.ErrUnknownField) {
+			filter.FieldID, filter.FieldValue = "", ""
+			allTransactions = transactions
+		} else if errors.Is(err, repository.ErrPayeeNotFound) {
+			filter.Payee = ""
+			allTransactions = transactions
+		} else if err != nil {
+			return model.PageData{}, fmt.Errorf("filtering transactions: %w", err)
+		}
+	}
+	customFields, err := repository.GetCustomFields(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching custom fields: %w", err)
+	}
+	knownTags, err := repository.GetKnownTags(db)
+	if err != nil {
+		return model.PageData{}, fmt.Errorf("fetching tags: %w", err)
+	}
+
+	return model.PageData{
+		Balance:             summary.NetWorth,
+		Assets:              summary.Assets,
+		Liabilities:         summary.Liabilities,
+		MonthIncome:         summary.MonthIncome,
+		MonthExpense:        summary.MonthExpense,
+		Transactions:        limitedTransactions,
+		FormErrors:          make(map[string]string),
+		ShowTransPopup:      r.URL.Query().Get("show_all_transactions") == "true",
+		AllTransactions:     allTransactions,
+		AvailableSources:    sources,
+		ShowSourcesPopup:    sourcePopup,
+		AllSources:          AllSources,
+		SourceTypes:         model.SourceTypes,
+		UpcomingCardDues:    cardDues,
+		NetWorthChart:       netWorthChart(history),
+		Forecast:            forecast.Sources,
+		MissedSubscriptions: missed,
+		LowBalances:         lowBalances,
+		Alerts:              alerts,
+		TransactionFilter:   filter,
+		CustomFields:        customFields,
+		KnownTags:           knownTags,
+		CSRFToken:           csrfToken(r),
+	}, nil
+}
+
+func renderDashboard(w http.ResponseWriter, tmpl *template.Template, data model.PageData) {
+	err := tmpl.ExecuteTemplate(w, "home.html", data)
+	if err != nil {
+		log.Printf("Failed to render template: %v", err)
+	}
+}
+
+// suggestionLimit is how many category suggestions are shown or returned.
+const suggestionLimit = 3
+
 func AddTransactionHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Only allow POST requests
@@ -74,61 +223,35 @@ func AddTransactionHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFu
 		}
 		log.Printf("Form data received: %+v", r.PostForm)
 
-		transactions, err := repository.GetAllTransactions(db)
-		if err != nil {
-			http.Error(w, "Failed to fetch transactions", http.StatusInternalServerError)
-			return
-		}
+		var req model.AddTransactionRequest
 
-		
-		balance, monthIncome, monthExpense, err := repository.GetSummary(db)
+		err := decoder.Decode(&req, r.PostForm)
 		if err != nil {
-			http.Error(w, "Failed to fetch balance", http.StatusInternalServerError)
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			log.Printf("!!! Failed to decode form data: %v", err)
 			return
 		}
-		limit := 5
-		if len(transactions) < limit {
-			limit = len(transactions)
-		}
-		limitedTransactions := transactions[:limit]
-
-		var TransPopup = false
-		var sourcePopup = false
 
-		if r.URL.Query().Get("show_all_transactions") == "true" {
-			TransPopup = true
-		}
-		var AllSources []model.Account
-		if r.URL.Query().Get("show_all_sources") == "true" {
-			sourcePopup = true
-			sourcesWithBalance, err := repository.GetAllSources(db)
-			if err != nil {
-				http.Error(w, "Failed to fetch source balances", http.StatusInternalServerError)
+		// "Suggest Category" submits the form without adding anything and
+		// shows it again with the category filled in from past transactions.
+		if r.PostForm.Get("action") == "suggest" {
+			response, loadErr := dashboardData(db, r)
+			if loadErr != nil {
+				log.Printf("Failed to load dashboard: %v", loadErr)
+				http.Error(w, "Failed to load dashboard", http.StatusInternalServerError)
 				return
 			}
-			AllSources = sourcesWithBalance
-		}
-
-		sources, err := repository.GetAllSoucesName(db)
-		if err != nil {
-			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
-			return
-		}
-
-
-
-
-		var req model.AddTransactionRequest
-
-		err = decoder.Decode(&req, r.PostForm)
-		if err != nil {
-			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
-			log.Printf("!!! Failed to decode form data: %v", err)
+			amount, _ := strconv.ParseFloat(req.Amount, 64)
+			suggestions := repository.SuggestCategories(req.CategoryName, amount, req.CategoryType, suggestionLimit)
+			if req.Category == "" && len(suggestions.Suggestions) > 0 {
+				req.Category = suggestions.Suggestions[0].Category
+			}
+			response.TransactionForm = req
+			response.CategorySuggestions = suggestions.Suggestions
+			renderDashboard(w, tmpl, response)
 			return
 		}
 
-
-
 		_, err = time.Parse("2006-01-02", req.TransactionDate)
 		if err != nil {
 			log.Printf("Invalid date format: %v", err)
@@ -136,71 +259,42 @@ func AddTransactionHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFu
 			return
 		}
 
+		err = repository.AddTransactions(db, actorFromRequest(r), req)
 
-
-		err = repository.AddTransactions(db, req)
+		var errorKey string
 		if errors.Is(err, repository.ErrNotEnoughBalance) {
 			log.Println("Insufficient balance, re-rendering page with error...")
-
-
-
-			response := model.PageData{
-				Balance:          balance,
-				MonthIncome:      monthIncome,
-				MonthExpense:     monthExpense,
-				Transactions:     limitedTransactions,
-				FormErrors:       make(map[string]string),
-				ShowTransPopup:   TransPopup,
-				AllTransactions:  transactions,
-				AvailableSources: sources,
-				ShowSourcesPopup: sourcePopup,
-				AllSources:       AllSources,
-			}
-
-
-
-
-			response.FormErrors["not_enough_balance"] = err.Error()
-			err = tmpl.ExecuteTemplate(w, "home.html", response)
-			if err != nil {
-				log.Printf("Failed to render template: %v", err)
-			}
-			return
-
-
+			errorKey = "not_enough_balance"
 		} else if errors.Is(err,repository.ErrNegativeAmount) {
 			log.Println("Negative amount, re-rendering page with error...")
-
-
-			response := model.PageData{
-				Balance:          balance,
-				MonthIncome:      monthIncome,
-				MonthExpense:     monthExpense,
-				Transactions:     limitedTransactions,
-				FormErrors:       make(map[string]string),
-				ShowTransPopup:   TransPopup,
-				AllTransactions:  transactions,
-				AvailableSources: sources,
-				ShowSourcesPopup: sourcePopup,
-				AllSources:       AllSources,
-			}
-
-			response.FormErrors["negative_amount"] = err.Error()
-
-
-
-			err = tmpl.ExecuteTemplate(w, "home.html", response)
-			if err != nil {
-				log.Printf("Failed to render template: %v", err)
-			}
-
-			return
+			errorKey = "negative_amount"
+		} else if errors.Is(err, repository.ErrPossibleDuplicate) {
+			errorKey = "possible_duplicate"
 		} else if err != nil {
 			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
 			return
 		}
 
-
+		if errorKey != "" {
+			response, loadErr := dashboardData(db, r)
+			if loadErr != nil {
+				log.Printf("Failed to load dashboard: %v", loadErr)
+				http.Error(w, "Failed to load dashboard", http.StatusInternalServerError)
+				return
+			}
+			response.FormErrors[errorKey] = err.Error()
+			response.TransactionForm = req
+			if errorKey == "possible_duplicate" {
+				response.PossibleDuplicates, err = repository.FindPossibleDuplicates(db, req)
+				if err != nil {
+					log.Printf("Failed to load possible duplicates: %v", err)
+					http.Error(w, "Failed to load dashboard", http.StatusInternalServerError)
+					return
+				}
+			}
+			renderDashboard(w, tmpl, response)
+			return
+		}
 
 		log.Println("Transaction added successfully, redirecting.")
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
@@ -215,75 +309,38 @@ func GetSummaryHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
 			return
 		}
 
-	
-		transactions, err := repository.GetAllTransactions(db)
-		if err != nil {
-			http.Error(w, "Failed to fetch transactions", http.StatusInternalServerError)
-			return
-		}
-
-		
-		balance, monthIncome, monthExpense, err := repository.GetSummary(db)
+		response, err := dashboardData(db, r)
 		if err != nil {
-			http.Error(w, "Failed to fetch balance", http.StatusInternalServerError)
+			log.Printf("Failed to load dashboard: %v", err)
+			http.Error(w, "Failed to load dashboard", http.StatusInternalServerError)
 			return
 		}
-		limit := 5
-		if len(transactions) < limit {
-			limit = len(transactions)
-		}
-		limitedTransactions := transactions[:limit]
 
-
-		var TransPopup = false
-		var sourcePopup = false
-
-		if r.URL.Query().Get("show_all_transactions") == "true" {
-			TransPopup = true
-		}
-		var AllSources []model.Account
-		if r.URL.Query().Get("show_all_sources") == "true" {
-			sourcePopup = true
-			sourcesWithBalance, err := repository.GetAllSources(db)
-			if err != nil {
-				http.Error(w, "Failed to fetch source balances", http.StatusInternalServerError)
-				return
-			}
-			AllSources = sourcesWithBalance
-		}
-
-		sources, err := repository.GetAllSoucesName(db)
-		if err != nil {
-			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
-			return
-		}
-
-		formErrors := make(map[string]string)
+		formErrors := response.FormErrors
 		errorKey := r.URL.Query().Get("error")
 		switch errorKey {
 			case "source_already_exist":
 				formErrors["source_name"] = "This source already exists. Please choose another."
+			case "source_inactive":
+				formErrors["source_name"] = "This source is inactive. Reactivate it from the Sources page."
 			case "negative_balance":
-				formErrors["balance"] = "Initial balance cannot be a negative number."
+				formErrors["balance"] = "Initial balance cannot be negative, or beyond the credit limit for credit cards and loans."
+			case "credit_limit_required":
+				formErrors["credit_limit"] = "Credit cards and loans need a positive credit limit."
+			case "invalid_source_type":
+				formErrors["source_type"] = "Please choose a valid source type."
+			case "delete_not_enough_balance":
+				formErrors["delete"] = "Those transactions were not deleted: taking back their income would leave a source without enough balance."
+			case "delete_source_inactive":
+				formErrors["delete"] = "Those transactions were not deleted: they, or the other leg of their transfer, belong to an inactive source."
 		}
 
-		response := model.PageData{
-			Balance:          balance,
-			MonthIncome:      monthIncome,
-			MonthExpense:     monthExpense,
-			Transactions:     limitedTransactions,
-			FormErrors:       formErrors,
-			ShowTransPopup:   TransPopup,
-			AllTransactions:  transactions,
-			AvailableSources: sources,
-			ShowSourcesPopup: sourcePopup,
-			AllSources:       AllSources,
+		if batch, err := uuid.Parse(r.URL.Query().Get("undo")); err == nil {
+			response.UndoBatch = batch.String()
+			response.UndoCount, _ = strconv.Atoi(r.URL.Query().Get("deleted"))
 		}
 
-		err = tmpl.ExecuteTemplate(w, "home.html", response)
-		if err != nil {
-			log.Printf("Failed to render template: %v", err)
-		}
+		renderDashboard(w, tmpl, response)
 	}
 }
 
@@ -311,6 +368,19 @@ func GetAllSourcesHandler(db *pgx.Conn) http.HandlerFunc {
 	}
 }
 
+// redirectWithUndo sends the user back to the dashboard, which shows an
+// "Undo" banner for the deletion batch.
+func redirectWithUndo(w http.ResponseWriter, r *http.Request, batch uuid.UUID, n int64) {
+	if n == 0 {
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		return
+	}
+	q := url.Values{}
+	q.Set("undo", batch.String())
+	q.Set("deleted", strconv.FormatInt(n, 10))
+	http.Redirect(w, r, "/home?"+q.Encode(), http.StatusSeeOther)
+}
+
 func DeleteTransactionsHandler(db *pgx.Conn) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodPost {
@@ -339,14 +409,20 @@ func DeleteTransactionsHandler(db *pgx.Conn) http.HandlerFunc {
             idsToDelete = append(idsToDelete, id)
         }
 
-        _, err := repository.DeleteTransactionsByIDs(db, idsToDelete)
-        if err != nil {
+        batch, n, err := repository.DeleteTransactionsByIDs(db, actorFromRequest(r), idsToDelete)
+        if errors.Is(err, repository.ErrNotEnoughBalance) {
+            http.Redirect(w, r, "/home?error=delete_not_enough_balance", http.StatusSeeOther)
+            return
+        } else if errors.Is(err, repository.ErrSourceInactive) {
+            http.Redirect(w, r, "/home?error=delete_source_inactive", http.StatusSeeOther)
+            return
+        } else if err != nil {
             log.Printf("Failed to delete transactions: %v", err)
             http.Error(w, "Failed to delete transactions", http.StatusInternalServerError)
             return
         }
 
-        http.Redirect(w, r, "/home?show_all_transactions=true", http.StatusSeeOther)
+        redirectWithUndo(w, r, batch, n)
     }
 }
 func InactiveSoucesHandler(db *pgx.Conn) http.HandlerFunc {
@@ -365,14 +441,14 @@ func InactiveSoucesHandler(db *pgx.Conn) http.HandlerFunc {
             http.Redirect(w, r, "/home?show_all_sources=true", http.StatusSeeOther)
             return
         }
-        _, err := repository.InactiveSources(db, names)
+        batch, n, err := repository.InactiveSources(db, actorFromRequest(r), names)
         if err != nil {
-            log.Printf("Failed to delete transactions: %v", err)
-            http.Error(w, "Failed to delete transactions", http.StatusInternalServerError)
+            log.Printf("Failed to delete sources: %v", err)
+            http.Error(w, "Failed to delete sources", http.StatusInternalServerError)
             return
         }
 
-        http.Redirect(w, r, "/home?show_all_sources=true", http.StatusSeeOther)
+        redirectWithUndo(w, r, batch, n)
     }
 }
 
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"finance-tracker/chart"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// historyDays is the default range of the balance history, in days.
+const historyDays = 90
+
+// Size of the charts' viewBox; they scale to the width of the page.
+const (
+	chartWidth  = 600
+	chartHeight = 220
+)
+
+// historyRange reads the from and to query parameters, defaulting to the last
+// historyDays days.
+func historyRange(r *http.Request) (from, to time.Time, err error) {
+	to = today()
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return from, to, fmt.Errorf("invalid 'to' date: %w", err)
+		}
+	}
+	from = to.AddDate(0, 0, -historyDays)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return from, to, fmt.Errorf("invalid 'from' date: %w", err)
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("'from' is after 'to'")
+	}
+	return from, to, nil
+}
+
+// APIBalanceHistoryHandler returns the daily net worth and the daily balance
+// of every source between the from and to query parameters.
+func APIBalanceHistoryHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		from, to, err := historyRange(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		total, err := repository.GetNetWorthHistory(db, from, to)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch net worth history")
+			return
+		}
+		sources, err := repository.GetSourceBalanceHistory(db, from, to)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch balance history")
+			return
+		}
+		if name := r.URL.Query().Get("source"); name != "" {
+			sources = map[string][]model.BalancePoint{name: sources[name]}
+		}
+		writeJSON(w, http.StatusOK, model.BalanceHistory{From: from, To: to, Total: total, Sources: sources})
+	}
+}
+
+// netWorthChart draws assets, liabilities and net worth over the history.
+func netWorthChart(points []model.NetWorthPoint) template.HTML {
+	assets := chart.Line{Series: chart.Series{Name: "Assets", Color: chart.IncomeColor}}
+	liabilities := chart.Line{Series: chart.Series{Name: "Liabilities", Color: chart.ExpenseColor}}
+	netWorth := chart.Line{Series: chart.Series{Name: "Net Worth", Color: chart.TotalColor}, Width: 3}
+	for _, p := range points {
+		assets.Values = append(assets.Values, p.Assets)
+		liabilities.Values = append(liabilities.Values, p.Liabilities)
+		netWorth.Values = append(netWorth.Values, p.NetWorth)
+	}
+	var first, last string
+	if len(points) > 0 {
+		first = points[0].Date.Format("Jan 2")
+		last = points[len(points)-1].Date.Format("Jan 2")
+	}
+	return chart.Lines("Net worth history", []chart.Line{assets, liabilities, netWorth}, first, last, chartWidth, chartHeight)
+}
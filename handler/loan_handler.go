@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/loan"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var loanErrorMessages = map[string]string{
+	"invalid_terms":      "Principal, term, frequency and start date are required and the rate cannot be negative.",
+	"not_a_loan":         "That source is not a loan, or its terms were not entered yet.",
+	"paid_off":           "This loan is already paid off.",
+	"not_enough_balance": "The paying source doesn't have enough balance.",
+	"invalid_payment":    "Choose an active source other than the loan and a positive amount.",
+}
+
+func loanErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidLoanTerms):
+		return "invalid_terms"
+	case errors.Is(err, repository.ErrNotALoan):
+		return "not_a_loan"
+	case errors.Is(err, repository.ErrLoanPaidOff):
+		return "paid_off"
+	case errors.Is(err, repository.ErrNotEnoughBalance):
+		return "not_enough_balance"
+	case errors.Is(err, repository.ErrSameSource), errors.Is(err, repository.ErrSourceInactive),
+		errors.Is(err, repository.ErrSourceNotFound), errors.Is(err, repository.ErrNegativeAmount):
+		return "invalid_payment"
+	}
+	return ""
+}
+
+// loanView builds the remaining schedule of a loan from its current balance.
+// The what-if schedule is only computed when extra is positive.
+func loanView(db *pgx.Conn, l model.Loan, extra float64) (model.LoanView, error) {
+	view := model.LoanView{Loan: l}
+	if !l.Configured {
+		return view, nil
+	}
+	payments, err := repository.GetLoanPayments(db, l.SourceName)
+	if err != nil {
+		return view, err
+	}
+	view.Payments = payments
+	view.ScheduledPayment = l.ScheduledPayment()
+	view.NextPaymentDate = repository.NextLoanPaymentDate(l, payments)
+	view.Original = loan.Amortize(l.Principal, l.PeriodicRate(), view.ScheduledPayment, 0, l.StartDate, l.Frequency)
+	view.Remaining = loan.Amortize(l.Outstanding(), l.PeriodicRate(), view.ScheduledPayment, 0, view.NextPaymentDate, l.Frequency)
+	if extra > 0 {
+		withExtra := loan.Amortize(l.Outstanding(), l.PeriodicRate(), view.ScheduledPayment, extra, view.NextPaymentDate, l.Frequency)
+		view.Extra = extra
+		view.WithExtra = &withExtra
+		view.InterestSaved = view.Remaining.TotalInterest - withExtra.TotalInterest
+	}
+	return view, nil
+}
+
+// LoansHandler shows every loan with its remaining amortization schedule. The
+// loan and extra query parameters add a what-if schedule for paying extra
+// principal every period on that loan.
+func LoansHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		loans, err := repository.GetLoans(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch loans", http.StatusInternalServerError)
+			return
+		}
+		whatIf := r.URL.Query().Get("loan")
+		extra, _ := strconv.ParseFloat(r.URL.Query().Get("extra"), 64)
+
+		var views []model.LoanView
+		for _, l := range loans {
+			loanExtra := 0.0
+			if l.SourceName == whatIf {
+				loanExtra = extra
+			}
+			view, err := loanView(db, l, loanExtra)
+			if err != nil {
+				http.Error(w, "Failed to compute loan schedule", http.StatusInternalServerError)
+				return
+			}
+			views = append(views, view)
+		}
+
+		sources, err := repository.GetAllSources(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+			return
+		}
+		var paymentSources []string
+		for _, s := range sources {
+			if !s.IsLiability() {
+				paymentSources = append(paymentSources, s.SourceName)
+			}
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := loanErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["loans"] = msg
+		}
+
+		data := model.LoansPageData{
+			Loans:          views,
+			PaymentSources: paymentSources,
+			Frequencies:    loan.Frequencies,
+			FormErrors:     formErrors,
+			CSRFToken:      csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "loans.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func handleLoanMutation(w http.ResponseWriter, r *http.Request, fn func() error) {
+	err := fn()
+	if key := loanErrorKey(err); key != "" {
+		http.Redirect(w, r, "/loans?error="+key, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Printf("An unexpected error occurred: %v", err)
+		http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/loans", http.StatusSeeOther)
+}
+
+func SaveLoanTermsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.LoanTermsRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/loans?error=invalid_terms", http.StatusSeeOther)
+			return
+		}
+		handleLoanMutation(w, r, func() error {
+			return repository.SaveLoanTerms(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+func LoanPaymentHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.LoanPaymentRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		handleLoanMutation(w, r, func() error {
+			_, err := repository.RecordLoanPayment(db, actorFromRequest(r), req)
+			return err
+		})
+	}
+}
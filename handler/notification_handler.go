@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/notify"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// notificationLogSize is how many notifications and delivery attempts the
+// notifications page and API show.
+const notificationLogSize = 50
+
+var notificationErrorMessages = map[string]string{
+	"invalid_recipient":   "A recipient needs a name and a valid email address or http(s) webhook URL.",
+	"duplicate_recipient": "A recipient with that name already exists.",
+	"invalid_event":       "Unknown notification event.",
+	"not_found":           "That recipient or notification no longer exists.",
+}
+
+func notificationErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidRecipient):
+		return "invalid_recipient"
+	case errors.Is(err, repository.ErrDuplicateRecipient):
+		return "duplicate_recipient"
+	case errors.Is(err, repository.ErrInvalidNotificationEvent):
+		return "invalid_event"
+	case errors.Is(err, repository.ErrRecipientNotFound), errors.Is(err, repository.ErrNotificationNotFound):
+		return "not_found"
+	}
+	return ""
+}
+
+// NotificationsHandler shows the recipients with their preferences, the
+// outbox and the delivery log.
+func NotificationsHandler(db *pgx.Conn, tmpl *template.Template, dispatcher *notify.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		recipients, err := repository.GetRecipients(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch recipients", http.StatusInternalServerError)
+			return
+		}
+		notifications, err := repository.GetNotifications(db, notificationLogSize)
+		if err != nil {
+			http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+			return
+		}
+		deliveries, err := repository.GetNotificationDeliveries(db, notificationLogSize)
+		if err != nil {
+			http.Error(w, "Failed to fetch notifications", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := notificationErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["notifications"] = msg
+		}
+		tested, _ := strconv.Atoi(r.URL.Query().Get("tested"))
+
+		data := model.NotificationsPageData{
+			Recipients:    recipients,
+			Notifications: notifications,
+			Deliveries:    deliveries,
+			Events:        model.NotificationEvents,
+			Channels:      dispatcher.Channels(),
+			TestQueued:    tested,
+			FormErrors:    formErrors,
+			CSRFToken:     csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "notifications.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func AddRecipientHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.AddRecipientRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/notifications?error=invalid_recipient", http.StatusSeeOther)
+			return
+		}
+
+		_, err := repository.AddRecipient(db, actorFromRequest(r), req)
+		if key := notificationErrorKey(err); key != "" {
+			http.Redirect(w, r, "/notifications?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+// RecipientPreferencesHandler saves which events a recipient gets over each
+// channel.
+func RecipientPreferencesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.RecipientPreferencesRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/notifications?error=invalid_event", http.StatusSeeOther)
+			return
+		}
+
+		err := repository.UpdateRecipientPreferences(db, actorFromRequest(r), req)
+		if key := notificationErrorKey(err); key != "" {
+			http.Redirect(w, r, "/notifications?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+func DeleteRecipientHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(r.PostFormValue("recipient_id"))
+		if err != nil {
+			http.Redirect(w, r, "/notifications?error=not_found", http.StatusSeeOther)
+			return
+		}
+
+		err = repository.DeleteRecipient(db, actorFromRequest(r), id)
+		if key := notificationErrorKey(err); key != "" {
+			http.Redirect(w, r, "/notifications?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+// TestNotificationHandler queues a test message to every address of a
+// recipient and delivers it right away, so the result shows up in the
+// delivery log.
+func TestNotificationHandler(db *pgx.Conn, dispatcher *notify.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(r.PostFormValue("recipient_id"))
+		if err != nil {
+			http.Redirect(w, r, "/notifications?error=not_found", http.StatusSeeOther)
+			return
+		}
+
+		n, err := repository.QueueTestNotification(db, id)
+		if key := notificationErrorKey(err); key != "" {
+			http.Redirect(w, r, "/notifications?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		if _, _, err := repository.DeliverNotifications(db, dispatcher); err != nil {
+			log.Printf("Failed to deliver notifications: %v", err)
+		}
+		http.Redirect(w, r, "/notifications?tested="+strconv.FormatInt(n, 10), http.StatusSeeOther)
+	}
+}
+
+// RetryNotificationHandler puts a failed notification back in the outbox.
+func RetryNotificationHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(r.PostFormValue("notification_id"))
+		if err != nil {
+			http.Redirect(w, r, "/notifications?error=not_found", http.StatusSeeOther)
+			return
+		}
+
+		err = repository.RetryNotification(db, actorFromRequest(r), id)
+		if key := notificationErrorKey(err); key != "" {
+			http.Redirect(w, r, "/notifications?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+// APINotificationsHandler serves GET /api/notifications: the newest
+// notifications with their status, and the newest delivery attempts.
+func APINotificationsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		notifications, err := repository.GetNotifications(db, notificationLogSize)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch notifications")
+			return
+		}
+		deliveries, err := repository.GetNotificationDeliveries(db, notificationLogSize)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch notifications")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"notifications": notifications,
+			"deliveries":    deliveries,
+		})
+	}
+}
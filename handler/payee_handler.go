@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var payeeErrorMessages = map[string]string{
+	"invalid_payee":   "A payee needs a name with at least one letter or digit.",
+	"duplicate_payee": "A payee with that name already exists.",
+	"invalid_alias":   "An alias needs at least one letter or digit.",
+	"invalid_merge":   "Select at least two payees and choose the one to keep.",
+	"not_found":       "That payee no longer exists.",
+}
+
+func payeeErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidPayee):
+		return "invalid_payee"
+	case errors.Is(err, repository.ErrDuplicatePayee):
+		return "duplicate_payee"
+	case errors.Is(err, repository.ErrInvalidAlias):
+		return "invalid_alias"
+	case errors.Is(err, repository.ErrInvalidPayeeMerge):
+		return "invalid_merge"
+	case errors.Is(err, repository.ErrPayeeNotFound):
+		return "not_found"
+	}
+	return ""
+}
+
+func PayeesHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		payees, err := repository.GetPayees(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch payees", http.StatusInternalServerError)
+			return
+		}
+		unassigned, err := repository.CountUnassignedTransactions(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch payees", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := payeeErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["payees"] = msg
+		}
+		matched, err := strconv.Atoi(r.URL.Query().Get("matched"))
+
+		data := model.PayeesPageData{
+			Payees:      payees,
+			Unassigned:  unassigned,
+			Matched:     matched,
+			ShowMatched: err == nil,
+			FormErrors:  formErrors,
+			CSRFToken:   csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "payees.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func CreatePayeeHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CreatePayeeRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/payees?error=invalid_payee", http.StatusSeeOther)
+			return
+		}
+
+		_, err := repository.CreatePayee(db, actorFromRequest(r), req)
+		if key := payeeErrorKey(err); key != "" {
+			http.Redirect(w, r, "/payees?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/payees", http.StatusSeeOther)
+	}
+}
+
+// MatchPayeesHandler gives the transactions without a payee the payee their
+// name maps to.
+func MatchPayeesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := repository.MatchUnassignedTransactions(db, actorFromRequest(r))
+		if err != nil {
+			log.Printf("Failed to match payees: %v", err)
+			http.Error(w, "Failed to match payees", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/payees?matched="+strconv.FormatInt(n, 10), http.StatusSeeOther)
+	}
+}
+
+func MergePayeesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.MergePayeesRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/payees?error=invalid_merge", http.StatusSeeOther)
+			return
+		}
+		keep, err := uuid.Parse(req.Keep)
+		if err != nil {
+			http.Redirect(w, r, "/payees?error=invalid_merge", http.StatusSeeOther)
+			return
+		}
+		var ids []uuid.UUID
+		for _, idStr := range req.PayeeIDs {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid payee ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		_, err = repository.MergePayees(db, actorFromRequest(r), keep, ids)
+		if key := payeeErrorKey(err); key != "" {
+			http.Redirect(w, r, "/payees?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("Failed to merge payees: %v", err)
+			http.Error(w, "Failed to merge payees", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/payees/view?id="+keep.String(), http.StatusSeeOther)
+	}
+}
+
+// PayeeHandler shows a payee with its aliases, monthly history over the last
+// twelve months and transactions.
+func PayeeHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := uuid.Parse(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+			return
+		}
+
+		p, aliases, err := repository.GetPayee(db, id)
+		if errors.Is(err, repository.ErrPayeeNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch payee", http.StatusInternalServerError)
+			return
+		}
+		from, to, err := reportRange(model.ReportFilter{})
+		if err != nil {
+			http.Error(w, "Invalid date range", http.StatusBadRequest)
+			return
+		}
+		months, err := repository.GetPayeeMonths(db, id, from, to)
+		if err != nil {
+			http.Error(w, "Failed to fetch payee history", http.StatusInternalServerError)
+			return
+		}
+		transactions, err := repository.GetTransactions(db, model.TransactionFilter{Payee: id.String()})
+		if err != nil {
+			http.Error(w, "Failed to fetch transactions", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := payeeErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["payee"] = msg
+		}
+		data := model.PayeePageData{
+			Payee:        p,
+			Aliases:      aliases,
+			Months:       months,
+			MonthlyChart: monthlyChart(months),
+			Transactions: transactions,
+			FormErrors:   formErrors,
+			CSRFToken:    csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "payee.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// redirectToPayee sends the browser back to a payee's page, with an error
+// message if key is not empty.
+func redirectToPayee(w http.ResponseWriter, r *http.Request, id uuid.UUID, key string) {
+	q := url.Values{"id": {id.String()}}
+	if key != "" {
+		q.Set("error", key)
+	}
+	http.Redirect(w, r, "/payees/view?"+q.Encode(), http.StatusSeeOther)
+}
+
+func UpdatePayeeHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.UpdatePayeeRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.PayeeID)
+		if err != nil {
+			http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+			return
+		}
+
+		err = repository.UpdatePayee(db, actorFromRequest(r), id, req.Name, req.DefaultCategory)
+		if errors.Is(err, repository.ErrPayeeNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if key := payeeErrorKey(err); key != "" {
+			redirectToPayee(w, r, id, key)
+			return
+		} else if err != nil {
+			log.Printf("Failed to update payee: %v", err)
+			http.Error(w, "Failed to update payee", http.StatusInternalServerError)
+			return
+		}
+		redirectToPayee(w, r, id, "")
+	}
+}
+
+func AddPayeeAliasHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.PayeeAliasRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.PayeeID)
+		if err != nil {
+			http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+			return
+		}
+
+		_, err = repository.AddPayeeAlias(db, actorFromRequest(r), id, req.Alias)
+		if errors.Is(err, repository.ErrPayeeNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if key := payeeErrorKey(err); key != "" {
+			redirectToPayee(w, r, id, key)
+			return
+		} else if err != nil {
+			log.Printf("Failed to add payee alias: %v", err)
+			http.Error(w, "Failed to add payee alias", http.StatusInternalServerError)
+			return
+		}
+		redirectToPayee(w, r, id, "")
+	}
+}
+
+func DeletePayeeAliasHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.PayeeAliasRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.PayeeID)
+		if err != nil {
+			http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.DeletePayeeAlias(db, actorFromRequest(r), req.Alias); err != nil {
+			log.Printf("Failed to delete payee alias: %v", err)
+			http.Error(w, "Failed to delete payee alias", http.StatusInternalServerError)
+			return
+		}
+		redirectToPayee(w, r, id, "")
+	}
+}
+
+// AssignPayeeHandler moves a transaction to another payee from its details
+// page. The name it was entered with is learned as an alias of that payee.
+func AssignPayeeHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.AssignPayeeRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.TransactionID)
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+		var payeeID uuid.UUID
+		if req.NewPayee == "" {
+			if payeeID, err = uuid.Parse(req.PayeeID); err != nil {
+				http.Error(w, "Invalid payee ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = repository.AssignTransactionPayee(db, actorFromRequest(r), id, payeeID, req.NewPayee)
+		if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if key := payeeErrorKey(err); key != "" {
+			q := url.Values{"id": {id.String()}, "error": {key}}
+			http.Redirect(w, r, "/transactions/details?"+q.Encode(), http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("Failed to assign payee: %v", err)
+			http.Error(w, "Failed to assign payee", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/transactions/details?id="+id.String(), http.StatusSeeOther)
+	}
+}
+
+// APIPayeesHandler serves GET /api/payees: every payee with its totals.
+func APIPayeesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		payees, err := repository.GetPayees(db)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to fetch payees")
+			return
+		}
+		writeJSON(w, http.StatusOK, payees)
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"finance-tracker/chart"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// reportTopNames is how many names the top spend list shows.
+const reportTopNames = 10
+
+// reportRange reads the report date range, defaulting to the last twelve
+// months including the current one.
+func reportRange(f model.ReportFilter) (from, to time.Time, err error) {
+	now := time.Now()
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if f.To != "" {
+		if to, err = time.Parse("2006-01-02", f.To); err != nil {
+			return from, to, fmt.Errorf("invalid 'to' date: %w", err)
+		}
+	}
+	from = time.Date(to.Year(), to.Month()-11, 1, 0, 0, 0, 0, time.UTC)
+	if f.From != "" {
+		if from, err = time.Parse("2006-01-02", f.From); err != nil {
+			return from, to, fmt.Errorf("invalid 'from' date: %w", err)
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("'from' is after 'to'")
+	}
+	return from, to, nil
+}
+
+// categoryChart draws the expense categories as a donut. Categories beyond
+// the palette are combined into "Other".
+func categoryChart(categories []model.CategoryTotal) template.HTML {
+	var slices []chart.Slice
+	for _, c := range categories {
+		if c.CategoryType != "EXPENSE" {
+			continue
+		}
+		if len(slices) == len(chart.Palette)-1 {
+			slices = append(slices, chart.Slice{Label: "Other"})
+		}
+		if len(slices) == len(chart.Palette) {
+			slices[len(slices)-1].Value += c.Total
+			continue
+		}
+		slices = append(slices, chart.Slice{Label: c.Category, Value: c.Total})
+	}
+	return chart.Donut("Expense by category", slices, chartWidth, chartHeight)
+}
+
+// monthlyChart draws income next to expense for every month.
+func monthlyChart(months []model.PeriodTotal) template.HTML {
+	series := []chart.Series{{Name: "Income", Color: chart.IncomeColor}, {Name: "Expense", Color: chart.ExpenseColor}}
+	groups := make([]chart.BarGroup, len(months))
+	for i, m := range months {
+		groups[i] = chart.BarGroup{Label: m.Period.Format("Jan 06"), Values: []float64{m.Income, m.Expense}}
+	}
+	return chart.Bars("Income and expense by month", series, groups, chartWidth, chartHeight)
+}
+
+func ReportsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var f model.ReportFilter
+		if err := decoder.Decode(&f, r.URL.Query()); err != nil {
+			http.Error(w, "Invalid filter", http.StatusBadRequest)
+			return
+		}
+		from, to, err := reportRange(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := repository.GetReport(db, from, to, reportTopNames)
+		if err != nil {
+			http.Error(w, "Failed to build report", http.StatusInternalServerError)
+			return
+		}
+
+		f.From, f.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+		data := model.ReportsPageData{
+			Report:        report,
+			Filter:        f,
+			CategoryChart: categoryChart(report.Categories),
+			MonthlyChart:  monthlyChart(report.Months),
+			CSRFToken:     csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "reports.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func APIReportHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var f model.ReportFilter
+		if err := decoder.Decode(&f, r.URL.Query()); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid filter")
+			return
+		}
+		from, to, err := reportRange(f)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		report, err := repository.GetReport(db, from, to, reportTopNames)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to build report")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ruleErrorMessages = map[string]string{
+	"invalid_rule":  "A rule needs a name, at least one condition and at least one action.",
+	"invalid_regex": "The regular expression is invalid.",
+	"duplicate":     "A rule with that name already exists.",
+	"not_found":     "That source does not exist.",
+	"invalid_range": "Choose a valid date range.",
+}
+
+func ruleErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInvalidRule):
+		return "invalid_rule"
+	case errors.Is(err, repository.ErrInvalidRuleRegex):
+		return "invalid_regex"
+	case errors.Is(err, repository.ErrDuplicateRule):
+		return "duplicate"
+	case errors.Is(err, repository.ErrSourceNotFound):
+		return "not_found"
+	}
+	return ""
+}
+
+func RulesHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rules, err := repository.GetRules(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch rules", http.StatusInternalServerError)
+			return
+		}
+		sources, err := repository.GetAllSoucesName(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := ruleErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["rules"] = msg
+		}
+		applied, err := strconv.Atoi(r.URL.Query().Get("applied"))
+
+		data := model.RulesPageData{
+			Rules:            rules,
+			AvailableSources: sources,
+			FormErrors:       formErrors,
+			Applied:          applied,
+			ShowApplied:      err == nil,
+			CSRFToken:        csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "rules.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func CreateRuleHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CreateRuleRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/rules?error=invalid_rule", http.StatusSeeOther)
+			return
+		}
+
+		err := repository.CreateRule(db, actorFromRequest(r), req)
+		if key := ruleErrorKey(err); key != "" {
+			http.Redirect(w, r, "/rules?error="+key, http.StatusSeeOther)
+			return
+		} else if err != nil {
+			log.Printf("An unexpected error occurred: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/rules", http.StatusSeeOther)
+	}
+}
+
+// UpdateRulesHandler enables, disables or deletes the selected rules,
+// depending on the submitted action.
+func UpdateRulesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["rule_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid rule ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			http.Redirect(w, r, "/rules", http.StatusSeeOther)
+			return
+		}
+
+		var err error
+		actor := actorFromRequest(r)
+		switch r.PostFormValue("action") {
+		case "enable":
+			_, err = repository.SetRulesEnabled(db, actor, ids, true)
+		case "disable":
+			_, err = repository.SetRulesEnabled(db, actor, ids, false)
+		case "delete":
+			_, err = repository.DeleteRules(db, actor, ids)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to update rules: %v", err)
+			http.Error(w, "Failed to update rules", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/rules", http.StatusSeeOther)
+	}
+}
+
+func ApplyRulesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.ApplyRulesRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Redirect(w, r, "/rules?error=invalid_range", http.StatusSeeOther)
+			return
+		}
+		from, errFrom := time.Parse("2006-01-02", req.From)
+		to, errTo := time.Parse("2006-01-02", req.To)
+		if errFrom != nil || errTo != nil || from.After(to) {
+			http.Redirect(w, r, "/rules?error=invalid_range", http.StatusSeeOther)
+			return
+		}
+
+		n, err := repository.ApplyRulesToRange(db, actorFromRequest(r), from, to)
+		if err != nil {
+			log.Printf("Failed to apply rules: %v", err)
+			http.Error(w, "Failed to apply rules", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/rules?applied="+strconv.FormatInt(n, 10), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+
+	// maxFormMemory is how much of a multipart form is held in memory;
+	// larger uploads are buffered in temporary files.
+	maxFormMemory = 8 << 20
+)
+
+// contentSecurityPolicy only allows what the templates actually load: inline
+// styles and the Google Fonts stylesheet and font files. The pages are fully
+// server-rendered, so no script is allowed at all.
+var contentSecurityPolicy = strings.Join([]string{
+	"default-src 'none'",
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com",
+	"font-src https://fonts.gstatic.com",
+	"img-src 'self' data:",
+	"script-src 'none'",
+	"form-action 'self'",
+	"frame-ancestors 'none'",
+	"base-uri 'none'",
+}, "; ")
+
+type csrfContextKey struct{}
+
+// secureCookies reports whether cookies should carry the Secure flag. It is
+// enabled with COOKIE_SECURE=true when the app is served over HTTPS.
+func secureCookies() bool {
+	return os.Getenv("COOKIE_SECURE") == "true"
+}
+
+// csrfToken returns the token that forms rendered for this request must embed.
+func csrfToken(r *http.Request) string {
+	t, _ := r.Context().Value(csrfContextKey{}).(string)
+	return t
+}
+
+func newCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFProtect implements the double-submit cookie pattern. Every visitor gets a
+// random token in a SameSite cookie, templates embed the same token as a hidden
+// form field, and state-changing requests are rejected unless both match.
+//
+// Bearer-token requests to routes registered with HandleToken are exempt:
+// browsers never attach an Authorization header to a cross-site form post, and
+// RequireToken refuses them unless the token is valid. Anywhere else a bearer
+// header changes nothing, as those handlers never look at it.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearerToken(r) != "" && tokenRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+			token = c.Value
+		} else {
+			token, err = newCSRFToken()
+			if err != nil {
+				log.Printf("Failed to generate csrf token: %v", err)
+				http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   secureCookies(),
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		if !isSafeMethod(r.Method) {
+			submitted := r.Header.Get(csrfHeaderName)
+			if submitted == "" {
+				err := r.ParseMultipartForm(maxFormMemory)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				submitted = r.PostFormValue(csrfFieldName)
+			}
+			if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				log.Printf("Rejected %s %s: missing or invalid csrf token", r.Method, r.URL.Path)
+				http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// MaxBodySize caps the size of request bodies at n bytes, so that an
+// oversized upload is cut off while it is read instead of being buffered in
+// full first.
+func MaxBodySize(n int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSecret protects pages with HTTP basic authentication: the password
+// must be secret, the user name is ignored. An empty secret lets every request
+// through.
+func RequireSecret(secret string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if secret != "" {
+			_, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(secret)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="finance-tracker", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// SecureHeaders sets the security headers sent with every response.
+func SecureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "same-origin")
+		if secureCookies() {
+			h.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
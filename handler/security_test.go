@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfRequest builds a request to path with the csrf cookie set to cookie and
+// the form field set to field; empty values are left out.
+func csrfRequest(method, path, cookie, field string) *http.Request {
+	form := url.Values{}
+	if field != "" {
+		form.Set(csrfFieldName, field)
+	}
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookie})
+	}
+	return r
+}
+
+func TestCSRFProtect(t *testing.T) {
+	tokenRoutes["/api/csrf-test"] = true
+	defer delete(tokenRoutes, "/api/csrf-test")
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		bearer string
+		want   int
+	}{
+		{"get without token", csrfRequest(http.MethodGet, "/home", "", ""), "", http.StatusOK},
+		{"post without token", csrfRequest(http.MethodPost, "/AddTransaction", "", ""), "", http.StatusForbidden},
+		{"post without form token", csrfRequest(http.MethodPost, "/AddTransaction", "cookie-token", ""), "", http.StatusForbidden},
+		{"post with mismatched token", csrfRequest(http.MethodPost, "/AddTransaction", "cookie-token", "forged-token"), "", http.StatusForbidden},
+		{"post with matching token", csrfRequest(http.MethodPost, "/AddTransaction", "cookie-token", "cookie-token"), "", http.StatusOK},
+		{"bearer on token route", csrfRequest(http.MethodPost, "/api/csrf-test", "", ""), "ft_anything", http.StatusOK},
+		{"bearer on form route", csrfRequest(http.MethodPost, "/delete-sources", "", ""), "ft_anything", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.bearer != "" {
+				tt.req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, tt.req)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFProtectHeaderToken(t *testing.T) {
+	r := csrfRequest(http.MethodPost, "/AddTransaction", "cookie-token", "")
+	r.Header.Set(csrfHeaderName, "cookie-token")
+	w := httptest.NewRecorder()
+	CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := csrfToken(r); got != "cookie-token" {
+			t.Errorf("csrfToken = %q, want the cookie token", got)
+		}
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestCSRFProtectSetsCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/home", nil))
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value == "" {
+		t.Fatalf("got cookies %v, want one %s cookie", cookies, csrfCookieName)
+	}
+	if c := cookies[0]; !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("cookie is not HttpOnly and SameSite=Strict: %v", c)
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var sourceErrorMessages = map[string]string{
+	"source_already_exist": "A source with that name already exists.",
+	"empty_name":           "The new name cant be empty.",
+	"not_found":            "That source does not exist.",
+	"transfer_required":    "Choose a source to move the remaining balance to before closing.",
+	"same_source":          "The balance cant be transferred to the source being closed.",
+	"inactive":             "The source is inactive.",
+	"not_enough_balance":   "The transfer source doesn't have enough balance to settle this source.",
+	"invalid_threshold":    "The low-balance threshold must be a number of zero or more.",
+}
+
+// sourceErrorKey maps repository errors to the error keys understood by the
+// sources page.
+func sourceErrorKey(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrDuplicateSource):
+		return "source_already_exist"
+	case errors.Is(err, repository.ErrEmptySourceName):
+		return "empty_name"
+	case errors.Is(err, repository.ErrSourceNotFound):
+		return "not_found"
+	case errors.Is(err, repository.ErrTransferTargetRequired):
+		return "transfer_required"
+	case errors.Is(err, repository.ErrSameSource):
+		return "same_source"
+	case errors.Is(err, repository.ErrSourceInactive):
+		return "inactive"
+	case errors.Is(err, repository.ErrNotEnoughBalance):
+		return "not_enough_balance"
+	case errors.Is(err, repository.ErrInvalidThreshold):
+		return "invalid_threshold"
+	}
+	return ""
+}
+
+func SourcesHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		active, err := repository.GetAllSources(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch sources", http.StatusInternalServerError)
+			return
+		}
+		inactive, err := repository.GetInactiveSources(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch inactive sources", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := sourceErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["sources"] = msg
+		}
+
+		data := model.SourcesPageData{
+			ActiveSources:   active,
+			InactiveSources: inactive,
+			FormErrors:      formErrors,
+			CSRFToken:       csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "sources.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// handleSourceMutation parses the form, runs fn and redirects back to the
+// sources page, with an error key if fn failed in an expected way.
+func handleSourceMutation(w http.ResponseWriter, r *http.Request, fn func() error) {
+	err := fn()
+	if key := sourceErrorKey(err); key != "" {
+		http.Redirect(w, r, "/sources?error="+key, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		log.Printf("An unexpected error occurred: %v", err)
+		http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/sources", http.StatusSeeOther)
+}
+
+func ReactivateSourcesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		handleSourceMutation(w, r, func() error {
+			_, err := repository.ReactivateSources(db, actorFromRequest(r), r.PostForm["source_name"])
+			return err
+		})
+	}
+}
+
+func RenameSourceHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.RenameSourceRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		handleSourceMutation(w, r, func() error {
+			return repository.RenameSource(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+func CloseSourceHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.CloseSourceRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		handleSourceMutation(w, r, func() error {
+			return repository.CloseSource(db, actorFromRequest(r), req)
+		})
+	}
+}
+
+// SetThresholdHandler sets or clears the low-balance threshold of a source.
+func SetThresholdHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.ThresholdRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		handleSourceMutation(w, r, func() error {
+			return repository.SetLowBalanceThreshold(db, actorFromRequest(r), req)
+		})
+	}
+}
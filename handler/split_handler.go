@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var splitErrorMessages = map[string]string{
+	"invalid_split": "Every line needs a category and a positive amount, and there must be at least two lines adding up to the transaction amount.",
+}
+
+// splitBlankLines is how many empty lines the split form offers for new
+// categories.
+const splitBlankLines = 2
+
+// SplitHandler shows the split lines of a transaction for editing.
+func SplitHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := uuid.Parse(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		t, err := repository.GetTransaction(db, id)
+		if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch transaction", http.StatusInternalServerError)
+			return
+		}
+
+		lines := t.Splits
+		if len(lines) == 0 {
+			// Start from the whole amount in the current category.
+			lines = []model.Split{{Category: t.Category, Amount: t.Amount}}
+		}
+		for i := 0; i < splitBlankLines; i++ {
+			lines = append(lines, model.Split{})
+		}
+
+		formErrors := make(map[string]string)
+		if msg, ok := splitErrorMessages[r.URL.Query().Get("error")]; ok {
+			formErrors["splits"] = msg
+		}
+		data := model.SplitPageData{
+			Transaction: t,
+			Lines:       lines,
+			FormErrors:  formErrors,
+			CSRFToken:   csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "split.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// SaveSplitsHandler replaces the split lines of a transaction, or removes
+// them all when action is "remove".
+func SaveSplitsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		var req model.SaveSplitsRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+		id, err := uuid.Parse(req.TransactionID)
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+		back := "/transactions/split?" + url.Values{"id": {id.String()}}.Encode()
+
+		var lines []model.SplitLine
+		if r.PostFormValue("action") != "remove" {
+			for i, category := range req.Categories {
+				var amount string
+				if i < len(req.Amounts) {
+					amount = strings.TrimSpace(req.Amounts[i])
+				}
+				if strings.TrimSpace(category) == "" && amount == "" {
+					continue
+				}
+				v, err := strconv.ParseFloat(amount, 64)
+				if err != nil {
+					http.Redirect(w, r, back+"&error=invalid_split", http.StatusSeeOther)
+					return
+				}
+				lines = append(lines, model.SplitLine{Category: category, Amount: v})
+			}
+		}
+
+		err = repository.SaveSplits(db, actorFromRequest(r), id, lines)
+		if errors.Is(err, repository.ErrInvalidSplit) {
+			http.Redirect(w, r, back+"&error=invalid_split", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, repository.ErrTransactionNotFound) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("Failed to save splits: %v", err)
+			http.Error(w, "Failed to save splits", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/home?show_all_transactions=true", http.StatusSeeOther)
+	}
+}
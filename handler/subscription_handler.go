@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func SubscriptionsHandler(db *pgx.Conn, tmpl *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		subscriptions, err := repository.GetSubscriptions(db, today())
+		if err != nil {
+			http.Error(w, "Failed to detect subscriptions", http.StatusInternalServerError)
+			return
+		}
+		data := model.SubscriptionsPageData{Subscriptions: subscriptions}
+		for _, s := range subscriptions {
+			if s.Status != model.SubscriptionEnded {
+				data.AnnualCost += s.AnnualCost
+			}
+			if s.Status == model.SubscriptionMissed {
+				data.Missed++
+			}
+		}
+		err = tmpl.ExecuteTemplate(w, "subscriptions.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+// APISubscriptionsHandler serves GET /api/subscriptions: the detected
+// subscriptions, with missed ones first.
+func APISubscriptionsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		subscriptions, err := repository.GetSubscriptions(db, today())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to detect subscriptions")
+			return
+		}
+		writeJSON(w, http.StatusOK, subscriptions)
+	}
+}
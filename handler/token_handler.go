@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func renderTokensPage(w http.ResponseWriter, r *http.Request, db *pgx.Conn, tmpl *template.Template, allowAdmin bool, data model.TokensPageData) {
+	tokens, err := repository.GetAllAPITokens(db)
+	if err != nil {
+		http.Error(w, "Failed to fetch tokens", http.StatusInternalServerError)
+		return
+	}
+	data.Tokens = tokens
+	data.AllowAdmin = allowAdmin
+	data.CSRFToken = csrfToken(r)
+	if data.FormErrors == nil {
+		data.FormErrors = make(map[string]string)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "tokens.html", data)
+	if err != nil {
+		log.Printf("Failed to render template: %v", err)
+	}
+}
+
+// TokensHandler serves the tokens page. Unless allowAdmin is set the page is
+// not protected by ADMIN_SECRET, so it can't create admin tokens.
+func TokensHandler(db *pgx.Conn, tmpl *template.Template, allowAdmin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		renderTokensPage(w, r, db, tmpl, allowAdmin, model.TokensPageData{})
+	}
+}
+
+func CreateTokenHandler(db *pgx.Conn, tmpl *template.Template, allowAdmin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var req model.CreateTokenRequest
+		if err := decoder.Decode(&req, r.PostForm); err != nil {
+			log.Printf("!!! Failed to decode form data: %v", err)
+			http.Error(w, "Failed to decode form data", http.StatusBadRequest)
+			return
+		}
+
+		data := model.TokensPageData{FormErrors: make(map[string]string)}
+		if !allowAdmin && slices.Contains(req.Scopes, model.ScopeAdmin) {
+			data.FormErrors["scopes"] = "Admin tokens can only be created when ADMIN_SECRET is set."
+			renderTokensPage(w, r, db, tmpl, allowAdmin, data)
+			return
+		}
+		plaintext, _, err := repository.CreateAPIToken(db, req)
+		if errors.Is(err, repository.ErrEmptyTokenName) {
+			data.FormErrors["name"] = "Please give the token a name."
+		} else if errors.Is(err, repository.ErrInvalidScope) {
+			data.FormErrors["scopes"] = "Please choose at least one valid scope."
+		} else if err != nil {
+			log.Printf("Failed to create token: %v", err)
+			http.Error(w, "An internal server error occurred", http.StatusInternalServerError)
+			return
+		}
+
+		// The plaintext is only shown on this response, never again.
+		data.NewToken = plaintext
+		w.Header().Set("Cache-Control", "no-store")
+		renderTokensPage(w, r, db, tmpl, allowAdmin, data)
+	}
+}
+
+func RevokeTokensHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["token_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid token ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+			return
+		}
+
+		if _, err := repository.RevokeAPITokens(db, ids); err != nil {
+			log.Printf("Failed to revoke tokens: %v", err)
+			http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+	}
+}
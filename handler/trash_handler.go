@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/repository"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// restoreErrorRedirect sends the user back to the trash with a message for
+// the errors a restore is expected to produce.
+func restoreErrorRedirect(w http.ResponseWriter, r *http.Request, target string, err error) bool {
+	if errors.Is(err, repository.ErrNotEnoughBalance) {
+		http.Redirect(w, r, target+"?error=not_enough_balance", http.StatusSeeOther)
+		return true
+	} else if errors.Is(err, repository.ErrSourceInTrash) {
+		http.Redirect(w, r, target+"?error=source_in_trash", http.StatusSeeOther)
+		return true
+	} else if err != nil {
+		log.Printf("Failed to restore from trash: %v", err)
+		http.Error(w, "Failed to restore from trash", http.StatusInternalServerError)
+		return true
+	}
+	return false
+}
+
+func TrashHandler(db *pgx.Conn, tmpl *template.Template, retentionDays int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		transactions, err := repository.GetDeletedTransactions(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch deleted transactions", http.StatusInternalServerError)
+			return
+		}
+		sources, err := repository.GetDeletedSources(db)
+		if err != nil {
+			http.Error(w, "Failed to fetch deleted sources", http.StatusInternalServerError)
+			return
+		}
+
+		formErrors := make(map[string]string)
+		switch r.URL.Query().Get("error") {
+		case "not_enough_balance":
+			formErrors["restore"] = "A source doesn't have enough balance to restore the selected expenses."
+		case "source_in_trash":
+			formErrors["restore"] = "Restore the source of these transactions first."
+		}
+
+		data := model.TrashPageData{
+			Transactions:  transactions,
+			Sources:       sources,
+			RetentionDays: retentionDays,
+			FormErrors:    formErrors,
+			CSRFToken:     csrfToken(r),
+		}
+		err = tmpl.ExecuteTemplate(w, "trash.html", data)
+		if err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+	}
+}
+
+func RestoreTransactionsHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, idStr := range r.PostForm["trans_id"] {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "Invalid transaction ID found", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			_, err := repository.RestoreTransactions(db, actorFromRequest(r), ids)
+			if restoreErrorRedirect(w, r, "/trash", err) {
+				return
+			}
+		}
+		http.Redirect(w, r, "/trash", http.StatusSeeOther)
+	}
+}
+
+func RestoreSourcesHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		names := r.PostForm["source_name"]
+		if len(names) > 0 {
+			_, err := repository.RestoreSources(db, actorFromRequest(r), names)
+			if restoreErrorRedirect(w, r, "/trash", err) {
+				return
+			}
+		}
+		http.Redirect(w, r, "/trash", http.StatusSeeOther)
+	}
+}
+
+// UndoDeleteHandler restores everything removed by one bulk deletion.
+func UndoDeleteHandler(db *pgx.Conn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		batch, err := uuid.Parse(r.PostForm.Get("batch_id"))
+		if err != nil {
+			http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+			return
+		}
+		_, err = repository.RestoreBatch(db, actorFromRequest(r), batch)
+		if restoreErrorRedirect(w, r, "/trash", err) {
+			return
+		}
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+	}
+}
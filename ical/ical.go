@@ -0,0 +1,138 @@
+// Package ical writes upcoming bills as an iCalendar (RFC 5545) feed that
+// calendar apps can subscribe to. Bills that repeat on a schedule iCalendar
+// can express become one event with an RRULE; everything else becomes one
+// all-day event per due date.
+package ical
+
+import (
+	"bufio"
+	"finance-tracker/model"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line RFC 5545 allows before folding.
+const maxLineOctets = 75
+
+// RRule returns the recurrence rule of a bill repeating at frequency, one of
+// the recurring transaction frequencies or subscription cadences, on a
+// schedule counted from start. It reports false for schedules it doesn't
+// know, whose bills are written one event per due date.
+func RRule(frequency string, start time.Time) (string, bool) {
+	// Weekly, monthly and yearly are spelled the same for both.
+	switch frequency {
+	case model.RecurWeekly:
+		return "FREQ=WEEKLY", true
+	case model.RecurBiweekly, model.CadenceBiweekly:
+		return "FREQ=WEEKLY;INTERVAL=2", true
+	case model.RecurMonthly:
+		return "FREQ=MONTHLY" + monthEnd(start.Day()), true
+	case model.CadenceQuarterly:
+		return "FREQ=MONTHLY;INTERVAL=3" + monthEnd(start.Day()), true
+	case model.RecurYearly:
+		if start.Month() == time.February {
+			return "FREQ=YEARLY;BYMONTH=2" + monthEnd(start.Day()), true
+		}
+		return "FREQ=YEARLY", true
+	}
+	return "", false
+}
+
+// monthEnd returns the rule parts for a schedule on the given day of the
+// month. A bill due after the 28th falls on the last day of shorter months,
+// which an RRULE spells as the last of the days from the 28th on that the
+// month has; a plain RRULE would skip those months instead.
+func monthEnd(day int) string {
+	if day <= 28 {
+		return ""
+	}
+	days := make([]string, 0, day-27)
+	for d := 28; d <= day; d++ {
+		days = append(days, strconv.Itoa(d))
+	}
+	return ";BYMONTHDAY=" + strings.Join(days, ",") + ";BYSETPOS=-1"
+}
+
+// Write writes the calendar. Bills of the same series (the same Key) must be
+// passed soonest first; a series with a recurrence rule is written once,
+// starting at its first bill.
+func Write(w io.Writer, name string, bills []model.Bill, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) { writeFolded(bw, s) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//finance-tracker//Bill calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escape(name))
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	written := make(map[string]bool)
+	for _, b := range bills {
+		if written[b.Key] {
+			continue
+		}
+		rule, ok := RRule(b.Frequency, b.ScheduleStart)
+		uid := b.Key + "@finance-tracker"
+		if ok {
+			written[b.Key] = true
+		} else {
+			uid = b.Key + "/" + b.DueDate.Format("20060102") + "@finance-tracker"
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + escape(uid))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + b.DueDate.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + b.DueDate.AddDate(0, 0, 1).Format("20060102"))
+		if ok {
+			line("RRULE:" + rule)
+		}
+		line("SUMMARY:" + escape(fmt.Sprintf("%s (%.2f)", b.Name, b.Amount)))
+		line("DESCRIPTION:" + escape(fmt.Sprintf("Expected amount: %.2f\nSource: %s\nKind: %s", b.Amount, b.SourceName, kindLabel(b.Kind))))
+		line("CATEGORIES:" + escape(kindLabel(b.Kind)))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+func kindLabel(kind string) string {
+	switch kind {
+	case model.BillCardPayment:
+		return "Card payment"
+	case model.BillSubscription:
+		return "Subscription"
+	}
+	return "Recurring payment"
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeFolded writes a content line with CRLF, folding it into lines of at
+// most maxLineOctets octets without splitting a UTF-8 character.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,171 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"finance-tracker/model"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// unfold undoes RFC 5545 line folding and returns the content lines.
+func unfold(t *testing.T, out string) []string {
+	t.Helper()
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Fatalf("output doesn't end with CRLF: %q", out)
+	}
+	var lines []string
+	for _, physical := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if strings.Contains(physical, "\n") {
+			t.Errorf("bare line feed in %q", physical)
+		}
+		if len(physical) > maxLineOctets {
+			t.Errorf("line of %d octets, want at most %d: %q", len(physical), maxLineOctets, physical)
+		}
+		if !utf8.ValidString(physical) {
+			t.Errorf("fold splits a UTF-8 character: %q", physical)
+		}
+		if rest, ok := strings.CutPrefix(physical, " "); ok && len(lines) > 0 {
+			lines[len(lines)-1] += rest
+		} else {
+			lines = append(lines, physical)
+		}
+	}
+	return lines
+}
+
+func TestWriteFolded(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"SUMMARY:" + strings.Repeat("a", maxLineOctets-len("SUMMARY:")),
+		"SUMMARY:" + strings.Repeat("a", 200),
+		"SUMMARY:" + strings.Repeat("ü", 100),
+		"SUMMARY:Miete für die Wohnung in der Hauptstraße — 🏠 " + strings.Repeat("€€ 🎉 ", 20),
+		// A four-byte character right across the first fold.
+		"SUMMARY:" + strings.Repeat("x", maxLineOctets-len("SUMMARY:")-2) + "🎉🎉",
+	}
+	for _, line := range tests {
+		var b bytes.Buffer
+		w := bufio.NewWriter(&b)
+		writeFolded(w, line)
+		w.Flush()
+
+		got := unfold(t, b.String())
+		if len(got) != 1 || got[0] != line {
+			t.Errorf("folding %q unfolds to %q", line, got)
+		}
+		if len(line) <= maxLineOctets && b.String() != line+"\r\n" {
+			t.Errorf("%q was folded although it fits", line)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Rent", "Rent"},
+		{"Gas, water; power", `Gas\, water\; power`},
+		{`C:\bills`, `C:\\bills`},
+		{"one\ntwo\r\nthree", `one\ntwo\nthree`},
+		{`a\,b`, `a\\\,b`},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRRule(t *testing.T) {
+	tests := []struct {
+		frequency string
+		start     string
+		want      string
+		ok        bool
+	}{
+		{model.RecurWeekly, "2025-01-31", "FREQ=WEEKLY", true},
+		{model.RecurBiweekly, "2025-01-31", "FREQ=WEEKLY;INTERVAL=2", true},
+		{model.CadenceBiweekly, "2025-01-31", "FREQ=WEEKLY;INTERVAL=2", true},
+		{model.RecurMonthly, "2025-01-28", "FREQ=MONTHLY", true},
+		{model.RecurMonthly, "2025-01-29", "FREQ=MONTHLY;BYMONTHDAY=28,29;BYSETPOS=-1", true},
+		{model.RecurMonthly, "2025-01-31", "FREQ=MONTHLY;BYMONTHDAY=28,29,30,31;BYSETPOS=-1", true},
+		{model.CadenceQuarterly, "2025-01-30", "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=28,29,30;BYSETPOS=-1", true},
+		{model.RecurYearly, "2025-03-31", "FREQ=YEARLY", true},
+		{model.RecurYearly, "2024-02-29", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=28,29;BYSETPOS=-1", true},
+		{"", "2025-01-31", "", false},
+		{"fortnightly", "2025-01-31", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := RRule(tt.frequency, day(tt.start))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("RRule(%q, %s) = %q, %v; want %q, %v", tt.frequency, tt.start, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	bills := []model.Bill{
+		{Kind: model.BillRecurring, Name: "Rent, flat 2", Amount: 1200, SourceName: "Checking",
+			DueDate: day("2025-01-31"), Frequency: model.RecurMonthly, ScheduleStart: day("2024-10-31"), Key: "recurring:rent"},
+		{Kind: model.BillCardPayment, Name: "Visa", Amount: 310.5, SourceName: "Visa",
+			DueDate: day("2025-02-05"), Key: "card:Visa"},
+		{Kind: model.BillRecurring, Name: "Rent, flat 2", Amount: 1200, SourceName: "Checking",
+			DueDate: day("2025-02-28"), Frequency: model.RecurMonthly, ScheduleStart: day("2024-10-31"), Key: "recurring:rent"},
+		{Kind: model.BillCardPayment, Name: "Visa", Amount: 120, SourceName: "Visa",
+			DueDate: day("2025-03-05"), Key: "card:Visa"},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, "Bills - Home", bills, time.Date(2025, 1, 20, 8, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	lines := unfold(t, b.String())
+
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Errorf("not wrapped in a VCALENDAR: %q ... %q", lines[0], lines[len(lines)-1])
+	}
+	var events [][]string
+	for _, l := range lines {
+		switch {
+		case l == "BEGIN:VEVENT":
+			events = append(events, nil)
+		case len(events) > 0:
+			events[len(events)-1] = append(events[len(events)-1], l)
+		}
+	}
+	// The rent repeats and is written once; the card payments don't and get
+	// one event per due date.
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3:\n%s", len(events), b.String())
+	}
+	want := [][]string{
+		{"UID:recurring:rent@finance-tracker", "DTSTART;VALUE=DATE:20250131", "DTEND;VALUE=DATE:20250201",
+			"RRULE:FREQ=MONTHLY;BYMONTHDAY=28,29,30,31;BYSETPOS=-1", `SUMMARY:Rent\, flat 2 (1200.00)`,
+			`DESCRIPTION:Expected amount: 1200.00\nSource: Checking\nKind: Recurring payment`},
+		{"UID:card:Visa/20250205@finance-tracker", "DTSTART;VALUE=DATE:20250205", "SUMMARY:Visa (310.50)",
+			"CATEGORIES:Card payment"},
+		{"UID:card:Visa/20250305@finance-tracker", "DTSTART;VALUE=DATE:20250305", "SUMMARY:Visa (120.00)"},
+	}
+	for i, event := range events {
+		joined := "\n" + strings.Join(event, "\n") + "\n"
+		for _, line := range want[i] {
+			if !strings.Contains(joined, "\n"+line+"\n") {
+				t.Errorf("event %d lacks %q:%s", i, line, joined)
+			}
+		}
+		if i > 0 && strings.Contains(joined, "\nRRULE:") {
+			t.Errorf("one-off event %d has an RRULE:%s", i, joined)
+		}
+		if !strings.Contains(joined, "\nDTSTAMP:20250120T080000Z\n") {
+			t.Errorf("event %d lacks the DTSTAMP:%s", i, joined)
+		}
+	}
+}
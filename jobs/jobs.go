@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"finance-tracker/database"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Every runs fn in the background once at startup and then at every interval.
+// Each run gets its own database connection, because the connection shared by
+// the HTTP handlers must not be used from another goroutine.
+func Every(name string, interval time.Duration, fn func(db *pgx.Conn) error) {
+	go func() {
+		for {
+			run(name, fn)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func run(name string, fn func(db *pgx.Conn) error) {
+	db, err := database.GetConn()
+	if err != nil {
+		log.Printf("Job %s: cant connect to database: %v", name, err)
+		return
+	}
+	defer db.Close(context.Background())
+
+	if err := fn(db); err != nil {
+		log.Printf("Job %s failed: %v", name, err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package loan computes amortization schedules for fixed-rate loans.
+package loan
+
+import (
+	"math"
+	"time"
+)
+
+// Payment frequencies.
+const (
+	Monthly  = "monthly"
+	Biweekly = "biweekly"
+	Weekly   = "weekly"
+)
+
+// Frequencies lists every payment frequency, for form drop-downs.
+var Frequencies = []string{Monthly, Biweekly, Weekly}
+
+// maxPeriods stops a schedule whose payment never covers the interest from
+// running forever.
+const maxPeriods = 1200
+
+// PeriodsPerYear returns how many payments a year the frequency has, or 0 for
+// an unknown frequency.
+func PeriodsPerYear(frequency string) int {
+	switch frequency {
+	case Monthly:
+		return 12
+	case Biweekly:
+		return 26
+	case Weekly:
+		return 52
+	}
+	return 0
+}
+
+// PeriodicRate converts an annual percentage rate into the rate per payment.
+func PeriodicRate(annualRate float64, frequency string) float64 {
+	n := PeriodsPerYear(frequency)
+	if n == 0 {
+		return 0
+	}
+	return annualRate / 100 / float64(n)
+}
+
+// NumberOfPayments converts a term in months into a number of payments.
+func NumberOfPayments(termMonths int, frequency string) int {
+	return int(math.Round(float64(termMonths) * float64(PeriodsPerYear(frequency)) / 12))
+}
+
+// NextDate returns the payment date n periods after date. Monthly payments
+// keep the day of the month, falling on the last day of shorter months: a
+// loan paid on Jan 31 is next paid on Feb 28 and then on Mar 31.
+func NextDate(date time.Time, frequency string, n int) time.Time {
+	switch frequency {
+	case Biweekly:
+		return date.AddDate(0, 0, 14*n)
+	case Weekly:
+		return date.AddDate(0, 0, 7*n)
+	}
+	year, month, day := date.Date()
+	first := time.Date(year, month+time.Month(n), 1, 0, 0, 0, 0, date.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return time.Date(year, month+time.Month(n), min(day, last),
+		date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Payment returns the fixed payment that repays principal over n periods at
+// the given periodic rate.
+func Payment(principal, rate float64, n int) float64 {
+	if n <= 0 {
+		return principal
+	}
+	if rate == 0 {
+		return round(principal / float64(n))
+	}
+	return round(principal * rate / (1 - math.Pow(1+rate, -float64(n))))
+}
+
+// Split divides a payment into interest accrued on the outstanding balance
+// for one period and the principal it repays. The principal part never
+// exceeds what is outstanding.
+func Split(outstanding, rate, amount float64) (principal, interest float64) {
+	interest = math.Min(round(outstanding*rate), amount)
+	principal = math.Min(round(amount-interest), outstanding)
+	return principal, interest
+}
+
+type Installment struct {
+	Number    int
+	Date      time.Time
+	Payment   float64
+	Principal float64
+	Interest  float64
+	Extra     float64
+	Balance   float64
+}
+
+type Schedule struct {
+	Installments  []Installment
+	PayoffDate    time.Time
+	TotalInterest float64
+	TotalPaid     float64
+	// Complete is false when the payment doesn't cover the interest, so the
+	// loan would never be paid off.
+	Complete bool
+}
+
+// Amortize builds the schedule for paying off outstanding with a regular
+// payment plus an optional extra principal payment each period, starting on
+// firstDate.
+func Amortize(outstanding, rate, payment, extra float64, firstDate time.Time, frequency string) Schedule {
+	var s Schedule
+	balance := round(outstanding)
+	for i := 0; balance > 0 && i < maxPeriods; i++ {
+		interest := round(balance * rate)
+		if payment+extra <= interest {
+			return s
+		}
+		principal := math.Min(round(payment-interest), balance)
+		extraPaid := math.Min(extra, round(balance-principal))
+		balance = round(balance - principal - extraPaid)
+
+		inst := Installment{
+			Number:    i + 1,
+			Date:      NextDate(firstDate, frequency, i),
+			Payment:   round(principal + interest + extraPaid),
+			Principal: principal,
+			Interest:  interest,
+			Extra:     extraPaid,
+			Balance:   balance,
+		}
+		s.Installments = append(s.Installments, inst)
+		s.TotalInterest = round(s.TotalInterest + interest)
+		s.TotalPaid = round(s.TotalPaid + inst.Payment)
+		s.PayoffDate = inst.Date
+	}
+	s.Complete = balance <= 0
+	return s
+}
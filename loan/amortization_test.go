@@ -0,0 +1,70 @@
+package loan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		rate      float64
+		n         int
+		want      float64
+	}{
+		{"30 year mortgage at 6%", 200000, PeriodicRate(6, Monthly), 360, 1199.10},
+		{"car loan at 4.5%", 25000, PeriodicRate(4.5, Monthly), 60, 466.08},
+		{"biweekly at 5%", 10000, PeriodicRate(5, Biweekly), 52, 202.27},
+		{"interest free", 1200, 0, 12, 100},
+		{"interest free, uneven", 1000, 0, 3, 333.33},
+		{"no periods", 500, PeriodicRate(6, Monthly), 0, 500},
+	}
+	for _, tt := range tests {
+		if got := Payment(tt.principal, tt.rate, tt.n); got != tt.want {
+			t.Errorf("%s: Payment = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+// An interest free loan is paid off in exactly its number of payments.
+func TestAmortizeInterestFree(t *testing.T) {
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	s := Amortize(1200, 0, Payment(1200, 0, 12), 0, start, Monthly)
+	if !s.Complete || len(s.Installments) != 12 || s.TotalInterest != 0 || s.TotalPaid != 1200 {
+		t.Errorf("got %d installments, interest %.2f, paid %.2f, complete %v; want 12, 0, 1200, true",
+			len(s.Installments), s.TotalInterest, s.TotalPaid, s.Complete)
+	}
+	if want := time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC); !s.PayoffDate.Equal(want) {
+		t.Errorf("PayoffDate = %v, want %v", s.PayoffDate, want)
+	}
+}
+
+func TestNextDateMonthEnd(t *testing.T) {
+	tests := []struct {
+		start string
+		want  []string
+	}{
+		{"2025-01-29", []string{"2025-01-29", "2025-02-28", "2025-03-29"}},
+		{"2024-01-29", []string{"2024-01-29", "2024-02-29", "2024-03-29"}},
+		{"2025-01-30", []string{"2025-01-30", "2025-02-28", "2025-03-30", "2025-04-30"}},
+		{"2025-01-31", []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31"}},
+		{"2025-12-31", []string{"2025-12-31", "2026-01-31", "2026-02-28"}},
+	}
+	for _, tt := range tests {
+		start, _ := time.Parse("2006-01-02", tt.start)
+		for n, want := range tt.want {
+			if got := NextDate(start, Monthly, n).Format("2006-01-02"); got != want {
+				t.Errorf("from %s: payment %d on %s, want %s", tt.start, n, got, want)
+			}
+		}
+	}
+
+	start := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	if got := NextDate(start, Weekly, 1); !got.Equal(time.Date(2025, 2, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly: got %v", got)
+	}
+	if got := NextDate(start, Biweekly, 2); !got.Equal(time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("biweekly: got %v", got)
+	}
+}
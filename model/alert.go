@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert kinds.
+const (
+	// AlertLargeExpense is a single expense far above what its payee, or
+	// otherwise its category, usually costs.
+	AlertLargeExpense = "large_expense"
+	// AlertCategorySpike is a category running at several times its usual
+	// monthly spend.
+	AlertCategorySpike = "category_spike"
+)
+
+// Alert records spending that looks off compared with its history. Amount is
+// what was flagged and Baseline what is usual for it: the mean expense for
+// large expenses, the median monthly spend for category spikes.
+type Alert struct {
+	AlertID       uuid.UUID  `db:"alert_id" json:"alert_id"`
+	Kind          string     `db:"kind" json:"kind"`
+	TransactionID *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	PayeeID       *uuid.UUID `db:"payee_id" json:"payee_id"`
+	Category      string     `db:"category" json:"category"`
+	Message       string     `db:"message" json:"message"`
+	Amount        float64    `db:"amount" json:"amount"`
+	Baseline      float64    `db:"baseline" json:"baseline"`
+	// Period is the month of a category spike; a category is flagged at
+	// most once a month.
+	Period      *time.Time `db:"period" json:"period"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	DismissedAt *time.Time `db:"dismissed_at" json:"dismissed_at"`
+}
+
+type AlertsPageData struct {
+	Alerts        []Alert
+	ShowDismissed bool
+	CSRFToken     string
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a receipt or other document attached to a transaction. The
+// file itself is kept on disk under its SHA-256; the same content attached
+// twice is stored once.
+type Attachment struct {
+	AttachmentID  uuid.UUID `db:"attachment_id" json:"attachment_id"`
+	TransactionID uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	FileName      string    `db:"file_name" json:"file_name"`
+	ContentType   string    `db:"content_type" json:"content_type"`
+	Size          int64     `db:"size" json:"size"`
+	SHA256        string    `db:"sha256" json:"sha256"`
+	HasThumbnail  bool      `db:"has_thumbnail" json:"has_thumbnail"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// SizeLabel formats the file size for display, e.g. "1.2 MB".
+func (a Attachment) SizeLabel() string {
+	switch {
+	case a.Size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(a.Size)/(1<<20))
+	case a.Size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(a.Size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", a.Size)
+}
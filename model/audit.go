@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actor identifies who made a change and where the request came from.
+type Actor struct {
+	Name      string
+	OriginIP  string
+	UserAgent string
+}
+
+// SystemActor is used for changes made by background jobs rather than a request.
+var SystemActor = Actor{Name: "system"}
+
+type AuditEntry struct {
+	AuditID    uuid.UUID       `db:"audit_id"`
+	Action     string          `db:"action"`
+	EntityType string          `db:"entity_type"`
+	EntityID   string          `db:"entity_id"`
+	Actor      string          `db:"actor"`
+	OriginIP   string          `db:"origin_ip"`
+	UserAgent  string          `db:"user_agent"`
+	Before     json.RawMessage `db:"before_value"`
+	After      json.RawMessage `db:"after_value"`
+	CreatedAt  time.Time       `db:"created_at"`
+}
+
+type AuditFilter struct {
+	Action     string `schema:"action"`
+	EntityType string `schema:"entity_type"`
+	EntityID   string `schema:"entity_id"`
+	Actor      string `schema:"actor"`
+	From       string `schema:"from"`
+	To         string `schema:"to"`
+	Limit      int    `schema:"limit"`
+}
+
+type AuditPageData struct {
+	Entries []AuditEntry
+	Filter  AuditFilter
+	Actions []string
+}
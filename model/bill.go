@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bill kinds.
+const (
+	BillRecurring    = "recurring"
+	BillCardPayment  = "card_payment"
+	BillSubscription = "subscription"
+)
+
+// Bill is an expected payment: an occurrence of a recurring expense, the
+// payment due on a credit card statement or the next charge of a detected
+// subscription.
+type Bill struct {
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Amount     float64   `json:"amount"`
+	SourceName string    `json:"source_name"`
+	DueDate    time.Time `json:"due_date"`
+	// Frequency is how often the bill repeats, a recurring transaction
+	// frequency or a subscription cadence; empty for a one-off payment.
+	Frequency string `json:"frequency"`
+	// ScheduleStart is the date the schedule of a repeating bill is counted
+	// from.
+	ScheduleStart time.Time `json:"-"`
+	// Key identifies what the bill is for, the same for every occurrence,
+	// such as "recurring:<id>" or "card:<source>".
+	Key string `json:"key"`
+}
+
+// CalendarFeed is a secret URL a calendar app subscribes to for the bill
+// calendar. Like API tokens, only a hash of its token is stored.
+type CalendarFeed struct {
+	FeedID        uuid.UUID  `db:"feed_id"`
+	Name          string     `db:"name"`
+	CreatedAt     time.Time  `db:"created_at"`
+	LastFetchedAt *time.Time `db:"last_fetched_at"`
+	RevokedAt     *time.Time `db:"revoked_at"`
+}
+
+type CreateCalendarFeedRequest struct {
+	Name string `schema:"name"`
+}
+
+type BillsPageData struct {
+	Bills []Bill
+	Days  int
+	Total float64
+	Feeds []CalendarFeed
+	// NewFeedURL is the URL of a feed just created, shown once.
+	NewFeedURL string
+	FormErrors map[string]string
+	CSRFToken  string
+}
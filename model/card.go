@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// CreditCard holds the statement settings of a credit_card source.
+type CreditCard struct {
+	SourceName        string   `db:"source_name"`
+	Balance           float64  `db:"balance"`
+	CreditLimit       *float64 `db:"credit_limit"`
+	StatementDay      int      `db:"statement_day"`
+	DueDay            int      `db:"due_day"`
+	MinPaymentPercent float64  `db:"min_payment_percent"`
+	MinPaymentAmount  float64  `db:"min_payment_amount"`
+}
+
+// CardStatement is one statement cycle of a credit card. Amounts are what is
+// owed, so they are positive when the card carries debt.
+type CardStatement struct {
+	SourceName       string
+	PeriodStart      time.Time
+	ClosingDate      time.Time
+	DueDate          time.Time
+	NewCharges       float64
+	Credits          float64
+	StatementBalance float64
+	MinimumPayment   float64
+	PaidSinceClosing float64
+	RemainingDue     float64
+}
+
+type CardSettingsRequest struct {
+	SourceName        string `schema:"source_name"`
+	StatementDay      int    `schema:"statement_day"`
+	DueDay            int    `schema:"due_day"`
+	MinPaymentPercent string `schema:"min_payment_percent"`
+	MinPaymentAmount  string `schema:"min_payment_amount"`
+}
+
+type PayCardRequest struct {
+	CardName        string `schema:"card_name"`
+	FromSource      string `schema:"from_source"`
+	Amount          string `schema:"amount"`
+	TransactionDate string `schema:"transaction_date"`
+}
+
+type CardView struct {
+	Card       CreditCard
+	Configured bool
+	Statements []CardStatement
+}
+
+type CardsPageData struct {
+	Cards          []CardView
+	PaymentSources []string
+	FormErrors     map[string]string
+	CSRFToken      string
+}
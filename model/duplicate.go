@@ -0,0 +1,18 @@
+package model
+
+// DuplicateCluster is a group of transactions that look like the same one
+// entered more than once: same source, type and amount, close dates and
+// similar names.
+type DuplicateCluster struct {
+	Transactions []TransactionInfo
+}
+
+type DuplicatesPageData struct {
+	Clusters   []DuplicateCluster
+	WindowDays int
+	FormErrors map[string]string
+	// Merged is how many transactions the last merge moved to the trash.
+	Merged     int
+	ShowMerged bool
+	CSRFToken  string
+}
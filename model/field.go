@@ -0,0 +1,109 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Custom field types.
+const (
+	FieldText    = "text"
+	FieldNumber  = "number"
+	FieldDate    = "date"
+	FieldBoolean = "boolean"
+)
+
+// FieldTypes lists every custom field type, for form drop-downs.
+var FieldTypes = []string{FieldText, FieldNumber, FieldDate, FieldBoolean}
+
+// CustomField is a user-defined, typed field transactions can carry a value
+// for, such as "Warranty until" (date) or "Reimbursable" (boolean).
+type CustomField struct {
+	FieldID   uuid.UUID `db:"field_id"`
+	Name      string    `db:"name"`
+	FieldType string    `db:"field_type"`
+	CreatedAt time.Time `db:"created_at"`
+	// Uses is how many transactions have a value for the field.
+	Uses int `db:"-"`
+}
+
+// FieldValue is the value of a custom field on one transaction. Value is
+// formatted as text: numbers as decimals, dates as YYYY-MM-DD and booleans as
+// true or false.
+type FieldValue struct {
+	FieldID   uuid.UUID `json:"field_id"`
+	Name      string    `json:"name"`
+	FieldType string    `json:"field_type"`
+	Value     string    `json:"value"`
+}
+
+type CreateFieldRequest struct {
+	Name      string `schema:"name"`
+	FieldType string `schema:"field_type"`
+}
+
+type FieldsPageData struct {
+	Fields     []CustomField
+	FieldTypes []string
+	FormErrors map[string]string
+	CSRFToken  string
+}
+
+// TransactionDetailsRequest is the details form of a transaction. Custom
+// field values are submitted as field_<field id> and read separately.
+type TransactionDetailsRequest struct {
+	TransactionID string `schema:"transaction_id"`
+	Notes         string `schema:"notes"`
+	Tags          string `schema:"tags"`
+}
+
+type TransactionDetailsPageData struct {
+	Transaction TransactionInfo
+	// Fields holds every custom field, with the transaction's value if it
+	// has one.
+	Fields      []FieldValue
+	Attachments []Attachment
+	// Payees are the payees the transaction can be moved to.
+	Payees []Payee
+	// MaxAttachmentMB is the largest file that can be uploaded.
+	MaxAttachmentMB int
+	FormErrors      map[string]string
+	CSRFToken       string
+}
+
+// TransactionFilter narrows the transaction list. Query matches the name or
+// the notes; FieldValue may be left empty to match any value of FieldID.
+type TransactionFilter struct {
+	Tag        string `schema:"tag"`
+	Query      string `schema:"q"`
+	FieldID    string `schema:"field"`
+	FieldValue string `schema:"field_value"`
+	Payee      string `schema:"payee"`
+}
+
+// Active reports whether the filter narrows anything down.
+func (f TransactionFilter) Active() bool {
+	return f.Tag != "" || f.Query != "" || f.FieldID != "" || f.Payee != ""
+}
+
+// TagTotal is the income and expense of transactions carrying a tag.
+type TagTotal struct {
+	Tag     string  `json:"tag"`
+	Income  float64 `json:"income"`
+	Expense float64 `json:"expense"`
+	Count   int     `json:"count"`
+}
+
+// FieldTotal is the income and expense of transactions with a custom field
+// value. Number fields are not grouped by value; Sum is the total of their
+// values instead.
+type FieldTotal struct {
+	Field     string   `json:"field"`
+	FieldType string   `json:"field_type"`
+	Value     string   `json:"value"`
+	Income    float64  `json:"income"`
+	Expense   float64  `json:"expense"`
+	Count     int      `json:"count"`
+	Sum       *float64 `json:"sum"`
+}
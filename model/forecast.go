@@ -0,0 +1,139 @@
+package model
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recurrence frequencies of scheduled transactions.
+const (
+	RecurWeekly   = "weekly"
+	RecurBiweekly = "biweekly"
+	RecurMonthly  = "monthly"
+	RecurYearly   = "yearly"
+)
+
+var RecurFrequencies = []string{RecurWeekly, RecurBiweekly, RecurMonthly, RecurYearly}
+
+func ValidRecurFrequency(f string) bool {
+	for _, v := range RecurFrequencies {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+// RecurringTransaction is an expected income or expense, such as a salary or
+// rent, that repeats from StartDate on.
+type RecurringTransaction struct {
+	RecurringID  uuid.UUID `db:"recurring_id" json:"recurring_id"`
+	Name         string    `db:"name" json:"name"`
+	CategoryType string    `db:"category_type" json:"transaction_type"`
+	Category     string    `db:"category" json:"category"`
+	Amount       float64   `db:"amount" json:"amount"`
+	SourceName   string    `db:"source_name" json:"source_name"`
+	Frequency    string    `db:"frequency" json:"frequency"`
+	StartDate    time.Time `db:"start_date" json:"start_date"`
+}
+
+// AddMonths returns t moved by n months, keeping its day of the month but
+// clamping it to the last day of shorter months: Jan 31 plus one month is
+// Feb 28 (or 29), where time.AddDate would roll over into Mar 3.
+func AddMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// OccurrenceN returns the date of the n-th occurrence, counting from zero.
+// Monthly and yearly occurrences are counted from StartDate rather than from
+// the previous one, so a rent due on the 31st is due on Feb 28 and then on
+// Mar 31 again.
+func (r RecurringTransaction) OccurrenceN(n int) time.Time {
+	switch r.Frequency {
+	case RecurWeekly:
+		return r.StartDate.AddDate(0, 0, 7*n)
+	case RecurBiweekly:
+		return r.StartDate.AddDate(0, 0, 14*n)
+	case RecurYearly:
+		return AddMonths(r.StartDate, 12*n)
+	}
+	return AddMonths(r.StartDate, n)
+}
+
+// Occurrences returns every date in [from, to] on which the transaction is due.
+func (r RecurringTransaction) Occurrences(from, to time.Time) []time.Time {
+	var dates []time.Time
+	for n := 0; ; n++ {
+		d := r.OccurrenceN(n)
+		if d.After(to) {
+			return dates
+		}
+		if !d.Before(from) {
+			dates = append(dates, d)
+		}
+	}
+}
+
+type AddRecurringRequest struct {
+	Name         string `schema:"name"`
+	CategoryType string `schema:"transaction_type"`
+	Category     string `schema:"category"`
+	Amount       string `schema:"amount"`
+	SourceName   string `schema:"source_name"`
+	Frequency    string `schema:"frequency"`
+	StartDate    string `schema:"start_date"`
+}
+
+// CategoryRate is the average daily spend of one category from one source.
+type CategoryRate struct {
+	SourceName  string  `json:"source_name"`
+	Category    string  `json:"category"`
+	DailyAmount float64 `json:"daily_amount"`
+}
+
+// ForecastDay is the projected end-of-day balance of a source.
+type ForecastDay struct {
+	Date      time.Time `json:"date"`
+	Scheduled float64   `json:"scheduled"`
+	Estimated float64   `json:"estimated"`
+	Balance   float64   `json:"balance"`
+	// Items names the recurring transactions due that day.
+	Items []string `json:"items,omitempty"`
+	// Violation is set when the balance is below what the source may hold,
+	// the same rule that rejects an expense with ErrNotEnoughBalance.
+	Violation bool `json:"violation"`
+}
+
+type SourceForecast struct {
+	SourceName     string        `json:"source_name"`
+	SourceType     string        `json:"source_type"`
+	CreditLimit    *float64      `json:"credit_limit"`
+	StartBalance   float64       `json:"start_balance"`
+	DailySpend     float64       `json:"daily_spend"`
+	LowestBalance  float64       `json:"lowest_balance"`
+	LowestDate     time.Time     `json:"lowest_date"`
+	FirstViolation *time.Time    `json:"first_violation"`
+	Days           []ForecastDay `json:"days"`
+}
+
+type Forecast struct {
+	From        time.Time        `json:"from"`
+	Days        int              `json:"days"`
+	HistoryDays int              `json:"history_days"`
+	Sources     []SourceForecast `json:"sources"`
+}
+
+type ForecastPageData struct {
+	Forecast         Forecast
+	Charts           map[string]template.HTML
+	Recurring        []RecurringTransaction
+	AvailableSources []string
+	Frequencies      []string
+	FormErrors       map[string]string
+	CSRFToken        string
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestOccurrenceNMonthEnd(t *testing.T) {
+	tests := []struct {
+		frequency string
+		start     string
+		want      []string
+	}{
+		{RecurMonthly, "2025-01-29", []string{"2025-01-29", "2025-02-28", "2025-03-29", "2025-04-29"}},
+		{RecurMonthly, "2024-01-29", []string{"2024-01-29", "2024-02-29", "2024-03-29", "2024-04-29"}},
+		{RecurMonthly, "2025-01-30", []string{"2025-01-30", "2025-02-28", "2025-03-30", "2025-04-30"}},
+		{RecurMonthly, "2025-01-31", []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31"}},
+		{RecurMonthly, "2025-11-30", []string{"2025-11-30", "2025-12-30", "2026-01-30", "2026-02-28"}},
+		{RecurYearly, "2024-02-29", []string{"2024-02-29", "2025-02-28", "2026-02-28", "2027-02-28", "2028-02-29"}},
+		{RecurWeekly, "2025-01-31", []string{"2025-01-31", "2025-02-07", "2025-02-14"}},
+		{RecurBiweekly, "2025-01-31", []string{"2025-01-31", "2025-02-14", "2025-02-28"}},
+	}
+	for _, tt := range tests {
+		r := RecurringTransaction{Frequency: tt.frequency, StartDate: date(tt.start)}
+		for n, want := range tt.want {
+			if got := r.OccurrenceN(n).Format("2006-01-02"); got != want {
+				t.Errorf("%s from %s: occurrence %d = %s, want %s", tt.frequency, tt.start, n, got, want)
+			}
+		}
+	}
+}
+
+// Every month gets exactly one payment, however short it is.
+func TestOccurrencesOncePerMonth(t *testing.T) {
+	for _, start := range []string{"2025-01-29", "2025-01-30", "2025-01-31"} {
+		r := RecurringTransaction{Frequency: RecurMonthly, StartDate: date(start)}
+		perMonth := make(map[string]int)
+		for _, d := range r.Occurrences(date("2025-01-01"), date("2026-12-31")) {
+			perMonth[d.Format("2006-01")]++
+		}
+		if len(perMonth) != 24 {
+			t.Errorf("from %s: payments in %d months, want 24", start, len(perMonth))
+		}
+		for month, n := range perMonth {
+			if n != 1 {
+				t.Errorf("from %s: %d payments in %s, want 1", start, n, month)
+			}
+		}
+	}
+}
+
+func TestAddMonthsKeepsTime(t *testing.T) {
+	loc := time.FixedZone("UTC+7", 7*3600)
+	got := AddMonths(time.Date(2025, 3, 31, 9, 30, 0, 0, loc), -1)
+	if want := time.Date(2025, 2, 28, 9, 30, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("AddMonths = %v, want %v", got, want)
+	}
+}
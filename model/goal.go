@@ -0,0 +1,104 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Goal is a savings target. Money is set aside for it by allocating part of
+// one or more sources' balances.
+type Goal struct {
+	GoalID       uuid.UUID `db:"goal_id"`
+	Name         string    `db:"name"`
+	TargetAmount float64   `db:"target_amount"`
+	TargetDate   time.Time `db:"target_date"`
+	CreatedAt    time.Time `db:"created_at"`
+	Allocated    float64   `db:"allocated"`
+	Sources      []GoalShare
+}
+
+// GoalShare is how much of one source is allocated to a goal.
+type GoalShare struct {
+	SourceName string
+	Amount     float64
+}
+
+// Progress is the allocated share of the target, as a percentage capped at 100.
+func (g Goal) Progress() float64 {
+	if g.TargetAmount <= 0 {
+		return 0
+	}
+	return math.Min(100, math.Round(g.Allocated/g.TargetAmount*1000)/10)
+}
+
+// Remaining is what still has to be saved to reach the target.
+func (g Goal) Remaining() float64 {
+	return math.Max(0, g.TargetAmount-g.Allocated)
+}
+
+// MonthsLeft is the number of months from today to the target date, at least
+// one so an overdue goal asks for the whole remainder now.
+func (g Goal) MonthsLeft(today time.Time) int {
+	months := (g.TargetDate.Year()-today.Year())*12 + int(g.TargetDate.Month()-today.Month())
+	if g.TargetDate.Day() > today.Day() {
+		months++
+	}
+	return max(1, months)
+}
+
+// MonthlyContribution is what has to be allocated every month to reach the
+// target by the target date.
+func (g Goal) MonthlyContribution(today time.Time) float64 {
+	return math.Ceil(g.Remaining()/float64(g.MonthsLeft(today))*100) / 100
+}
+
+// GoalContribution is one allocation to, or release from, a goal. Releases
+// have a negative amount.
+type GoalContribution struct {
+	ContributionID uuid.UUID `db:"contribution_id"`
+	GoalID         uuid.UUID `db:"goal_id"`
+	GoalName       string    `db:"goal_name"`
+	SourceName     string    `db:"source_name"`
+	Amount         float64   `db:"amount"`
+	Note           string    `db:"note"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// SourceAllocation is how much of a source's balance is set aside for goals.
+// Spending after an allocation can leave less in the source than is
+// allocated; Unallocated is then zero and OverAllocated the shortfall.
+type SourceAllocation struct {
+	SourceName    string
+	Balance       float64
+	Allocated     float64
+	Unallocated   float64
+	OverAllocated float64
+}
+
+type CreateGoalRequest struct {
+	Name         string `schema:"name"`
+	TargetAmount string `schema:"target_amount"`
+	TargetDate   string `schema:"target_date"`
+}
+
+type AllocateGoalRequest struct {
+	GoalID     string `schema:"goal_id"`
+	SourceName string `schema:"source_name"`
+	Amount     string `schema:"amount"`
+	// Release takes money back from the goal instead of allocating it.
+	Release bool   `schema:"release"`
+	Note    string `schema:"note"`
+}
+
+type GoalsPageData struct {
+	Goals   []Goal
+	Sources []SourceAllocation
+	// OverAllocated lists the sources holding less than their goals count on.
+	OverAllocated []SourceAllocation
+	Contributions []GoalContribution
+	Today         time.Time
+	FormErrors    map[string]string
+	CSRFToken     string
+}
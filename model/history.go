@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// NetWorthPoint is the total of all sources at the end of one day.
+type NetWorthPoint struct {
+	Date        time.Time `json:"date"`
+	Assets      float64   `json:"assets"`
+	Liabilities float64   `json:"liabilities"`
+	NetWorth    float64   `json:"net_worth"`
+}
+
+// BalancePoint is the balance of one source at the end of one day.
+type BalancePoint struct {
+	Date    time.Time `json:"date"`
+	Balance float64   `json:"balance"`
+}
+
+// BalanceHistory is the response of GET /api/balance-history.
+type BalanceHistory struct {
+	From    time.Time                 `json:"from"`
+	To      time.Time                 `json:"to"`
+	Total   []NetWorthPoint           `json:"total"`
+	Sources map[string][]BalancePoint `json:"sources"`
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"finance-tracker/loan"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Loan holds the terms of a loan source. The source balance is negative while
+// money is owed.
+type Loan struct {
+	SourceName       string    `db:"source_name"`
+	Balance          float64   `db:"balance"`
+	Configured       bool      `db:"-"`
+	Principal        float64   `db:"principal"`
+	AnnualRate       float64   `db:"annual_rate"`
+	TermMonths       int       `db:"term_months"`
+	Frequency        string    `db:"frequency"`
+	StartDate        time.Time `db:"start_date"`
+	InterestCategory string    `db:"interest_category"`
+}
+
+// Outstanding is the amount still owed on the loan.
+func (l Loan) Outstanding() float64 {
+	if l.Balance >= 0 {
+		return 0
+	}
+	return -l.Balance
+}
+
+// PeriodicRate is the interest rate applied per payment period.
+func (l Loan) PeriodicRate() float64 {
+	return loan.PeriodicRate(l.AnnualRate, l.Frequency)
+}
+
+// ScheduledPayment is the regular payment that repays the original principal
+// over the full term.
+func (l Loan) ScheduledPayment() float64 {
+	return loan.Payment(l.Principal, l.PeriodicRate(), loan.NumberOfPayments(l.TermMonths, l.Frequency))
+}
+
+type LoanPayment struct {
+	PaymentID   uuid.UUID `db:"payment_id"`
+	SourceName  string    `db:"source_name"`
+	FromSource  string    `db:"from_source"`
+	PaymentDate time.Time `db:"payment_date"`
+	Amount      float64   `db:"amount"`
+	Principal   float64   `db:"principal"`
+	Interest    float64   `db:"interest"`
+	// TransferID links the transfer of the principal and
+	// InterestTransactionID the interest expense; both are nil when that part
+	// of the payment was zero.
+	TransferID            *uuid.UUID `db:"transfer_id"`
+	InterestTransactionID *uuid.UUID `db:"interest_transaction_id"`
+}
+
+type LoanTermsRequest struct {
+	SourceName       string `schema:"source_name"`
+	Principal        string `schema:"principal"`
+	AnnualRate       string `schema:"annual_rate"`
+	TermMonths       int    `schema:"term_months"`
+	Frequency        string `schema:"frequency"`
+	StartDate        string `schema:"start_date"`
+	InterestCategory string `schema:"interest_category"`
+}
+
+type LoanPaymentRequest struct {
+	LoanName        string `schema:"loan_name"`
+	FromSource      string `schema:"from_source"`
+	Amount          string `schema:"amount"`
+	TransactionDate string `schema:"transaction_date"`
+}
+
+type LoanView struct {
+	Loan             Loan
+	ScheduledPayment float64
+	NextPaymentDate  time.Time
+	Remaining        loan.Schedule
+	// Original is the schedule of the loan as first taken out, for comparing
+	// total interest.
+	Original      loan.Schedule
+	Extra         float64
+	WithExtra     *loan.Schedule
+	InterestSaved float64
+	Payments      []LoanPayment
+}
+
+type LoansPageData struct {
+	Loans          []LoanView
+	PaymentSources []string
+	Frequencies    []string
+	FormErrors     map[string]string
+	CSRFToken      string
+}
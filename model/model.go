@@ -1,16 +1,21 @@
 package model
 
 import (
+	"html/template"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Account struct {
-	SourceName string    `db:"source_name"`
-	Balance    float64   `db:"balance"`
-	CreatedAt  time.Time `db:"created_at"`
-	IsActive   bool      `db:"is_active"`
+	SourceName  string    `db:"source_name"`
+	Balance     float64   `db:"balance"`
+	CreatedAt   time.Time `db:"created_at"`
+	IsActive    bool      `db:"is_active"`
+	SourceType  string    `db:"source_type"`
+	CreditLimit *float64  `db:"credit_limit"`
+	// LowBalanceThreshold warns when the available funds drop below it.
+	LowBalanceThreshold *float64 `db:"low_balance_threshold"`
 }
 
 type Transaction struct {
@@ -29,10 +34,25 @@ type TransactionInfo struct {
 	CategoryName    string    `db:"category_name"`
 	TransactionDate time.Time `db:"transaction_date"`
 	SourceName      string    `db:"source_name"`
+	Category        string    `db:"category"`
+	Tags            []string  `db:"tags"`
+	Notes           string    `db:"description"`
+	// RuleID is the rule that categorized the transaction, if any.
+	RuleID   *uuid.UUID `db:"rule_id"`
+	RuleName string     `db:"-"`
+	// PayeeID is the payee the raw name was matched to, if any.
+	PayeeID   *uuid.UUID `db:"payee_id"`
+	PayeeName string     `db:"-"`
+	// Splits divide the amount across categories; empty when the whole
+	// amount counts towards Category.
+	Splits []Split      `db:"-"`
+	Fields []FieldValue `db:"-"`
 }
 
 type PageData struct {
 	Balance          float64
+	Assets           float64
+	Liabilities      float64
 	MonthIncome      float64
 	MonthExpense     float64
 	Transactions     []TransactionInfo
@@ -42,6 +62,31 @@ type PageData struct {
 	AvailableSources []string
 	ShowSourcesPopup bool
 	AllSources       []Account
+	SourceTypes      []string
+	UpcomingCardDues []CardStatement
+	NetWorthChart    template.HTML
+	Forecast         []SourceForecast
+	// TransactionForm and CategorySuggestions refill the Add Transaction
+	// form after "Suggest Category" was pressed.
+	TransactionForm     AddTransactionRequest
+	CategorySuggestions []CategorySuggestion
+	// PossibleDuplicates are shown for confirmation when the transaction
+	// being added looks like one already entered.
+	PossibleDuplicates []TransactionInfo
+	// MissedSubscriptions are subscriptions whose expected charge is overdue.
+	MissedSubscriptions []Subscription
+	// LowBalances are the sources below their low-balance threshold.
+	LowBalances []Account
+	// Alerts are the newest spending alerts not yet dismissed.
+	Alerts []Alert
+	// TransactionFilter narrows AllTransactions; CustomFields and KnownTags
+	// fill its drop-downs.
+	TransactionFilter TransactionFilter
+	CustomFields      []CustomField
+	KnownTags         []string
+	CSRFToken         string
+	UndoBatch         string
+	UndoCount         int
 }
 
 type AddTransactionRequest struct {
@@ -50,9 +95,57 @@ type AddTransactionRequest struct {
 	CategoryName    string `schema:"category_name"`
 	SourceName      string `schema:"source_name"`
 	TransactionDate string `schema:"transaction_date"`
+	Category        string `schema:"category"`
+	Notes           string `schema:"notes"`
+	// Tags is a comma separated list.
+	Tags string `schema:"tags"`
+	// Fields are custom field values by field name; only the API sets them.
+	Fields map[string]string `schema:"-"`
+	// AllowDuplicate adds the transaction even if it looks like one that
+	// was already entered.
+	AllowDuplicate bool `schema:"allow_duplicate"`
+	// Splits divide the transaction across categories. They must add up
+	// to the amount.
+	Splits []SplitLine `schema:"-"`
 }
+
+// APITransactionRequest is the JSON body accepted by POST /api/transactions.
+type APITransactionRequest struct {
+	Amount          float64           `json:"amount"`
+	CategoryType    string            `json:"transaction_type"`
+	CategoryName    string            `json:"category_name"`
+	SourceName      string            `json:"source_name"`
+	TransactionDate string            `json:"transaction_date"`
+	Category        string            `json:"category"`
+	Notes           string            `json:"notes"`
+	Tags            []string          `json:"tags"`
+	Fields          map[string]string `json:"fields"`
+	AllowDuplicate  bool              `json:"allow_duplicate"`
+	Splits          []SplitLine       `json:"splits"`
+}
+
 type AddSourceRequest struct {
-	SourceName string `schema:"source_name"`
-	Balance    string `schema:"balance"`
-	FormErrors map[string]string
+	SourceName  string `schema:"source_name"`
+	Balance     string `schema:"balance"`
+	SourceType  string `schema:"source_type"`
+	CreditLimit string `schema:"credit_limit"`
+	FormErrors  map[string]string
+}
+
+type TrashedTransaction struct {
+	TransactionInfo
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+type TrashedSource struct {
+	Account
+	DeletedAt time.Time `db:"deleted_at"`
+}
+
+type TrashPageData struct {
+	Transactions  []TrashedTransaction
+	Sources       []TrashedSource
+	RetentionDays int
+	FormErrors    map[string]string
+	CSRFToken     string
 }
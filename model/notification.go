@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification channels.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+var NotificationChannels = []string{ChannelEmail, ChannelWebhook}
+
+// Notification events recipients can subscribe to.
+const (
+	EventAlert        = "alert"
+	EventLowBalance   = "low_balance"
+	EventUpcomingBill = "upcoming_bill"
+	// EventTest is sent on request from the notifications page, whatever the
+	// recipient's preferences.
+	EventTest = "test"
+)
+
+var NotificationEvents = []string{EventAlert, EventLowBalance, EventUpcomingBill}
+
+// ValidNotificationEvent reports whether recipients can subscribe to event.
+func ValidNotificationEvent(event string) bool {
+	return slices.Contains(NotificationEvents, event)
+}
+
+// Notification statuses. A pending notification is retried with backoff
+// until it is sent or runs out of attempts and fails.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// NotificationRecipient is someone notifications are sent to, with the
+// events they want by email and by webhook.
+type NotificationRecipient struct {
+	RecipientID uuid.UUID `db:"recipient_id" json:"recipient_id"`
+	Name        string    `db:"name" json:"name"`
+	Email       string    `db:"email" json:"email"`
+	WebhookURL  string    `db:"webhook_url" json:"webhook_url"`
+	// WebhookSecret signs the webhook requests so the receiver can check
+	// they came from here.
+	WebhookSecret string    `db:"webhook_secret" json:"-"`
+	EmailEvents   []string  `db:"email_events" json:"email_events"`
+	WebhookEvents []string  `db:"webhook_events" json:"webhook_events"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// Wants reports whether the recipient wants event over channel.
+func (r NotificationRecipient) Wants(channel, event string) bool {
+	switch channel {
+	case ChannelEmail:
+		return r.Email != "" && slices.Contains(r.EmailEvents, event)
+	case ChannelWebhook:
+		return r.WebhookURL != "" && slices.Contains(r.WebhookEvents, event)
+	}
+	return false
+}
+
+// Notification is one message in the outbox, for one recipient over one
+// channel.
+type Notification struct {
+	NotificationID uuid.UUID       `db:"notification_id" json:"notification_id"`
+	RecipientID    uuid.UUID       `db:"recipient_id" json:"recipient_id"`
+	RecipientName  string          `db:"-" json:"recipient_name"`
+	Channel        string          `db:"channel" json:"channel"`
+	Event          string          `db:"event" json:"event"`
+	Subject        string          `db:"subject" json:"subject"`
+	Body           string          `db:"body" json:"body"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	LastError      string          `db:"last_error" json:"last_error"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	SentAt         *time.Time      `db:"sent_at" json:"sent_at"`
+	// Address is the recipient's email address or webhook URL, and Secret
+	// their webhook secret; both are only filled in for delivery.
+	Address string `db:"-" json:"-"`
+	Secret  string `db:"-" json:"-"`
+}
+
+// NotificationDelivery is one attempt at delivering a notification.
+type NotificationDelivery struct {
+	DeliveryID     uuid.UUID `db:"delivery_id" json:"delivery_id"`
+	NotificationID uuid.UUID `db:"notification_id" json:"notification_id"`
+	RecipientName  string    `db:"-" json:"recipient_name"`
+	Channel        string    `db:"-" json:"channel"`
+	Subject        string    `db:"-" json:"subject"`
+	Attempt        int       `db:"attempt" json:"attempt"`
+	Success        bool      `db:"success" json:"success"`
+	Error          string    `db:"error" json:"error"`
+	DurationMS     int       `db:"duration_ms" json:"duration_ms"`
+	AttemptedAt    time.Time `db:"attempted_at" json:"attempted_at"`
+}
+
+type AddRecipientRequest struct {
+	Name       string `schema:"name"`
+	Email      string `schema:"email"`
+	WebhookURL string `schema:"webhook_url"`
+}
+
+// RecipientPreferencesRequest is the preferences form of one recipient: the
+// events ticked for each channel.
+type RecipientPreferencesRequest struct {
+	RecipientID   string   `schema:"recipient_id"`
+	EmailEvents   []string `schema:"email_events"`
+	WebhookEvents []string `schema:"webhook_events"`
+}
+
+type NotificationsPageData struct {
+	Recipients    []NotificationRecipient
+	Notifications []Notification
+	Deliveries    []NotificationDelivery
+	Events        []string
+	// Channels are the channels the dispatcher can deliver over; email is
+	// missing when no SMTP server is configured.
+	Channels   []string
+	TestQueued int
+	FormErrors map[string]string
+	CSRFToken  string
+}
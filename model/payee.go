@@ -0,0 +1,90 @@
+package model
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alias sources: learned aliases are recorded when a transaction is matched
+// or assigned to a payee, manual ones are added on the payee page.
+const (
+	AliasLearned = "learned"
+	AliasManual  = "manual"
+)
+
+// Payee is the merchant or person behind transactions. Raw transaction names
+// map to a payee through its aliases.
+type Payee struct {
+	PayeeID         uuid.UUID `db:"payee_id" json:"payee_id"`
+	Name            string    `db:"name" json:"name"`
+	DefaultCategory string    `db:"default_category" json:"default_category"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+	// Totals over the payee's transactions, leaving out transfers and the
+	// trash.
+	Transactions int        `db:"-" json:"transactions"`
+	Spent        float64    `db:"-" json:"spent"`
+	Received     float64    `db:"-" json:"received"`
+	LastDate     *time.Time `db:"-" json:"last_date"`
+	Aliases      int        `db:"-" json:"aliases"`
+}
+
+// PayeeAlias maps the normalized form of a raw name to a payee.
+type PayeeAlias struct {
+	Alias     string    `db:"alias" json:"alias"`
+	PayeeID   uuid.UUID `db:"payee_id" json:"payee_id"`
+	Source    string    `db:"source" json:"source"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type CreatePayeeRequest struct {
+	Name            string `schema:"name"`
+	DefaultCategory string `schema:"default_category"`
+}
+
+type UpdatePayeeRequest struct {
+	PayeeID         string `schema:"payee_id"`
+	Name            string `schema:"name"`
+	DefaultCategory string `schema:"default_category"`
+}
+
+type PayeeAliasRequest struct {
+	PayeeID string `schema:"payee_id"`
+	Alias   string `schema:"alias"`
+}
+
+// MergePayeesRequest merges the selected payees into the one kept.
+type MergePayeesRequest struct {
+	Keep     string   `schema:"keep"`
+	PayeeIDs []string `schema:"payee_id"`
+}
+
+// AssignPayeeRequest moves a transaction to an existing payee, or to a new
+// one when NewPayee is given.
+type AssignPayeeRequest struct {
+	TransactionID string `schema:"transaction_id"`
+	PayeeID       string `schema:"payee_id"`
+	NewPayee      string `schema:"new_payee"`
+}
+
+type PayeesPageData struct {
+	Payees []Payee
+	// Unassigned counts the transactions without a payee, such as those
+	// entered before payees existed.
+	Unassigned  int
+	Matched     int
+	ShowMatched bool
+	FormErrors  map[string]string
+	CSRFToken   string
+}
+
+type PayeePageData struct {
+	Payee        Payee
+	Aliases      []PayeeAlias
+	Months       []PeriodTotal
+	MonthlyChart template.HTML
+	Transactions []TransactionInfo
+	FormErrors   map[string]string
+	CSRFToken    string
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"html/template"
+	"time"
+)
+
+// ReportFilter is the date range of the reports page, as YYYY-MM-DD.
+type ReportFilter struct {
+	From string `schema:"from"`
+	To   string `schema:"to"`
+}
+
+// CategoryTotal is the income or expense of one category in a period. Share
+// is the percentage of all income or all expense in the period.
+type CategoryTotal struct {
+	CategoryType string  `json:"transaction_type"`
+	Category     string  `json:"category"`
+	Total        float64 `json:"total"`
+	Count        int     `json:"count"`
+	Share        float64 `json:"share"`
+}
+
+// PeriodTotal is income, expense and savings rate for one month, or for the
+// whole report range.
+type PeriodTotal struct {
+	Period      time.Time `json:"period"`
+	Income      float64   `json:"income"`
+	Expense     float64   `json:"expense"`
+	Net         float64   `json:"net"`
+	SavingsRate *float64  `json:"savings_rate"`
+}
+
+// YearOverYear compares one calendar month with the same month a year earlier.
+type YearOverYear struct {
+	Month           time.Month `json:"month"`
+	Expense         float64    `json:"expense"`
+	PreviousExpense float64    `json:"previous_expense"`
+	Income          float64    `json:"income"`
+	PreviousIncome  float64    `json:"previous_income"`
+	// ExpenseChange is the percentage change of expense, nil when there was
+	// no expense the year before.
+	ExpenseChange *float64 `json:"expense_change"`
+}
+
+// NameTotal is the total spent on one transaction name, such as a merchant.
+type NameTotal struct {
+	Name  string  `json:"name"`
+	Total float64 `json:"total"`
+	Count int     `json:"count"`
+}
+
+type Report struct {
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	Totals       PeriodTotal     `json:"totals"`
+	Categories   []CategoryTotal `json:"categories"`
+	Months       []PeriodTotal   `json:"months"`
+	Year         int             `json:"year"`
+	YearOverYear []YearOverYear  `json:"year_over_year"`
+	TopNames     []NameTotal     `json:"top_names"`
+	Tags         []TagTotal      `json:"tags"`
+	Fields       []FieldTotal    `json:"fields"`
+}
+
+type ReportsPageData struct {
+	Report        Report
+	Filter        ReportFilter
+	CategoryChart template.HTML
+	MonthlyChart  template.HTML
+	CSRFToken     string
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Rule categorizes new transactions. Every condition that is set must match;
+// the first enabled rule by priority (lowest first) that matches is applied.
+type Rule struct {
+	RuleID   uuid.UUID `db:"rule_id"`
+	Name     string    `db:"name"`
+	Priority int       `db:"priority"`
+	Enabled  bool      `db:"enabled"`
+
+	// Conditions. NameContains is case-insensitive, NameRegex is a Go regular
+	// expression matched against the name as it was entered.
+	NameContains string   `db:"name_contains"`
+	NameRegex    string   `db:"name_regex"`
+	MinAmount    *float64 `db:"min_amount"`
+	MaxAmount    *float64 `db:"max_amount"`
+	SourceName   string   `db:"source_name"`
+	CategoryType string   `db:"category_type"`
+
+	// Actions.
+	SetCategory  string   `db:"set_category"`
+	RenameTo     string   `db:"rename_to"`
+	AddTags      []string `db:"add_tags"`
+	MarkTransfer bool     `db:"mark_transfer"`
+
+	CreatedAt time.Time `db:"created_at"`
+	// Matches is how many transactions the rule was last applied to.
+	Matches int `db:"-"`
+}
+
+type CreateRuleRequest struct {
+	Name         string `schema:"name"`
+	Priority     int    `schema:"priority"`
+	NameContains string `schema:"name_contains"`
+	NameRegex    string `schema:"name_regex"`
+	MinAmount    string `schema:"min_amount"`
+	MaxAmount    string `schema:"max_amount"`
+	SourceName   string `schema:"source_name"`
+	CategoryType string `schema:"transaction_type"`
+	SetCategory  string `schema:"set_category"`
+	RenameTo     string `schema:"rename_to"`
+	// AddTags is a comma separated list.
+	AddTags      string `schema:"add_tags"`
+	MarkTransfer bool   `schema:"mark_transfer"`
+}
+
+// ApplyRulesRequest re-applies the rules to transactions dated in a range.
+type ApplyRulesRequest struct {
+	From string `schema:"from"`
+	To   string `schema:"to"`
+}
+
+type RulesPageData struct {
+	Rules            []Rule
+	AvailableSources []string
+	FormErrors       map[string]string
+	Applied          int
+	ShowApplied      bool
+	CSRFToken        string
+}
@@ -0,0 +1,117 @@
+package model
+
+import "time"
+
+type InactiveSource struct {
+	Account
+	DeletedAt *time.Time `db:"deleted_at"`
+	ClosedAt  *time.Time `db:"closed_at"`
+}
+
+// Status describes why the source is inactive.
+func (s InactiveSource) Status() string {
+	switch {
+	case s.ClosedAt != nil:
+		return "closed"
+	case s.DeletedAt != nil:
+		return "in trash"
+	default:
+		return "inactive"
+	}
+}
+
+type RenameSourceRequest struct {
+	SourceName string `schema:"source_name"`
+	NewName    string `schema:"new_name"`
+}
+
+// ThresholdRequest sets the low-balance threshold of a source; an empty
+// threshold removes it.
+type ThresholdRequest struct {
+	SourceName string `schema:"source_name"`
+	Threshold  string `schema:"threshold"`
+}
+
+type CloseSourceRequest struct {
+	SourceName string `schema:"source_name"`
+	TransferTo string `schema:"transfer_to"`
+}
+
+type TransferRequest struct {
+	FromSource      string `schema:"from_source"`
+	ToSource        string `schema:"to_source"`
+	Amount          string `schema:"amount"`
+	TransactionDate string `schema:"transaction_date"`
+}
+
+type SourcesPageData struct {
+	ActiveSources   []Account
+	InactiveSources []InactiveSource
+	FormErrors      map[string]string
+	CSRFToken       string
+}
+
+// Source types. Credit cards and loans are liabilities: they carry a credit
+// limit and their balance may go negative down to minus that limit. All other
+// types are assets and may never go negative.
+const (
+	SourceChecking   = "checking"
+	SourceSavings    = "savings"
+	SourceCash       = "cash"
+	SourceCreditCard = "credit_card"
+	SourceLoan       = "loan"
+)
+
+// SourceTypes lists every source type, for form drop-downs.
+var SourceTypes = []string{SourceChecking, SourceSavings, SourceCash, SourceCreditCard, SourceLoan}
+
+func ValidSourceType(t string) bool {
+	for _, s := range SourceTypes {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLiability reports whether sources of this type represent money owed.
+func IsLiability(sourceType string) bool {
+	return sourceType == SourceCreditCard || sourceType == SourceLoan
+}
+
+func (a Account) IsLiability() bool {
+	return IsLiability(a.SourceType)
+}
+
+// IsBankAccount reports whether sources of this type are bank accounts,
+// which bills such as card payments are paid from.
+func IsBankAccount(sourceType string) bool {
+	return sourceType == SourceChecking || sourceType == SourceSavings
+}
+
+func (a Account) IsBankAccount() bool {
+	return IsBankAccount(a.SourceType)
+}
+
+// Available returns how much can be spent from the source: the balance, plus
+// the credit limit for liabilities.
+func (a Account) Available() float64 {
+	if a.IsLiability() && a.CreditLimit != nil {
+		return a.Balance + *a.CreditLimit
+	}
+	return a.Balance
+}
+
+// BelowThreshold reports whether the available funds are below the
+// low-balance threshold.
+func (a Account) BelowThreshold() bool {
+	return a.LowBalanceThreshold != nil && a.Available() < *a.LowBalanceThreshold
+}
+
+type Summary struct {
+	Assets       float64
+	Liabilities  float64
+	NetWorth     float64
+	MonthIncome  float64
+	MonthExpense float64
+}
@@ -0,0 +1,34 @@
+package model
+
+import "github.com/google/uuid"
+
+// Split is one line of a transaction divided across categories. The lines of
+// a split transaction add up to its amount; the balance effect stays on the
+// transaction itself.
+type Split struct {
+	SplitID       uuid.UUID `db:"split_id"`
+	TransactionID uuid.UUID `db:"transaction_id"`
+	Category      string    `db:"category"`
+	Amount        float64   `db:"amount"`
+}
+
+// SplitLine is a split line as submitted, before it is stored.
+type SplitLine struct {
+	Category string  `json:"category"`
+	Amount   float64 `json:"amount"`
+}
+
+// SaveSplitsRequest is the split form: one category and amount per line.
+// Lines left empty are ignored.
+type SaveSplitsRequest struct {
+	TransactionID string   `schema:"transaction_id"`
+	Categories    []string `schema:"split_category"`
+	Amounts       []string `schema:"split_amount"`
+}
+
+type SplitPageData struct {
+	Transaction TransactionInfo
+	Lines       []Split
+	FormErrors  map[string]string
+	CSRFToken   string
+}
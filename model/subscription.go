@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription cadences.
+const (
+	CadenceWeekly    = "weekly"
+	CadenceBiweekly  = "every two weeks"
+	CadenceMonthly   = "monthly"
+	CadenceQuarterly = "quarterly"
+	CadenceYearly    = "yearly"
+)
+
+// Subscription statuses. A subscription is missed when its expected charge
+// is overdue, and ended when no charge came for two cycles, which usually
+// means it was cancelled.
+const (
+	SubscriptionActive = "active"
+	SubscriptionMissed = "missed"
+	SubscriptionEnded  = "ended"
+)
+
+// PriceChange is a charge of a different amount than the one before.
+type PriceChange struct {
+	Date time.Time `json:"date"`
+	From float64   `json:"from"`
+	To   float64   `json:"to"`
+}
+
+// Subscription is a recurring charge detected in the expense history of a
+// payee.
+type Subscription struct {
+	PayeeID      uuid.UUID     `json:"payee_id"`
+	Payee        string        `json:"payee"`
+	Category     string        `json:"category"`
+	SourceName   string        `json:"source_name"`
+	Cadence      string        `json:"cadence"`
+	Charges      int           `json:"charges"`
+	FirstDate    time.Time     `json:"first_date"`
+	LastDate     time.Time     `json:"last_date"`
+	LastAmount   float64       `json:"last_amount"`
+	NextExpected time.Time     `json:"next_expected"`
+	AnnualCost   float64       `json:"annual_cost"`
+	PriceChanges []PriceChange `json:"price_changes"`
+	Status       string        `json:"status"`
+}
+
+type SubscriptionsPageData struct {
+	Subscriptions []Subscription
+	// AnnualCost is the yearly cost of the subscriptions that have not ended.
+	AnnualCost float64
+	Missed     int
+}
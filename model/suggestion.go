@@ -0,0 +1,24 @@
+package model
+
+// CategorySuggestion is a category the classifier learned from past
+// transactions, with the probability that it is the right one.
+type CategorySuggestion struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Percent returns the confidence as a whole percentage, for display.
+func (s CategorySuggestion) Percent() int {
+	return int(s.Confidence*100 + 0.5)
+}
+
+// CategorySuggestions is the response of GET /api/category-suggestions.
+// HoldoutAccuracy is the share of held-out transactions the classifier
+// categorized correctly when it was last retrained, nil when there were too
+// few transactions to measure it.
+type CategorySuggestions struct {
+	Suggestions     []CategorySuggestion `json:"suggestions"`
+	TrainedOn       int                  `json:"trained_on"`
+	HoldoutAccuracy *float64             `json:"holdout_accuracy"`
+	HoldoutSize     int                  `json:"holdout_size"`
+}
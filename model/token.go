@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Token scopes, from least to most privileged. A token with a higher scope
+// may do everything a lower scope allows.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeRank = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// ValidScope reports whether s is one of the known token scopes.
+func ValidScope(s string) bool {
+	_, ok := scopeRank[s]
+	return ok
+}
+
+type APIToken struct {
+	TokenID    uuid.UUID  `db:"token_id"`
+	Name       string     `db:"name"`
+	Scopes     []string   `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+// HasScope reports whether the token grants the given scope, either directly
+// or through a more privileged one.
+func (t APIToken) HasScope(scope string) bool {
+	want := scopeRank[scope]
+	for _, s := range t.Scopes {
+		if scopeRank[s] >= want && want > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateTokenRequest struct {
+	Name   string   `schema:"name"`
+	Scopes []string `schema:"scopes"`
+}
+
+type TokensPageData struct {
+	Tokens   []APIToken
+	NewToken string
+	// AllowAdmin reports whether admin tokens may be created from the page,
+	// which needs ADMIN_SECRET to be set.
+	AllowAdmin bool
+	FormErrors map[string]string
+	CSRFToken  string
+}
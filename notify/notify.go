@@ -0,0 +1,70 @@
+// Package notify delivers notifications from the outbox over pluggable
+// channels: email through an SMTP server and signed HTTP webhooks. Queuing,
+// retries and the delivery log live in the repository; this package only
+// sends one notification at a time.
+package notify
+
+import (
+	"errors"
+	"finance-tracker/model"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrNoChannel = errors.New("notify: channel is not configured")
+
+// Channel sends a notification to its address.
+type Channel interface {
+	Send(n model.Notification) error
+}
+
+// Retry schedule: a failed notification is retried after 1, 2, 4, ...
+// minutes, at most maxBackoff apart, until MaxAttempts attempts failed.
+const (
+	MaxAttempts  = 8
+	firstBackoff = time.Minute
+	maxBackoff   = 6 * time.Hour
+)
+
+// Backoff is how long to wait after the given number of failed attempts.
+func Backoff(attempts int) time.Duration {
+	d := firstBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Dispatcher sends notifications over the channel they were queued for.
+type Dispatcher struct {
+	channels map[string]Channel
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{channels: make(map[string]Channel)}
+}
+
+// Register makes a channel available under name, one of
+// model.NotificationChannels.
+func (d *Dispatcher) Register(name string, c Channel) {
+	d.channels[name] = c
+}
+
+// Channels lists the names of the registered channels.
+func (d *Dispatcher) Channels() []string {
+	var names []string
+	for name := range d.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *Dispatcher) Send(n model.Notification) error {
+	c, ok := d.channels[n.Channel]
+	if !ok {
+		return fmt.Errorf("%s: %w", n.Channel, ErrNoChannel)
+	}
+	return c.Send(n)
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"bytes"
+	"finance-tracker/model"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP sends notifications as plain text email. Without a username it sends
+// unauthenticated, which is what local SMTP stand-ins such as MailHog or
+// Mailpit expect; STARTTLS is used whenever the server offers it.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTP) Send(n model.Notification) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if err := smtp.SendMail(addr, auth, s.From, []string{n.Address}, s.message(n)); err != nil {
+		return fmt.Errorf("sending email to %s: %w", n.Address, err)
+	}
+	return nil
+}
+
+// message builds the email with CRLF line endings, as SMTP requires.
+func (s SMTP) message(n model.Notification) []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", s.From)
+	header("To", n.Address)
+	header("Subject", mime.QEncoding.Encode("utf-8", n.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@finance-tracker>", n.NotificationID))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(n.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
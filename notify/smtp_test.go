@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bufio"
+	"finance-tracker/model"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// smtpStub is a minimal SMTP server that accepts one message and hands its
+// DATA, exactly as received on the wire, to the data channel.
+func smtpStub(t *testing.T) (host string, port int, data <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost ESMTP stub")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(strings.TrimPrefix(line, "."))
+				}
+				ch <- msg.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, ch
+}
+
+func TestSMTPSend(t *testing.T) {
+	host, port, data := smtpStub(t)
+	s := SMTP{Host: host, Port: port, From: "tracker@example.com"}
+	n := model.Notification{
+		NotificationID: uuid.MustParse("6f1c2b8e-4d3a-4e5f-9a7b-1c2d3e4f5a6b"),
+		Address:        "alex@example.com",
+		Subject:        "Budget exceeded: Café",
+		Body:           "Groceries is over budget.\nSpent 420.50 of 400.00.\r\n.hidden line",
+	}
+	if err := s.Send(n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg := <-data
+	head, body, ok := strings.Cut(msg, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no blank line between headers and body:\n%q", msg)
+	}
+	for _, want := range []string{
+		"From: tracker@example.com",
+		"To: alex@example.com",
+		"Subject: =?utf-8?q?Budget_exceeded:_Caf=C3=A9?=",
+		"Message-ID: <6f1c2b8e-4d3a-4e5f-9a7b-1c2d3e4f5a6b@finance-tracker>",
+		"MIME-Version: 1.0",
+		`Content-Type: text/plain; charset="utf-8"`,
+		"Content-Transfer-Encoding: 8bit",
+	} {
+		if !strings.Contains("\r\n"+head+"\r\n", "\r\n"+want+"\r\n") {
+			t.Errorf("missing header %q in:\n%s", want, head)
+		}
+	}
+	if !strings.Contains(head, "\r\nDate: ") {
+		t.Errorf("missing Date header in:\n%s", head)
+	}
+	if want := "Groceries is over budget.\r\nSpent 420.50 of 400.00.\r\n.hidden line\r\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+// The client on the wire rewrites bare line feeds itself, so the CRLF line
+// endings are checked on the message as built.
+func TestSMTPMessageLineEndings(t *testing.T) {
+	msg := string(SMTP{From: "tracker@example.com"}.message(model.Notification{
+		Address: "alex@example.com",
+		Subject: "Weekly summary",
+		Body:    "line one\nline two\r\nline three",
+	}))
+	if strings.Contains(strings.ReplaceAll(msg, "\r\n", ""), "\n") {
+		t.Errorf("message has bare line feeds:\n%q", msg)
+	}
+	if !strings.HasSuffix(msg, "\r\n\r\nline one\r\nline two\r\nline three\r\n") {
+		t.Errorf("message body is not CRLF terminated:\n%q", msg)
+	}
+	if !strings.Contains(msg, "\r\nSubject: Weekly summary\r\n") {
+		t.Errorf("ASCII subject should not be encoded:\n%q", msg)
+	}
+}
+
+func TestSMTPSendFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	err = SMTP{Host: addr.IP.String(), Port: addr.Port, From: "tracker@example.com"}.
+		Send(model.Notification{Address: "alex@example.com", Subject: "x", Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "alex@example.com") {
+		t.Errorf("Send to a closed port = %v, want an error naming the recipient", err)
+	}
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"finance-tracker/model"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook headers. The signature is "sha256=" followed by the hex HMAC-SHA256
+// of the timestamp, a dot and the request body, keyed with the recipient's
+// webhook secret. Receivers should recompute it and reject old timestamps.
+const (
+	HeaderEvent     = "X-Finance-Event"
+	HeaderDelivery  = "X-Finance-Delivery"
+	HeaderTimestamp = "X-Finance-Timestamp"
+	HeaderSignature = "X-Finance-Signature"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Webhook POSTs notifications as JSON to the recipient's URL. Any status
+// other than 2xx counts as a failed attempt.
+type Webhook struct {
+	Client *http.Client
+}
+
+func NewWebhook() Webhook {
+	return Webhook{Client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// webhookPayload is the JSON body of a webhook request.
+type webhookPayload struct {
+	ID        uuid.UUID       `json:"id"`
+	Event     string          `json:"event"`
+	Subject   string          `json:"subject"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (w Webhook) Send(n model.Notification) error {
+	data := n.Payload
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	body, err := json.Marshal(webhookPayload{
+		ID: n.NotificationID, Event: n.Event, Subject: n.Subject, Body: n.Body, Data: data, CreatedAt: n.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.Address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "finance-tracker-webhook")
+	req.Header.Set(HeaderEvent, n.Event)
+	req.Header.Set(HeaderDelivery, n.NotificationID.String())
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(n.Secret, timestamp, body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of a webhook request.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
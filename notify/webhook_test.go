@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"encoding/json"
+	"finance-tracker/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got := Sign("secret", "1700000000", []byte(`{"a":1}`)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"a":1}`)) == want {
+		t.Error("signatures with different secrets match")
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := model.Notification{
+		NotificationID: uuid.New(),
+		Event:          "budget.exceeded",
+		Subject:        "Budget exceeded",
+		Body:           "Groceries is over budget.",
+		Payload:        json.RawMessage(`{"category":"Groceries"}`),
+		CreatedAt:      time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Address:        srv.URL + "/hook",
+		Secret:         "s3cret",
+	}
+	if err := (Webhook{Client: srv.Client()}).Send(n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/hook" {
+		t.Errorf("got %s %s, want POST /hook", got.Method, got.URL.Path)
+	}
+	if ct := got.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if e := got.Header.Get(HeaderEvent); e != n.Event {
+		t.Errorf("%s = %q, want %q", HeaderEvent, e, n.Event)
+	}
+	if d := got.Header.Get(HeaderDelivery); d != n.NotificationID.String() {
+		t.Errorf("%s = %q, want %q", HeaderDelivery, d, n.NotificationID)
+	}
+	timestamp := got.Header.Get(HeaderTimestamp)
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("%s = %q, want the current unix time", HeaderTimestamp, timestamp)
+	}
+	if sig := got.Header.Get(HeaderSignature); sig != Sign(n.Secret, timestamp, body) {
+		t.Errorf("%s = %q does not verify against the body", HeaderSignature, sig)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, body)
+	}
+	if payload.ID != n.NotificationID || payload.Event != n.Event || payload.Subject != n.Subject ||
+		payload.Body != n.Body || string(payload.Data) != string(n.Payload) || !payload.CreatedAt.Equal(n.CreatedAt) {
+		t.Errorf("payload = %+v, want the notification", payload)
+	}
+}
+
+func TestWebhookSendEmptyPayload(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	if err := (Webhook{Client: srv.Client()}).Send(model.Notification{Address: srv.URL}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if !strings.Contains(string(body), `"data":{}`) {
+		t.Errorf("body = %s, want an empty data object", body)
+	}
+}
+
+func TestWebhookSendFailure(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusBadRequest, http.StatusInternalServerError} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "/elsewhere")
+			http.Error(w, "nope", status)
+		}))
+		client := srv.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+		err := (Webhook{Client: client}).Send(model.Notification{Address: srv.URL})
+		if err == nil || !strings.Contains(err.Error(), strconv.Itoa(status)) {
+			t.Errorf("status %d: Send = %v, want an error with the status", status, err)
+		}
+		srv.Close()
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if err := (Webhook{Client: http.DefaultClient}).Send(model.Notification{Address: srv.URL}); err == nil {
+		t.Error("Send to a closed server succeeded")
+	}
+}
@@ -0,0 +1,58 @@
+// Package payee turns the raw names of transactions, as entered or as a bank
+// exports them, into keys that identify the merchant behind them, so that
+// "SQ *BLUE BOTTLE 0423" and "Blue Bottle #17" end up at the same payee.
+package payee
+
+import (
+	"strings"
+	"unicode"
+)
+
+// noise are words card processors and banks add to merchant names that say
+// nothing about the merchant itself.
+var noise = map[string]bool{
+	"pos":        true,
+	"debit":      true,
+	"purchase":   true,
+	"card":       true,
+	"visa":       true,
+	"mastercard": true,
+	"ach":        true,
+	"sq":         true,
+	"tst":        true,
+	"www":        true,
+	"com":        true,
+}
+
+// Normalize returns the alias key of a raw name: lower case words with
+// punctuation, noise words and anything containing a digit (store numbers,
+// card references, dates) removed. A name made only of such words keeps
+// them, so that it still has a key.
+func Normalize(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var words []string
+	for _, w := range fields {
+		if noise[w] || strings.ContainsFunc(w, unicode.IsDigit) {
+			continue
+		}
+		words = append(words, w)
+	}
+	if len(words) == 0 {
+		words = fields
+	}
+	return strings.Join(words, " ")
+}
+
+// DisplayName is the name given to a payee created from a raw name: its
+// normalized words, capitalized.
+func DisplayName(name string) string {
+	words := strings.Fields(Normalize(name))
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
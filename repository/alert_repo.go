@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/anomaly"
+	"finance-tracker/events"
+	"finance-tracker/model"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrAlertNotFound = errors.New("repository: alert not found")
+
+// anomalyHistoryMonths is how far back baselines look.
+const anomalyHistoryMonths = 12
+
+const alertColumns = "alert_id, kind, transaction_id, payee_id, COALESCE(category, ''), message, amount, baseline, period, created_at, dismissed_at"
+
+func scanAlerts(rows pgx.Rows, err error) ([]model.Alert, error) {
+	if err != nil {
+		log.Printf("ERROR querying alerts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []model.Alert
+	for rows.Next() {
+		var a model.Alert
+		if err := rows.Scan(&a.AlertID, &a.Kind, &a.TransactionID, &a.PayeeID, &a.Category, &a.Message,
+			&a.Amount, &a.Baseline, &a.Period, &a.CreatedAt, &a.DismissedAt); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// GetAlerts returns the newest alerts first; dismissed ones only when asked
+// for. A limit of zero or less returns them all.
+func GetAlerts(db *pgx.Conn, includeDismissed bool, limit int) ([]model.Alert, error) {
+	query := `SELECT ` + alertColumns + ` FROM ALERT
+		WHERE $1 OR dismissed_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT NULLIF($2, 0);`
+	if limit < 0 {
+		limit = 0
+	}
+	return scanAlerts(db.Query(context.Background(), query, includeDismissed, limit))
+}
+
+// DismissAlert hides an alert from the dashboard. Dismissing it again is a
+// no-op.
+func DismissAlert(db *pgx.Conn, actor model.Actor, id uuid.UUID) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	if err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM ALERT WHERE alert_id = $1);`, id).Scan(&exists); err != nil {
+		log.Printf("ERROR checking alert: %v", err)
+		return err
+	}
+	if !exists {
+		return ErrAlertNotFound
+	}
+	tag, err := tx.Exec(context.Background(),
+		`UPDATE ALERT SET dismissed_at = NOW() WHERE alert_id = $1 AND dismissed_at IS NULL;`, id)
+	if err != nil {
+		log.Printf("ERROR dismissing alert: %v", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if err = recordAudit(tx, actor, AuditAlertDismiss, "alert", id.String(), nil, nil); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// recordAnomalies checks a newly added expense against the history of its
+// payee and categories, records an alert for whatever looks off, publishes
+// events.AlertRaised for it and returns the alerts recorded.
+func recordAnomalies(tx pgx.Tx, t model.TransactionInfo) ([]model.Alert, error) {
+	var alerts []model.Alert
+	large, err := checkLargeExpense(tx, t)
+	if err != nil {
+		return nil, err
+	}
+	if large != nil {
+		alerts = append(alerts, *large)
+	}
+	spikes, err := checkCategorySpikes(tx, t)
+	if err != nil {
+		return nil, err
+	}
+	alerts = append(alerts, spikes...)
+
+	var recorded []model.Alert
+	for _, a := range alerts {
+		err := tx.QueryRow(context.Background(),
+			`INSERT INTO ALERT (kind, transaction_id, payee_id, category, message, amount, baseline, period)
+			 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)
+			 ON CONFLICT DO NOTHING
+			 RETURNING alert_id, created_at;`,
+			a.Kind, a.TransactionID, a.PayeeID, a.Category, a.Message, a.Amount, a.Baseline, a.Period).
+			Scan(&a.AlertID, &a.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The category was already flagged this month.
+			continue
+		}
+		if err != nil {
+			log.Printf("ERROR inserting alert: %v", err)
+			return nil, err
+		}
+		log.Printf("Alert: %s", a.Message)
+		if err := events.Publish(tx, events.AlertRaised{Alert: a}); err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, a)
+	}
+	return recorded, nil
+}
+
+// checkLargeExpense compares the amount with past expenses of the same payee,
+// or of the same category when the payee has too few of them.
+func checkLargeExpense(q queryer, t model.TransactionInfo) (*model.Alert, error) {
+	from := t.TransactionDate.AddDate(0, -anomalyHistoryMonths, 0)
+	baselineQuery := `
+		SELECT COUNT(*), COALESCE(AVG(amount), 0), COALESCE(STDDEV_POP(amount), 0)
+		FROM TRANSACTION
+		WHERE deleted_at IS NULL
+		  AND transfer_id IS NULL
+		  AND LOWER(category_type) = 'expense'
+		  AND transaction_id <> $1
+		  AND transaction_date >= $2::date
+		  AND transaction_date <= $3::date
+		  AND `
+
+	var b anomaly.Baseline
+	where := ""
+	if t.PayeeID != nil {
+		err := q.QueryRow(context.Background(), baselineQuery+`payee_id = $4;`, t.TransactionID, from, t.TransactionDate, *t.PayeeID).
+			Scan(&b.Count, &b.Mean, &b.StdDev)
+		if err != nil {
+			log.Printf("ERROR querying payee baseline: %v", err)
+			return nil, err
+		}
+		if b.Count >= anomaly.MinSamples {
+			if err := q.QueryRow(context.Background(), `SELECT name FROM PAYEE WHERE payee_id = $1;`, *t.PayeeID).Scan(&where); err != nil {
+				log.Printf("ERROR querying payee: %v", err)
+				return nil, err
+			}
+			where = "at " + where
+		}
+	}
+	category := t.Category
+	if category == "" {
+		category = t.CategoryName
+	}
+	if where == "" {
+		err := q.QueryRow(context.Background(), baselineQuery+`COALESCE(NULLIF(category, ''), category_name) = $4;`, t.TransactionID, from, t.TransactionDate, category).
+			Scan(&b.Count, &b.Mean, &b.StdDev)
+		if err != nil {
+			log.Printf("ERROR querying category baseline: %v", err)
+			return nil, err
+		}
+		where = "in " + category
+	}
+	if !b.Unusual(t.Amount) {
+		return nil, nil
+	}
+	return &model.Alert{
+		Kind:          model.AlertLargeExpense,
+		TransactionID: &t.TransactionID,
+		PayeeID:       t.PayeeID,
+		Category:      category,
+		Message: fmt.Sprintf("%s: %.2f %s on %s is %.1fx the usual %.2f",
+			t.CategoryName, t.Amount, where, t.TransactionDate.Format("2006-01-02"), b.Ratio(t.Amount), b.Mean),
+		Amount:   t.Amount,
+		Baseline: b.Mean,
+	}, nil
+}
+
+// checkCategorySpikes compares the month's spend in each category of the
+// transaction, split lines included, with the months before.
+func checkCategorySpikes(q queryer, t model.TransactionInfo) ([]model.Alert, error) {
+	month := time.Date(t.TransactionDate.Year(), t.TransactionDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+	rows, err := q.Query(context.Background(), `
+		SELECT DISTINCT COALESCE(S.category, NULLIF(T.category, ''), T.category_name)
+		FROM TRANSACTION T
+			LEFT JOIN TRANSACTION_SPLIT S ON S.transaction_id = T.transaction_id
+		WHERE T.transaction_id = $1;`, t.TransactionID)
+	if err != nil {
+		log.Printf("ERROR querying transaction categories: %v", err)
+		return nil, err
+	}
+	var categories []string
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			rows.Close()
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var alerts []model.Alert
+	for _, category := range categories {
+		rows, err := q.Query(context.Background(), `
+			SELECT date_trunc('month', T.transaction_date)::date, SUM(COALESCE(S.amount, T.amount))
+			FROM TRANSACTION T
+				LEFT JOIN TRANSACTION_SPLIT S ON S.transaction_id = T.transaction_id
+			WHERE T.deleted_at IS NULL
+			  AND T.transfer_id IS NULL
+			  AND LOWER(T.category_type) = 'expense'
+			  AND COALESCE(S.category, NULLIF(T.category, ''), T.category_name) = $1
+			  AND T.transaction_date >= $2::date
+			  AND T.transaction_date < $3::date
+			GROUP BY 1;`, category, month.AddDate(0, -anomalyHistoryMonths, 0), month.AddDate(0, 1, 0))
+		if err != nil {
+			log.Printf("ERROR querying monthly category spend: %v", err)
+			return nil, err
+		}
+		var current float64
+		var past []float64
+		for rows.Next() {
+			var m time.Time
+			var total float64
+			if err := rows.Scan(&m, &total); err != nil {
+				rows.Close()
+				log.Printf("ERROR scanning row: %v\n", err)
+				return nil, err
+			}
+			if m.Equal(month) {
+				current = total
+			} else {
+				past = append(past, total)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		usual, spike := anomaly.Spike(current, past)
+		if !spike {
+			continue
+		}
+		period := month
+		alerts = append(alerts, model.Alert{
+			Kind:          model.AlertCategorySpike,
+			TransactionID: &t.TransactionID,
+			Category:      category,
+			Message: fmt.Sprintf("%s spending in %s is %.2f, %.1fx the usual %.2f a month",
+				category, month.Format("January 2006"), current, current/usual, usual),
+			Amount:   current,
+			Baseline: usual,
+			Period:   &period,
+		})
+	}
+	return alerts, nil
+}
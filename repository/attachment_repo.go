@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrAttachmentNotFound = errors.New("repository: attachment not found")
+
+const attachmentColumns = "attachment_id, transaction_id, file_name, content_type, size, sha256, has_thumbnail, created_at"
+
+func scanAttachments(rows pgx.Rows, err error) ([]model.Attachment, error) {
+	if err != nil {
+		log.Printf("ERROR querying attachments: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []model.Attachment
+	for rows.Next() {
+		var a model.Attachment
+		err := rows.Scan(&a.AttachmentID, &a.TransactionID, &a.FileName, &a.ContentType, &a.Size, &a.SHA256, &a.HasThumbnail, &a.CreatedAt)
+		if err != nil {
+			log.Printf("ERROR scanning attachment: %v", err)
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// AddAttachment records a file stored for a transaction that is not in the
+// trash.
+func AddAttachment(db *pgx.Conn, actor model.Actor, a model.Attachment) (model.Attachment, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return a, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM TRANSACTION WHERE transaction_id = $1 AND deleted_at IS NULL);`, a.TransactionID).Scan(&exists)
+	if err != nil {
+		log.Printf("ERROR checking transaction: %v", err)
+		return a, err
+	}
+	if !exists {
+		return a, ErrTransactionNotFound
+	}
+
+	added, err := scanAttachments(tx.Query(context.Background(), `
+		INSERT INTO ATTACHMENT (transaction_id, file_name, content_type, size, sha256, has_thumbnail)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+attachmentColumns+`;`,
+		a.TransactionID, a.FileName, a.ContentType, a.Size, a.SHA256, a.HasThumbnail))
+	if err != nil {
+		return a, err
+	}
+	a = added[0]
+	if err = recordAudit(tx, actor, AuditAttachmentUpload, "attachment", a.AttachmentID.String(), nil, a); err != nil {
+		return a, err
+	}
+	return a, tx.Commit(context.Background())
+}
+
+// GetAttachments returns the attachments of a transaction, oldest first.
+func GetAttachments(db *pgx.Conn, transactionID uuid.UUID) ([]model.Attachment, error) {
+	return scanAttachments(db.Query(context.Background(),
+		`SELECT `+attachmentColumns+` FROM ATTACHMENT WHERE transaction_id = $1 ORDER BY created_at, file_name;`, transactionID))
+}
+
+// GetAttachment returns one attachment. Attachments of trashed transactions
+// are still returned, so they stay downloadable until the trash is purged.
+func GetAttachment(db *pgx.Conn, id uuid.UUID) (model.Attachment, error) {
+	attachments, err := scanAttachments(db.Query(context.Background(),
+		`SELECT `+attachmentColumns+` FROM ATTACHMENT WHERE attachment_id = $1;`, id))
+	if err != nil {
+		return model.Attachment{}, err
+	}
+	if len(attachments) == 0 {
+		return model.Attachment{}, ErrAttachmentNotFound
+	}
+	return attachments[0], nil
+}
+
+// DeleteAttachments removes attachments. Their files stay on disk until the
+// cleanup job finds them unreferenced, since other attachments may share the
+// same content.
+func DeleteAttachments(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	deleted, err := scanAttachments(tx.Query(context.Background(),
+		`DELETE FROM ATTACHMENT WHERE attachment_id = ANY($1) RETURNING `+attachmentColumns+`;`, ids))
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range deleted {
+		if err = recordAudit(tx, actor, AuditAttachmentDelete, "attachment", a.AttachmentID.String(), a, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), tx.Commit(context.Background())
+}
+
+// GetAttachmentHashes returns the hash of every stored file that is still
+// referenced. Purging a transaction from the trash deletes its attachments,
+// which leaves their files unreferenced.
+func GetAttachmentHashes(db *pgx.Conn) (map[string]bool, error) {
+	rows, err := db.Query(context.Background(), `SELECT DISTINCT sha256 FROM ATTACHMENT;`)
+	if err != nil {
+		log.Printf("ERROR querying attachment hashes: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]bool)
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		hashes[h] = true
+	}
+	return hashes, rows.Err()
+}
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"finance-tracker/model"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidAuditFilter = errors.New("repository: invalid audit log filter")
+
+// Audit actions recorded by the repository.
+const (
+	AuditSourceCreate      = "source.create"
+	AuditSourceReactivate  = "source.reactivate"
+	AuditSourceDeactivate  = "source.deactivate"
+	AuditSourceBalance     = "source.balance"
+	AuditTransactionCreate = "transaction.create"
+	AuditTransactionDelete = "transaction.delete"
+
+	AuditSourceRestore      = "source.restore"
+	AuditSourcePurge        = "source.purge"
+	AuditTransactionRestore = "transaction.restore"
+	AuditTransactionPurge   = "transaction.purge"
+
+	AuditSourceRename = "source.rename"
+	AuditSourceClose  = "source.close"
+
+	AuditSourceThreshold = "source.threshold"
+
+	AuditCardSettings = "card.settings"
+	AuditLoanTerms    = "loan.terms"
+	AuditLoanPayment  = "loan.payment"
+
+	AuditRecurringCreate = "recurring.create"
+	AuditRecurringDelete = "recurring.delete"
+
+	AuditGoalCreate   = "goal.create"
+	AuditGoalDelete   = "goal.delete"
+	AuditGoalAllocate = "goal.allocate"
+
+	AuditRuleCreate       = "rule.create"
+	AuditRuleUpdate       = "rule.update"
+	AuditRuleDelete       = "rule.delete"
+	AuditTransactionRules = "transaction.rules"
+
+	AuditDuplicateMerge   = "duplicate.merge"
+	AuditDuplicateDismiss = "duplicate.dismiss"
+
+	AuditTransactionSplit = "transaction.split"
+
+	AuditFieldCreate        = "field.create"
+	AuditFieldDelete        = "field.delete"
+	AuditTransactionDetails = "transaction.details"
+
+	AuditAttachmentUpload = "attachment.upload"
+	AuditAttachmentDelete = "attachment.delete"
+
+	AuditPayeeCreate      = "payee.create"
+	AuditPayeeUpdate      = "payee.update"
+	AuditPayeeAlias       = "payee.alias"
+	AuditPayeeMerge       = "payee.merge"
+	AuditTransactionPayee = "transaction.payee"
+
+	AuditAlertDismiss = "alert.dismiss"
+
+	AuditRecipientCreate   = "recipient.create"
+	AuditRecipientUpdate   = "recipient.update"
+	AuditRecipientDelete   = "recipient.delete"
+	AuditNotificationRetry = "notification.retry"
+)
+
+// AuditActions lists every action, for filter drop-downs.
+var AuditActions = []string{
+	AuditSourceCreate,
+	AuditSourceReactivate,
+	AuditSourceDeactivate,
+	AuditSourceBalance,
+	AuditTransactionCreate,
+	AuditTransactionDelete,
+	AuditSourceRestore,
+	AuditSourcePurge,
+	AuditTransactionRestore,
+	AuditTransactionPurge,
+	AuditSourceRename,
+	AuditSourceClose,
+	AuditSourceThreshold,
+	AuditCardSettings,
+	AuditLoanTerms,
+	AuditLoanPayment,
+	AuditRecurringCreate,
+	AuditRecurringDelete,
+	AuditGoalCreate,
+	AuditGoalDelete,
+	AuditGoalAllocate,
+	AuditRuleCreate,
+	AuditRuleUpdate,
+	AuditRuleDelete,
+	AuditTransactionRules,
+	AuditDuplicateMerge,
+	AuditDuplicateDismiss,
+	AuditTransactionSplit,
+	AuditFieldCreate,
+	AuditFieldDelete,
+	AuditTransactionDetails,
+	AuditAttachmentUpload,
+	AuditAttachmentDelete,
+	AuditPayeeCreate,
+	AuditPayeeUpdate,
+	AuditPayeeAlias,
+	AuditPayeeMerge,
+	AuditTransactionPayee,
+	AuditAlertDismiss,
+	AuditRecipientCreate,
+	AuditRecipientUpdate,
+	AuditRecipientDelete,
+	AuditNotificationRetry,
+}
+
+const defaultAuditLimit = 200
+
+// queryer is satisfied by both *pgx.Conn and pgx.Tx, so read helpers can be
+// used inside and outside of a database transaction.
+type queryer interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// auditJSON marshals a row snapshot, mapping a missing row to SQL NULL.
+func auditJSON(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "null" {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// recordAudit appends one entry to the audit log inside the caller's
+// transaction, so the entry is only kept if the change itself is committed.
+func recordAudit(tx pgx.Tx, actor model.Actor, action, entityType, entityID string, before, after any) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO AUDIT_LOG
+				(action, entity_type, entity_id, actor, origin_ip, user_agent, before_value, after_value)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	_, err = tx.Exec(context.Background(), query, action, entityType, entityID,
+		actor.Name, actor.OriginIP, actor.UserAgent, beforeJSON, afterJSON)
+	if err != nil {
+		log.Printf("ERROR inserting audit entry: %v", err)
+		return err
+	}
+	return nil
+}
+
+// accountColumns are the ACCOUNT columns read into a model.Account, in the
+// order expected by accountScanTargets.
+const accountColumns = "source_name, balance, created_at, is_active, source_type, credit_limit, low_balance_threshold"
+
+func accountScanTargets(a *model.Account) []any {
+	return []any{&a.SourceName, &a.Balance, &a.CreatedAt, &a.IsActive, &a.SourceType, &a.CreditLimit, &a.LowBalanceThreshold}
+}
+
+// getAccount returns a snapshot of one account row, or nil if it does not exist.
+func getAccount(q queryer, name string) (*model.Account, error) {
+	var a model.Account
+	query := `SELECT ` + accountColumns + ` FROM account WHERE source_name = $1;`
+	err := q.QueryRow(context.Background(), query, name).Scan(accountScanTargets(&a)...)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func GetAuditLog(db *pgx.Conn, f model.AuditFilter) ([]model.AuditEntry, error) {
+	var conditions []string
+	var args []any
+	addCondition := func(format string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if f.Action != "" {
+		addCondition("action = $%d", f.Action)
+	}
+	if f.EntityType != "" {
+		addCondition("entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != "" {
+		addCondition("entity_id = $%d", f.EntityID)
+	}
+	if f.Actor != "" {
+		addCondition("actor = $%d", f.Actor)
+	}
+	if f.From != "" {
+		from, err := time.Parse("2006-01-02", f.From)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 'from' must be formatted as YYYY-MM-DD", ErrInvalidAuditFilter)
+		}
+		addCondition("created_at >= $%d", from)
+	}
+	if f.To != "" {
+		to, err := time.Parse("2006-01-02", f.To)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 'to' must be formatted as YYYY-MM-DD", ErrInvalidAuditFilter)
+		}
+		addCondition("created_at < $%d", to.AddDate(0, 0, 1))
+	}
+
+	query := `SELECT audit_id, action, entity_type, entity_id, actor,
+					 COALESCE(origin_ip, ''), COALESCE(user_agent, ''),
+					 before_value, after_value, created_at
+			  FROM AUDIT_LOG`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d;", len(args))
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		log.Printf("ERROR querying audit log: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		err := rows.Scan(&e.AuditID, &e.Action, &e.EntityType, &e.EntityID, &e.Actor,
+			&e.OriginIP, &e.UserAgent, &e.Before, &e.After, &e.CreatedAt)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"finance-tracker/model"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetUpcomingBills returns the payments expected in [from, to], soonest
+// first: occurrences of recurring expenses, what is left to pay on credit
+// card statements and the next charges of active subscriptions.
+func GetUpcomingBills(db *pgx.Conn, from, to time.Time) ([]model.Bill, error) {
+	var bills []model.Bill
+
+	recurring, err := GetRecurringTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range recurring {
+		if !strings.EqualFold(r.CategoryType, "expense") {
+			continue
+		}
+		for _, d := range r.Occurrences(from, to) {
+			bills = append(bills, model.Bill{
+				Kind: model.BillRecurring, Name: r.Name, Amount: r.Amount, SourceName: r.SourceName,
+				DueDate: d, Frequency: r.Frequency, ScheduleStart: r.StartDate, Key: "recurring:" + r.RecurringID.String(),
+			})
+		}
+	}
+
+	dues, err := GetUpcomingCardDues(db, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range dues {
+		if s.DueDate.After(to) {
+			continue
+		}
+		bills = append(bills, model.Bill{
+			Kind: model.BillCardPayment, Name: s.SourceName + " statement", Amount: s.RemainingDue, SourceName: s.SourceName,
+			DueDate: s.DueDate, Key: "card:" + s.SourceName,
+		})
+	}
+
+	subscriptions, err := GetSubscriptions(db, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subscriptions {
+		if s.Status != model.SubscriptionActive || s.NextExpected.Before(from) || s.NextExpected.After(to) {
+			continue
+		}
+		bills = append(bills, model.Bill{
+			Kind: model.BillSubscription, Name: s.Payee, Amount: s.LastAmount, SourceName: s.SourceName,
+			DueDate: s.NextExpected, Frequency: s.Cadence, ScheduleStart: s.NextExpected, Key: "subscription:" + s.PayeeID.String(),
+		})
+	}
+
+	sort.SliceStable(bills, func(i, j int) bool { return bills[i].DueDate.Before(bills[j].DueDate) })
+	return bills, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidCalendarFeed = errors.New("repository: the calendar feed token is invalid or has been revoked")
+var ErrEmptyFeedName = errors.New("repository: the calendar feed name cant be empty")
+
+// calendarTokenPrefix tells calendar feed tokens apart from API tokens.
+const calendarTokenPrefix = "cal_"
+
+const calendarFeedColumns = "feed_id, name, created_at, last_fetched_at, revoked_at"
+
+func calendarFeedScanTargets(f *model.CalendarFeed) []any {
+	return []any{&f.FeedID, &f.Name, &f.CreatedAt, &f.LastFetchedAt, &f.RevokedAt}
+}
+
+// CreateCalendarFeed generates a new feed token and stores its hash. The
+// plaintext is returned once and cannot be recovered afterwards.
+func CreateCalendarFeed(db *pgx.Conn, req model.CreateCalendarFeedRequest) (string, model.CalendarFeed, error) {
+	var f model.CalendarFeed
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", f, ErrEmptyFeedName
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", f, err
+	}
+	plaintext := calendarTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	query := `INSERT INTO CALENDAR_FEED (name, token_hash)
+			  VALUES ($1, $2)
+			  RETURNING ` + calendarFeedColumns + `;`
+	err := db.QueryRow(context.Background(), query, name, hashToken(plaintext)).Scan(calendarFeedScanTargets(&f)...)
+	if err != nil {
+		log.Printf("ERROR inserting calendar feed: %v", err)
+		return "", f, err
+	}
+	return plaintext, f, nil
+}
+
+func GetCalendarFeeds(db *pgx.Conn) ([]model.CalendarFeed, error) {
+	query := `SELECT ` + calendarFeedColumns + ` FROM CALENDAR_FEED ORDER BY created_at DESC;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying calendar feeds: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []model.CalendarFeed
+	for rows.Next() {
+		var f model.CalendarFeed
+		if err := rows.Scan(calendarFeedScanTargets(&f)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+func RevokeCalendarFeeds(db *pgx.Conn, ids []uuid.UUID) (int64, error) {
+	query := "UPDATE CALENDAR_FEED SET revoked_at = NOW() WHERE feed_id = ANY($1) AND revoked_at IS NULL"
+	result, err := db.Exec(context.Background(), query, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// AuthenticateCalendarFeed looks up an active feed by its plaintext token and
+// records the time it was fetched.
+func AuthenticateCalendarFeed(db *pgx.Conn, plaintext string) (model.CalendarFeed, error) {
+	var f model.CalendarFeed
+	if !strings.HasPrefix(plaintext, calendarTokenPrefix) {
+		return f, ErrInvalidCalendarFeed
+	}
+
+	query := `UPDATE CALENDAR_FEED SET last_fetched_at = NOW()
+			  WHERE token_hash = $1 AND revoked_at IS NULL
+			  RETURNING ` + calendarFeedColumns + `;`
+	err := db.QueryRow(context.Background(), query, hashToken(plaintext)).Scan(calendarFeedScanTargets(&f)...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return f, ErrInvalidCalendarFeed
+		}
+		log.Printf("ERROR authenticating calendar feed: %v", err)
+		return f, err
+	}
+	return f, nil
+}
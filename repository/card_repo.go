@@ -0,0 +1,309 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotACreditCard = errors.New("repository: the source is not a credit card")
+var ErrInvalidStatementDay = errors.New("repository: statement and due days must be between 1 and 31")
+var ErrInvalidMinPayment = errors.New("repository: the minimum payment settings are invalid")
+var ErrNothingDue = errors.New("repository: nothing is due on this card")
+var ErrNotABankAccount = errors.New("repository: card payments must come from a checking or savings account")
+
+// Defaults used for cards whose minimum payment has not been configured.
+const (
+	defaultMinPaymentPercent = 5.0
+	defaultMinPaymentAmount  = 0.0
+)
+
+// GetCreditCards returns every active credit card with its statement
+// settings. Cards that were never configured have a StatementDay of 0.
+func GetCreditCards(db *pgx.Conn) ([]model.CreditCard, error) {
+	query := `SELECT A.source_name, A.balance, A.credit_limit,
+					 COALESCE(C.statement_day, 0), COALESCE(C.due_day, 0),
+					 COALESCE(C.min_payment_percent, $1), COALESCE(C.min_payment_amount, $2)
+			  FROM ACCOUNT A
+				LEFT JOIN CREDIT_CARD C ON C.source_name = A.source_name
+			  WHERE A.source_type = 'credit_card' AND A.is_active = TRUE
+			  ORDER BY A.source_name;`
+	rows, err := db.Query(context.Background(), query, defaultMinPaymentPercent, defaultMinPaymentAmount)
+	if err != nil {
+		log.Printf("ERROR querying credit cards: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []model.CreditCard
+	for rows.Next() {
+		var c model.CreditCard
+		err := rows.Scan(&c.SourceName, &c.Balance, &c.CreditLimit, &c.StatementDay, &c.DueDay, &c.MinPaymentPercent, &c.MinPaymentAmount)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+func SaveCardSettings(db *pgx.Conn, actor model.Actor, req model.CardSettingsRequest) error {
+	if req.StatementDay < 1 || req.StatementDay > 31 || req.DueDay < 1 || req.DueDay > 31 {
+		return ErrInvalidStatementDay
+	}
+	percent, amount := defaultMinPaymentPercent, defaultMinPaymentAmount
+	var err error
+	if req.MinPaymentPercent != "" {
+		if percent, err = strconv.ParseFloat(req.MinPaymentPercent, 64); err != nil || percent < 0 || percent > 100 {
+			return ErrInvalidMinPayment
+		}
+	}
+	if req.MinPaymentAmount != "" {
+		if amount, err = strconv.ParseFloat(req.MinPaymentAmount, 64); err != nil || amount < 0 {
+			return ErrInvalidMinPayment
+		}
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	account, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if account == nil || account.SourceType != model.SourceCreditCard {
+		return ErrNotACreditCard
+	}
+
+	before, err := getCardSettings(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO CREDIT_CARD (source_name, statement_day, due_day, min_payment_percent, min_payment_amount)
+			  VALUES ($1, $2, $3, $4, $5)
+			  ON CONFLICT (source_name) DO UPDATE SET
+				statement_day = EXCLUDED.statement_day,
+				due_day = EXCLUDED.due_day,
+				min_payment_percent = EXCLUDED.min_payment_percent,
+				min_payment_amount = EXCLUDED.min_payment_amount;`
+	_, err = tx.Exec(context.Background(), query, req.SourceName, req.StatementDay, req.DueDay, percent, amount)
+	if err != nil {
+		log.Printf("ERROR saving card settings: %v", err)
+		return err
+	}
+	after, err := getCardSettings(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditCardSettings, "source", req.SourceName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func getCardSettings(q queryer, name string) (*model.CardSettingsRequest, error) {
+	var c model.CardSettingsRequest
+	var percent, amount float64
+	query := `SELECT source_name, statement_day, due_day, min_payment_percent, min_payment_amount
+			  FROM CREDIT_CARD WHERE source_name = $1;`
+	err := q.QueryRow(context.Background(), query, name).Scan(&c.SourceName, &c.StatementDay, &c.DueDay, &percent, &amount)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c.MinPaymentPercent = strconv.FormatFloat(percent, 'f', -1, 64)
+	c.MinPaymentAmount = strconv.FormatFloat(amount, 'f', -1, 64)
+	return &c, nil
+}
+
+// dayInMonth returns the given day of the month, clamped to the last day for
+// shorter months (a statement day of 31 closes on Feb 28).
+func dayInMonth(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// closingOnOrBefore returns the last statement closing date on or before t.
+func closingOnOrBefore(statementDay int, t time.Time) time.Time {
+	c := dayInMonth(t.Year(), t.Month(), statementDay)
+	if c.After(t) {
+		prev := t.AddDate(0, 0, -t.Day())
+		c = dayInMonth(prev.Year(), prev.Month(), statementDay)
+	}
+	return c
+}
+
+// dueDateFor returns the first due day after a statement closes.
+func dueDateFor(closing time.Time, dueDay int) time.Time {
+	d := dayInMonth(closing.Year(), closing.Month(), dueDay)
+	if !d.After(closing) {
+		next := closing.AddDate(0, 0, -closing.Day()+1).AddDate(0, 1, 0)
+		d = dayInMonth(next.Year(), next.Month(), dueDay)
+	}
+	return d
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// minimumPayment is the larger of the card's percentage of the statement
+// balance and its fixed minimum, but never more than the statement balance.
+func minimumPayment(card model.CreditCard, owed float64) float64 {
+	if owed <= 0 {
+		return 0
+	}
+	minimum := math.Max(owed*card.MinPaymentPercent/100, card.MinPaymentAmount)
+	return roundCents(math.Min(minimum, owed))
+}
+
+// GetCardStatements computes the most recent statement cycles of a card from
+// its transactions, newest first. The balance at each closing date is
+// reconstructed by undoing every transaction recorded after it.
+func GetCardStatements(db *pgx.Conn, card model.CreditCard, cycles int, today time.Time) ([]model.CardStatement, error) {
+	if card.StatementDay == 0 {
+		return nil, nil
+	}
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := `SELECT
+				COALESCE(SUM(CASE WHEN transaction_date >= $3
+					THEN (CASE WHEN LOWER(category_type) = 'expense' THEN -amount ELSE amount END) ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN transaction_date >= $2 AND transaction_date < $3
+					AND LOWER(category_type) = 'expense' THEN amount ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN transaction_date >= $2 AND transaction_date < $3
+					AND LOWER(category_type) = 'income' THEN amount ELSE 0 END), 0),
+				COALESCE(SUM(CASE WHEN transaction_date >= $3 AND transaction_date < $4
+					AND LOWER(category_type) = 'income' THEN amount ELSE 0 END), 0)
+			  FROM TRANSACTION
+			  WHERE source_name = $1 AND deleted_at IS NULL;`
+
+	var statements []model.CardStatement
+	closing := closingOnOrBefore(card.StatementDay, today)
+	for i := 0; i < cycles; i++ {
+		previous := closingOnOrBefore(card.StatementDay, closing.AddDate(0, 0, -1))
+		s := model.CardStatement{
+			SourceName:  card.SourceName,
+			PeriodStart: previous.AddDate(0, 0, 1),
+			ClosingDate: closing,
+			DueDate:     dueDateFor(closing, card.DueDay),
+		}
+
+		var deltaAfterClosing float64
+		err := db.QueryRow(context.Background(), query, card.SourceName, s.PeriodStart, closing.AddDate(0, 0, 1), s.DueDate.AddDate(0, 0, 1)).
+			Scan(&deltaAfterClosing, &s.NewCharges, &s.Credits, &s.PaidSinceClosing)
+		if err != nil {
+			log.Printf("ERROR computing card statement: %v", err)
+			return nil, err
+		}
+
+		s.StatementBalance = roundCents(math.Max(0, -(card.Balance - deltaAfterClosing)))
+		s.MinimumPayment = minimumPayment(card, s.StatementBalance)
+		s.RemainingDue = roundCents(math.Max(0, s.StatementBalance-s.PaidSinceClosing))
+		statements = append(statements, s)
+		closing = previous
+	}
+	return statements, nil
+}
+
+// GetUpcomingCardDues returns the latest statement of every configured card
+// that still has something to pay and is not yet past its due date, soonest
+// first.
+func GetUpcomingCardDues(db *pgx.Conn, today time.Time) ([]model.CardStatement, error) {
+	cards, err := GetCreditCards(db)
+	if err != nil {
+		return nil, err
+	}
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	var dues []model.CardStatement
+	for _, card := range cards {
+		statements, err := GetCardStatements(db, card, 1, today)
+		if err != nil {
+			return nil, err
+		}
+		if len(statements) == 0 {
+			continue
+		}
+		latest := statements[0]
+		if latest.RemainingDue > 0 && !latest.DueDate.Before(today) {
+			dues = append(dues, latest)
+		}
+	}
+	sort.Slice(dues, func(i, j int) bool { return dues[i].DueDate.Before(dues[j].DueDate) })
+	return dues, nil
+}
+
+// PayCard records a card payment as a transfer from a checking or savings
+// account to the card. Without an amount it pays whatever is left of the latest statement.
+func PayCard(db *pgx.Conn, actor model.Actor, req model.PayCardRequest) (uuid.UUID, error) {
+	account, err := getAccount(db, req.CardName)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if account == nil || account.SourceType != model.SourceCreditCard {
+		return uuid.Nil, ErrNotACreditCard
+	}
+	from, err := getAccount(db, req.FromSource)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if from == nil {
+		return uuid.Nil, ErrSourceNotFound
+	}
+	if !from.IsBankAccount() {
+		return uuid.Nil, ErrNotABankAccount
+	}
+
+	var amount float64
+	if req.Amount != "" {
+		amount, err = strconv.ParseFloat(req.Amount, 64)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	} else {
+		cards, err := GetCreditCards(db)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		for _, card := range cards {
+			if card.SourceName != req.CardName {
+				continue
+			}
+			statements, err := GetCardStatements(db, card, 1, time.Now())
+			if err != nil {
+				return uuid.Nil, err
+			}
+			if len(statements) > 0 {
+				amount = statements[0].RemainingDue
+			}
+		}
+		if amount <= 0 {
+			return uuid.Nil, ErrNothingDue
+		}
+	}
+
+	return TransferBetweenSources(db, actor, model.TransferRequest{
+		FromSource:      req.FromSource,
+		ToSource:        req.CardName,
+		Amount:          strconv.FormatFloat(amount, 'f', -1, 64),
+		TransactionDate: req.TransactionDate,
+	})
+}
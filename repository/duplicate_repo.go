@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/dedupe"
+	"finance-tracker/model"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrPossibleDuplicate = errors.New("repository: this looks like a transaction that was already entered")
+var ErrInvalidMerge = errors.New("repository: only transactions with the same source, type and amount can be merged, keeping one of them")
+
+// DuplicateWindowDays is how many days apart two entries of the same
+// transaction may be dated.
+const DuplicateWindowDays = 3
+
+// findDuplicates returns the transactions t looks like a second entry of:
+// same source, type and amount, dated at most DuplicateWindowDays apart and
+// with a similar name, either as entered or as renamed by a rule. Transfers
+// are never reported.
+func findDuplicates(q queryer, t newTransaction) ([]model.TransactionInfo, error) {
+	query := `SELECT ` + transactionColumns + `, COALESCE(raw_name, category_name)
+			  FROM TRANSACTION
+			  WHERE deleted_at IS NULL AND transfer_id IS NULL
+			    AND source_name = $1 AND amount = $2 AND LOWER(category_type) = LOWER($3)
+			    AND transaction_date::date BETWEEN $4::date - $5::int AND $4::date + $5::int
+			  ORDER BY transaction_date, created_at;`
+	rows, err := q.Query(context.Background(), query, t.SourceName, t.Amount, t.CategoryType, t.TransactionDate, DuplicateWindowDays)
+	if err != nil {
+		log.Printf("ERROR querying possible duplicates: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []model.TransactionInfo
+	for rows.Next() {
+		var d model.TransactionInfo
+		var entered string
+		if err := rows.Scan(append(transactionScanTargets(&d), &entered)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		if dedupe.Similar(entered, t.CategoryName) || dedupe.Similar(d.CategoryName, t.CategoryName) {
+			duplicates = append(duplicates, d)
+		}
+	}
+	return duplicates, rows.Err()
+}
+
+// FindPossibleDuplicates returns the transactions that make AddTransactions
+// refuse req with ErrPossibleDuplicate.
+func FindPossibleDuplicates(db *pgx.Conn, req model.AddTransactionRequest) ([]model.TransactionInfo, error) {
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil {
+		return nil, err
+	}
+	return findDuplicates(db, newTransaction{
+		CategoryType:    req.CategoryType,
+		CategoryName:    req.CategoryName,
+		Amount:          amount,
+		TransactionDate: req.TransactionDate,
+		SourceName:      req.SourceName,
+	})
+}
+
+// GetDuplicateClusters finds groups of existing transactions that look like
+// the same transaction entered more than once, leaving out pairs that were
+// dismissed as not being duplicates. The most recent clusters come first.
+func GetDuplicateClusters(db *pgx.Conn) ([]model.DuplicateCluster, error) {
+	query := `SELECT a.transaction_id, COALESCE(a.raw_name, a.category_name), a.category_name,
+				     b.transaction_id, COALESCE(b.raw_name, b.category_name), b.category_name
+			  FROM TRANSACTION a
+			  JOIN TRANSACTION b
+			    ON b.source_name = a.source_name
+			   AND b.amount = a.amount
+			   AND LOWER(b.category_type) = LOWER(a.category_type)
+			   AND a.transaction_id < b.transaction_id
+			   AND ABS(b.transaction_date::date - a.transaction_date::date) <= $1
+			  WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+			    AND a.transfer_id IS NULL AND b.transfer_id IS NULL
+			    AND NOT EXISTS (SELECT 1 FROM DUPLICATE_DISMISSAL d
+			                    WHERE d.transaction_a = a.transaction_id AND d.transaction_b = b.transaction_id)
+			  ORDER BY GREATEST(a.transaction_date, b.transaction_date) DESC;`
+	rows, err := db.Query(context.Background(), query, DuplicateWindowDays)
+	if err != nil {
+		log.Printf("ERROR querying duplicate pairs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs [][2]uuid.UUID
+	for rows.Next() {
+		var a, b uuid.UUID
+		var enteredA, nameA, enteredB, nameB string
+		if err := rows.Scan(&a, &enteredA, &nameA, &b, &enteredB, &nameB); err != nil {
+			log.Printf("ERROR scanning duplicate pair: %v", err)
+			return nil, err
+		}
+		if dedupe.Similar(enteredA, enteredB) || dedupe.Similar(nameA, nameB) {
+			pairs = append(pairs, [2]uuid.UUID{a, b})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	groups := dedupe.Clusters(pairs)
+	var ids []uuid.UUID
+	for _, g := range groups {
+		ids = append(ids, g...)
+	}
+	transactions, err := scanTransactionInfos(db.Query(context.Background(),
+		`SELECT `+transactionColumns+` FROM TRANSACTION WHERE transaction_id = ANY($1) ORDER BY transaction_date, created_at;`, ids))
+	if err != nil {
+		log.Printf("ERROR querying duplicate transactions: %v", err)
+		return nil, err
+	}
+
+	// Members of a cluster are listed oldest first.
+	clusterOf := make(map[uuid.UUID]int)
+	for i, g := range groups {
+		for _, id := range g {
+			clusterOf[id] = i
+		}
+	}
+	clusters := make([]model.DuplicateCluster, len(groups))
+	for _, t := range transactions {
+		i := clusterOf[t.TransactionID]
+		t.CategoryType = strings.ToTitle(t.CategoryType)
+		clusters[i].Transactions = append(clusters[i].Transactions, t)
+	}
+	return clusters, nil
+}
+
+// checkMergeable returns the transactions to merge, or ErrInvalidMerge unless
+// they all exist, are not in the trash, keep is one of them and they share
+// source, type and amount.
+func checkMergeable(q queryer, keep uuid.UUID, ids []uuid.UUID) ([]model.TransactionInfo, error) {
+	if len(ids) < 2 || !slices.Contains(ids, keep) {
+		return nil, ErrInvalidMerge
+	}
+	transactions, err := scanTransactionInfos(q.Query(context.Background(),
+		`SELECT `+transactionColumns+` FROM TRANSACTION WHERE transaction_id = ANY($1) AND deleted_at IS NULL;`, ids))
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) != len(ids) {
+		return nil, ErrInvalidMerge
+	}
+	first := transactions[0]
+	for _, t := range transactions[1:] {
+		if t.SourceName != first.SourceName || t.Amount != first.Amount || !strings.EqualFold(t.CategoryType, first.CategoryType) {
+			return nil, ErrInvalidMerge
+		}
+	}
+	return transactions, nil
+}
+
+// MergeDuplicates keeps one transaction of a duplicate cluster and moves the
+// others to the trash, reversing their balance effect. The kept transaction
+// takes over the category of a removed one if it has none, and the tags of
+// all of them. It returns the trash batch and the number of transactions
+// removed.
+func MergeDuplicates(db *pgx.Conn, actor model.Actor, keep uuid.UUID, ids []uuid.UUID) (uuid.UUID, int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return uuid.Nil, 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	transactions, err := checkMergeable(tx, keep, ids)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	var kept model.TransactionInfo
+	var removed []uuid.UUID
+	for _, t := range transactions {
+		if t.TransactionID == keep {
+			kept = t
+		} else {
+			removed = append(removed, t.TransactionID)
+		}
+	}
+	category, tags := kept.Category, slices.Clone(kept.Tags)
+	for _, t := range transactions {
+		if category == "" {
+			category = t.Category
+		}
+		for _, tag := range t.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	batch := uuid.New()
+	n, err := trashTransactions(tx, actor, removed, batch)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	var after model.TransactionInfo
+	err = tx.QueryRow(context.Background(),
+		`UPDATE TRANSACTION SET category = NULLIF($2, ''), tags = $3 WHERE transaction_id = $1 RETURNING `+transactionColumns+`;`,
+		keep, category, tags).Scan(transactionScanTargets(&after)...)
+	if err != nil {
+		log.Printf("ERROR updating merged transaction: %v", err)
+		return uuid.Nil, 0, err
+	}
+	if err = recordAudit(tx, actor, AuditDuplicateMerge, "transaction", keep.String(), kept, after); err != nil {
+		return uuid.Nil, 0, err
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return uuid.Nil, 0, err
+	}
+	return batch, n, nil
+}
+
+// DismissDuplicates records that the transactions are not duplicates of each
+// other, so GetDuplicateClusters stops pairing them.
+func DismissDuplicates(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(context.Background(),
+		`INSERT INTO DUPLICATE_DISMISSAL (transaction_a, transaction_b)
+		 SELECT a, b FROM unnest($1::uuid[]) a CROSS JOIN unnest($1::uuid[]) b
+		 WHERE a < b
+		 ON CONFLICT DO NOTHING;`, ids)
+	if err != nil {
+		log.Printf("ERROR dismissing duplicates: %v", err)
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, nil
+	}
+	if err = recordAudit(tx, actor, AuditDuplicateDismiss, "transaction", ids[0].String(), nil, map[string]any{"transaction_ids": ids}); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(context.Background())
+}
@@ -0,0 +1,399 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/rules"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidField = errors.New("repository: a custom field needs a name and a valid type")
+var ErrDuplicateField = errors.New("repository: a custom field with that name already exists")
+var ErrUnknownField = errors.New("repository: custom field not found")
+var ErrInvalidFieldValue = errors.New("repository: the value does not match the type of the custom field")
+
+// fieldValueText formats the value of a TRANSACTION_FIELD_VALUE row aliased V
+// as text, whatever the type of its field.
+const fieldValueText = `COALESCE(V.text_value, V.number_value::text, V.date_value::text, V.boolean_value::text)`
+
+const fieldColumns = "field_id, name, field_type, created_at"
+
+func scanCustomFields(rows pgx.Rows, err error) ([]model.CustomField, error) {
+	if err != nil {
+		log.Printf("ERROR querying custom fields: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []model.CustomField
+	for rows.Next() {
+		var f model.CustomField
+		if err := rows.Scan(&f.FieldID, &f.Name, &f.FieldType, &f.CreatedAt); err != nil {
+			log.Printf("ERROR scanning custom field: %v", err)
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// GetCustomFields returns every custom field by name, with how many
+// transactions have a value for it.
+func GetCustomFields(db *pgx.Conn) ([]model.CustomField, error) {
+	fields, err := scanCustomFields(db.Query(context.Background(),
+		`SELECT `+fieldColumns+` FROM CUSTOM_FIELD ORDER BY LOWER(name);`))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT V.field_id, COUNT(*)
+		FROM TRANSACTION_FIELD_VALUE V
+			JOIN TRANSACTION T ON T.transaction_id = V.transaction_id
+		WHERE T.deleted_at IS NULL
+		GROUP BY V.field_id;`)
+	if err != nil {
+		log.Printf("ERROR counting custom field uses: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	uses := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var id uuid.UUID
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		uses[id] = n
+	}
+	for i := range fields {
+		fields[i].Uses = uses[fields[i].FieldID]
+	}
+	return fields, rows.Err()
+}
+
+func CreateCustomField(db *pgx.Conn, actor model.Actor, req model.CreateFieldRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || !slices.Contains(model.FieldTypes, req.FieldType) {
+		return ErrInvalidField
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM CUSTOM_FIELD WHERE LOWER(name) = LOWER($1));`, name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateField
+	}
+
+	var f model.CustomField
+	err = tx.QueryRow(context.Background(),
+		`INSERT INTO CUSTOM_FIELD (name, field_type) VALUES ($1, $2) RETURNING `+fieldColumns+`;`, name, req.FieldType).
+		Scan(&f.FieldID, &f.Name, &f.FieldType, &f.CreatedAt)
+	if err != nil {
+		log.Printf("ERROR inserting custom field: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditFieldCreate, "field", f.FieldID.String(), nil, f); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// DeleteCustomFields removes custom fields together with their values on
+// every transaction.
+func DeleteCustomFields(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	deleted, err := scanCustomFields(tx.Query(context.Background(),
+		`DELETE FROM CUSTOM_FIELD WHERE field_id = ANY($1) RETURNING `+fieldColumns+`;`, ids))
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range deleted {
+		if err = recordAudit(tx, actor, AuditFieldDelete, "field", f.FieldID.String(), f, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), tx.Commit(context.Background())
+}
+
+// fieldColumnValues converts a submitted value into the typed columns of
+// TRANSACTION_FIELD_VALUE: text, number, date and boolean, with only the
+// column of the field's type set.
+func fieldColumnValues(fieldType, raw string) ([4]any, error) {
+	var values [4]any
+	raw = strings.TrimSpace(raw)
+	switch fieldType {
+	case model.FieldText:
+		values[0] = raw
+	case model.FieldNumber:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return values, ErrInvalidFieldValue
+		}
+		values[1] = v
+	case model.FieldDate:
+		v, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return values, ErrInvalidFieldValue
+		}
+		values[2] = v
+	case model.FieldBoolean:
+		switch strings.ToLower(raw) {
+		case "true", "yes", "on", "1":
+			values[3] = true
+		case "false", "no", "off", "0":
+			values[3] = false
+		default:
+			return values, ErrInvalidFieldValue
+		}
+	default:
+		return values, ErrUnknownField
+	}
+	return values, nil
+}
+
+// setFieldValue stores the value of a custom field on a transaction, or
+// removes it when raw is empty.
+func setFieldValue(tx pgx.Tx, transactionID uuid.UUID, field model.CustomField, raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		_, err := tx.Exec(context.Background(),
+			`DELETE FROM TRANSACTION_FIELD_VALUE WHERE transaction_id = $1 AND field_id = $2;`, transactionID, field.FieldID)
+		return err
+	}
+	values, err := fieldColumnValues(field.FieldType, raw)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(context.Background(), `
+		INSERT INTO TRANSACTION_FIELD_VALUE (transaction_id, field_id, text_value, number_value, date_value, boolean_value)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (transaction_id, field_id) DO UPDATE
+		SET text_value = EXCLUDED.text_value, number_value = EXCLUDED.number_value,
+			date_value = EXCLUDED.date_value, boolean_value = EXCLUDED.boolean_value;`,
+		transactionID, field.FieldID, values[0], values[1], values[2], values[3])
+	if err != nil {
+		log.Printf("ERROR saving custom field value: %v", err)
+	}
+	return err
+}
+
+// setFieldValuesByName stores custom field values given by field name, as
+// the API submits them. Names are matched case-insensitively.
+func setFieldValuesByName(tx pgx.Tx, actor model.Actor, transactionID uuid.UUID, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	fields, err := scanCustomFields(tx.Query(context.Background(), `SELECT `+fieldColumns+` FROM CUSTOM_FIELD;`))
+	if err != nil {
+		return err
+	}
+	for name, raw := range values {
+		i := slices.IndexFunc(fields, func(f model.CustomField) bool { return strings.EqualFold(f.Name, strings.TrimSpace(name)) })
+		if i < 0 {
+			return ErrUnknownField
+		}
+		if err := setFieldValue(tx, transactionID, fields[i], raw); err != nil {
+			return err
+		}
+	}
+	after, err := getFieldValues(tx, []uuid.UUID{transactionID})
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditTransactionDetails, "transaction", transactionID.String(), nil, after[transactionID])
+}
+
+// getFieldValues returns the custom field values of the transactions.
+func getFieldValues(q queryer, ids []uuid.UUID) (map[uuid.UUID][]model.FieldValue, error) {
+	rows, err := q.Query(context.Background(), `
+		SELECT V.transaction_id, F.field_id, F.name, F.field_type, `+fieldValueText+`
+		FROM TRANSACTION_FIELD_VALUE V
+			JOIN CUSTOM_FIELD F ON F.field_id = V.field_id
+		WHERE V.transaction_id = ANY($1)
+		ORDER BY LOWER(F.name);`, ids)
+	if err != nil {
+		log.Printf("ERROR querying custom field values: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[uuid.UUID][]model.FieldValue)
+	for rows.Next() {
+		var id uuid.UUID
+		var v model.FieldValue
+		if err := rows.Scan(&id, &v.FieldID, &v.Name, &v.FieldType, &v.Value); err != nil {
+			log.Printf("ERROR scanning custom field value: %v", err)
+			return nil, err
+		}
+		values[id] = append(values[id], v)
+	}
+	return values, rows.Err()
+}
+
+// attachFieldValues fills in the custom field values of the transactions.
+func attachFieldValues(q queryer, transactions []model.TransactionInfo) error {
+	ids := make([]uuid.UUID, len(transactions))
+	for i, t := range transactions {
+		ids[i] = t.TransactionID
+	}
+	values, err := getFieldValues(q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range transactions {
+		transactions[i].Fields = values[transactions[i].TransactionID]
+	}
+	return nil
+}
+
+// GetTransactionDetails returns a transaction with every custom field, filled
+// in with the transaction's value where it has one.
+func GetTransactionDetails(db *pgx.Conn, id uuid.UUID) (model.TransactionInfo, []model.FieldValue, error) {
+	t, err := GetTransaction(db, id)
+	if err != nil {
+		return t, nil, err
+	}
+	values, err := getFieldValues(db, []uuid.UUID{id})
+	if err != nil {
+		return t, nil, err
+	}
+	t.Fields = values[id]
+
+	fields, err := scanCustomFields(db.Query(context.Background(),
+		`SELECT `+fieldColumns+` FROM CUSTOM_FIELD ORDER BY LOWER(name);`))
+	if err != nil {
+		return t, nil, err
+	}
+	all := make([]model.FieldValue, len(fields))
+	for i, f := range fields {
+		all[i] = model.FieldValue{FieldID: f.FieldID, Name: f.Name, FieldType: f.FieldType}
+		for _, v := range t.Fields {
+			if v.FieldID == f.FieldID {
+				all[i].Value = v.Value
+			}
+		}
+	}
+	return t, all, nil
+}
+
+// transactionDetails is the audit snapshot of the details of a transaction.
+type transactionDetails struct {
+	Notes  string             `json:"notes"`
+	Tags   []string           `json:"tags"`
+	Fields []model.FieldValue `json:"fields"`
+}
+
+// SaveTransactionDetails replaces the notes, tags and custom field values of
+// a transaction. values maps field ids to the submitted value; an empty
+// value removes the field from the transaction.
+func SaveTransactionDetails(db *pgx.Conn, actor model.Actor, id uuid.UUID, notes, tags string, values map[uuid.UUID]string) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var before transactionDetails
+	err = tx.QueryRow(context.Background(),
+		`SELECT COALESCE(description, ''), COALESCE(tags, '{}') FROM TRANSACTION WHERE transaction_id = $1 AND deleted_at IS NULL FOR UPDATE;`, id).
+		Scan(&before.Notes, &before.Tags)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTransactionNotFound
+	} else if err != nil {
+		return err
+	}
+	beforeValues, err := getFieldValues(tx, []uuid.UUID{id})
+	if err != nil {
+		return err
+	}
+	before.Fields = beforeValues[id]
+
+	after := transactionDetails{Notes: strings.TrimSpace(notes), Tags: rules.ParseTags(tags)}
+	_, err = tx.Exec(context.Background(),
+		`UPDATE TRANSACTION SET description = NULLIF($2, ''), tags = $3 WHERE transaction_id = $1;`, id, after.Notes, after.Tags)
+	if err != nil {
+		log.Printf("ERROR updating transaction details: %v", err)
+		return err
+	}
+
+	fields, err := scanCustomFields(tx.Query(context.Background(),
+		`SELECT `+fieldColumns+` FROM CUSTOM_FIELD WHERE field_id = ANY($1);`, mapKeys(values)))
+	if err != nil {
+		return err
+	}
+	if len(fields) != len(values) {
+		return ErrUnknownField
+	}
+	for _, f := range fields {
+		if err := setFieldValue(tx, id, f, values[f.FieldID]); err != nil {
+			return err
+		}
+	}
+	afterValues, err := getFieldValues(tx, []uuid.UUID{id})
+	if err != nil {
+		return err
+	}
+	after.Fields = afterValues[id]
+
+	if err = recordAudit(tx, actor, AuditTransactionDetails, "transaction", id.String(), before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func mapKeys(m map[uuid.UUID]string) []uuid.UUID {
+	keys := make([]uuid.UUID, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// GetKnownTags returns every tag in use, for suggestions and filters.
+func GetKnownTags(db *pgx.Conn) ([]string, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT DISTINCT tag
+		FROM TRANSACTION, unnest(tags) AS tag
+		WHERE deleted_at IS NULL
+		ORDER BY tag;`)
+	if err != nil {
+		log.Printf("ERROR querying tags: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidRecurring = errors.New("repository: a recurring transaction needs a name, type, positive amount, frequency and start date")
+
+const recurringColumns = "recurring_id, name, category_type, COALESCE(category, ''), amount, source_name, frequency, start_date"
+
+func recurringScanTargets(r *model.RecurringTransaction) []any {
+	return []any{&r.RecurringID, &r.Name, &r.CategoryType, &r.Category, &r.Amount, &r.SourceName, &r.Frequency, &r.StartDate}
+}
+
+func GetRecurringTransactions(db *pgx.Conn) ([]model.RecurringTransaction, error) {
+	query := `SELECT ` + recurringColumns + ` FROM RECURRING_TRANSACTION ORDER BY source_name, name;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying recurring transactions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.RecurringTransaction
+	for rows.Next() {
+		var r model.RecurringTransaction
+		if err := rows.Scan(recurringScanTargets(&r)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func AddRecurringTransaction(db *pgx.Conn, actor model.Actor, req model.AddRecurringRequest) error {
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil || amount <= 0 {
+		return ErrInvalidRecurring
+	}
+	categoryType := strings.ToUpper(req.CategoryType)
+	if strings.TrimSpace(req.Name) == "" || (categoryType != "INCOME" && categoryType != "EXPENSE") ||
+		!model.ValidRecurFrequency(req.Frequency) {
+		return ErrInvalidRecurring
+	}
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return ErrInvalidRecurring
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	source, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return ErrSourceNotFound
+	}
+	if !source.IsActive {
+		return ErrSourceInactive
+	}
+
+	var r model.RecurringTransaction
+	query := `INSERT INTO RECURRING_TRANSACTION (name, category_type, category, amount, source_name, frequency, start_date)
+			  VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+			  RETURNING ` + recurringColumns
+	err = tx.QueryRow(context.Background(), query, strings.TrimSpace(req.Name), categoryType,
+		strings.TrimSpace(req.Category), amount, req.SourceName, req.Frequency, start).Scan(recurringScanTargets(&r)...)
+	if err != nil {
+		log.Printf("ERROR inserting recurring transaction: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditRecurringCreate, "recurring", r.RecurringID.String(), nil, r); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func DeleteRecurringTransactions(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `DELETE FROM RECURRING_TRANSACTION WHERE recurring_id = ANY($1) RETURNING ` + recurringColumns
+	rows, err := tx.Query(context.Background(), query, ids)
+	if err != nil {
+		return 0, err
+	}
+	var deleted []model.RecurringTransaction
+	for rows.Next() {
+		var r model.RecurringTransaction
+		if err := rows.Scan(recurringScanTargets(&r)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted = append(deleted, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range deleted {
+		if err := recordAudit(tx, actor, AuditRecurringDelete, "recurring", r.RecurringID.String(), r, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), tx.Commit(context.Background())
+}
+
+// GetAverageDailySpend returns the average daily expense per source and
+// category over the last historyDays days. Transfers and expenses that match
+// a recurring transaction by name are left out, since the forecast already
+// schedules those.
+func GetAverageDailySpend(db *pgx.Conn, historyDays int) ([]model.CategoryRate, error) {
+	query := `
+		SELECT T.source_name, COALESCE(S.category, NULLIF(T.category, ''), T.category_name),
+			   SUM(COALESCE(S.amount, T.amount)) / $1
+		FROM transaction T
+			LEFT JOIN transaction_split S ON S.transaction_id = T.transaction_id
+		WHERE T.deleted_at IS NULL
+		  AND T.transfer_id IS NULL
+		  AND LOWER(T.category_type) = 'expense'
+		  AND T.transaction_date >= CURRENT_DATE - $1::int
+		  AND T.transaction_date < CURRENT_DATE
+		  AND NOT EXISTS (SELECT 1 FROM RECURRING_TRANSACTION R
+						  WHERE R.source_name = T.source_name AND LOWER(R.name) = LOWER(T.category_name))
+		GROUP BY 1, 2
+		ORDER BY 1, 3 DESC;`
+	rows, err := db.Query(context.Background(), query, historyDays)
+	if err != nil {
+		log.Printf("ERROR querying average spend: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []model.CategoryRate
+	for rows.Next() {
+		var c model.CategoryRate
+		if err := rows.Scan(&c.SourceName, &c.Category, &c.DailyAmount); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		rates = append(rates, c)
+	}
+	return rates, rows.Err()
+}
+
+// GetForecast projects the balance of every active source for each of the
+// next days, starting from today's balance. Each day applies the recurring
+// transactions due that day and the source's average daily discretionary
+// spend over the last historyDays days.
+func GetForecast(db *pgx.Conn, days, historyDays int, today time.Time) (model.Forecast, error) {
+	forecast := model.Forecast{From: today, Days: days, HistoryDays: historyDays}
+
+	sources, err := GetAllSources(db)
+	if err != nil {
+		return forecast, err
+	}
+	recurring, err := GetRecurringTransactions(db)
+	if err != nil {
+		return forecast, err
+	}
+	rates, err := GetAverageDailySpend(db, historyDays)
+	if err != nil {
+		return forecast, err
+	}
+
+	dailySpend := make(map[string]float64)
+	for _, r := range rates {
+		dailySpend[r.SourceName] += r.DailyAmount
+	}
+	end := today.AddDate(0, 0, days)
+	scheduled := make(map[string]map[time.Time][]model.RecurringTransaction)
+	for _, r := range recurring {
+		if scheduled[r.SourceName] == nil {
+			scheduled[r.SourceName] = make(map[time.Time][]model.RecurringTransaction)
+		}
+		for _, d := range r.Occurrences(today.AddDate(0, 0, 1), end) {
+			scheduled[r.SourceName][d] = append(scheduled[r.SourceName][d], r)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].SourceName < sources[j].SourceName })
+	for _, s := range sources {
+		sf := model.SourceForecast{
+			SourceName:    s.SourceName,
+			SourceType:    s.SourceType,
+			CreditLimit:   s.CreditLimit,
+			StartBalance:  s.Balance,
+			DailySpend:    roundCents(dailySpend[s.SourceName]),
+			LowestBalance: s.Balance,
+			LowestDate:    today,
+		}
+		projected := s
+		for i := 1; i <= days; i++ {
+			day := model.ForecastDay{Date: today.AddDate(0, 0, i), Estimated: -sf.DailySpend}
+			for _, r := range scheduled[s.SourceName][day.Date] {
+				day.Scheduled += balanceDelta(r.CategoryType, r.Amount)
+				day.Items = append(day.Items, r.Name)
+			}
+			projected.Balance = roundCents(projected.Balance + day.Scheduled + day.Estimated)
+			day.Balance = projected.Balance
+			day.Violation = projected.Available() < 0
+			if day.Violation && sf.FirstViolation == nil {
+				date := day.Date
+				sf.FirstViolation = &date
+			}
+			if day.Balance < sf.LowestBalance {
+				sf.LowestBalance, sf.LowestDate = day.Balance, day.Date
+			}
+			sf.Days = append(sf.Days, day)
+		}
+		forecast.Sources = append(forecast.Sources, sf)
+	}
+	return forecast, nil
+}
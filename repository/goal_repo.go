@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidGoal = errors.New("repository: a goal needs a name, a positive target amount and a target date")
+var ErrDuplicateGoal = errors.New("repository: a goal with that name already exists")
+var ErrGoalNotFound = errors.New("repository: goal not found")
+var ErrGoalSourceNotAsset = errors.New("repository: only asset sources can fund goals")
+var ErrNotEnoughUnallocated = errors.New("repository: the source doesn't have that much unallocated balance")
+var ErrReleaseTooLarge = errors.New("repository: cant release more than is allocated from this source")
+
+// GetGoals returns every goal with how much is allocated to it in total and
+// from each source, soonest target first.
+func GetGoals(db *pgx.Conn) ([]model.Goal, error) {
+	query := `SELECT G.goal_id, G.name, G.target_amount, G.target_date, G.created_at, COALESCE(SUM(C.amount), 0)
+			  FROM GOAL G
+				LEFT JOIN GOAL_CONTRIBUTION C ON C.goal_id = G.goal_id
+			  GROUP BY G.goal_id
+			  ORDER BY G.target_date, G.name;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying goals: %v", err)
+		return nil, err
+	}
+	var goals []model.Goal
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var g model.Goal
+		if err := rows.Scan(&g.GoalID, &g.Name, &g.TargetAmount, &g.TargetDate, &g.CreatedAt, &g.Allocated); err != nil {
+			rows.Close()
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		index[g.GoalID] = len(goals)
+		goals = append(goals, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	shareQuery := `SELECT goal_id, source_name, SUM(amount)
+				   FROM GOAL_CONTRIBUTION
+				   GROUP BY goal_id, source_name
+				   HAVING SUM(amount) <> 0
+				   ORDER BY source_name;`
+	rows, err = db.Query(context.Background(), shareQuery)
+	if err != nil {
+		log.Printf("ERROR querying goal shares: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var share model.GoalShare
+		if err := rows.Scan(&id, &share.SourceName, &share.Amount); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			goals[i].Sources = append(goals[i].Sources, share)
+		}
+	}
+	return goals, rows.Err()
+}
+
+// GetSourceAllocations returns, for every active asset source, how much of
+// its balance is allocated to goals and how much is left, or by how much the
+// allocations exceed the balance.
+func GetSourceAllocations(db *pgx.Conn) ([]model.SourceAllocation, error) {
+	query := `SELECT A.source_name, A.balance, COALESCE(SUM(C.amount), 0)
+			  FROM ACCOUNT A
+				LEFT JOIN GOAL_CONTRIBUTION C ON C.source_name = A.source_name
+			  WHERE A.is_active = TRUE AND A.source_type NOT IN ('credit_card', 'loan')
+			  GROUP BY A.source_name, A.balance
+			  ORDER BY A.source_name;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying source allocations: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.SourceAllocation
+	for rows.Next() {
+		var s model.SourceAllocation
+		if err := rows.Scan(&s.SourceName, &s.Balance, &s.Allocated); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		s.Unallocated = math.Max(0, s.Balance-s.Allocated)
+		s.OverAllocated = math.Max(0, s.Allocated-s.Balance)
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// GetGoalContributions returns the most recent allocations and releases.
+func GetGoalContributions(db *pgx.Conn, limit int) ([]model.GoalContribution, error) {
+	query := `SELECT C.contribution_id, C.goal_id, G.name, C.source_name, C.amount, COALESCE(C.note, ''), C.created_at
+			  FROM GOAL_CONTRIBUTION C
+				JOIN GOAL G ON G.goal_id = C.goal_id
+			  ORDER BY C.created_at DESC
+			  LIMIT $1;`
+	rows, err := db.Query(context.Background(), query, limit)
+	if err != nil {
+		log.Printf("ERROR querying goal contributions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.GoalContribution
+	for rows.Next() {
+		var c model.GoalContribution
+		if err := rows.Scan(&c.ContributionID, &c.GoalID, &c.GoalName, &c.SourceName, &c.Amount, &c.Note, &c.CreatedAt); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+func CreateGoal(db *pgx.Conn, actor model.Actor, req model.CreateGoalRequest) error {
+	name := strings.TrimSpace(req.Name)
+	target, err := strconv.ParseFloat(req.TargetAmount, 64)
+	if err != nil || target <= 0 || name == "" {
+		return ErrInvalidGoal
+	}
+	date, err := time.Parse("2006-01-02", req.TargetDate)
+	if err != nil {
+		return ErrInvalidGoal
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM GOAL WHERE name = $1);`, name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateGoal
+	}
+
+	var g model.Goal
+	query := `INSERT INTO GOAL (name, target_amount, target_date) VALUES ($1, $2, $3)
+			  RETURNING goal_id, name, target_amount, target_date, created_at;`
+	err = tx.QueryRow(context.Background(), query, name, target, date).
+		Scan(&g.GoalID, &g.Name, &g.TargetAmount, &g.TargetDate, &g.CreatedAt)
+	if err != nil {
+		log.Printf("ERROR inserting goal: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditGoalCreate, "goal", g.GoalID.String(), nil, g); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// DeleteGoals removes goals together with their contributions, which returns
+// the allocated money to the sources' unallocated balance.
+func DeleteGoals(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `DELETE FROM GOAL WHERE goal_id = ANY($1)
+			  RETURNING goal_id, name, target_amount, target_date, created_at;`
+	rows, err := tx.Query(context.Background(), query, ids)
+	if err != nil {
+		return 0, err
+	}
+	var deleted []model.Goal
+	for rows.Next() {
+		var g model.Goal
+		if err := rows.Scan(&g.GoalID, &g.Name, &g.TargetAmount, &g.TargetDate, &g.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted = append(deleted, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, g := range deleted {
+		if err := recordAudit(tx, actor, AuditGoalDelete, "goal", g.GoalID.String(), g, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), tx.Commit(context.Background())
+}
+
+// AllocateToGoal sets part of a source's unallocated balance aside for a
+// goal, or with Release set gives part of it back. Allocating moves no money
+// between sources; it only earmarks it.
+func AllocateToGoal(db *pgx.Conn, actor model.Actor, req model.AllocateGoalRequest) error {
+	goalID, err := uuid.Parse(req.GoalID)
+	if err != nil {
+		return ErrGoalNotFound
+	}
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return ErrNegativeAmount
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM GOAL WHERE goal_id = $1);`, goalID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrGoalNotFound
+	}
+	source, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return ErrSourceNotFound
+	}
+	if !source.IsActive {
+		return ErrSourceInactive
+	}
+	if source.IsLiability() {
+		return ErrGoalSourceNotAsset
+	}
+
+	if req.Release {
+		var allocated float64
+		query := `SELECT COALESCE(SUM(amount), 0) FROM GOAL_CONTRIBUTION WHERE goal_id = $1 AND source_name = $2;`
+		if err = tx.QueryRow(context.Background(), query, goalID, req.SourceName).Scan(&allocated); err != nil {
+			return err
+		}
+		if amount > allocated {
+			return ErrReleaseTooLarge
+		}
+		amount = -amount
+	} else {
+		var allocated float64
+		query := `SELECT COALESCE(SUM(amount), 0) FROM GOAL_CONTRIBUTION WHERE source_name = $1;`
+		if err = tx.QueryRow(context.Background(), query, req.SourceName).Scan(&allocated); err != nil {
+			return err
+		}
+		if amount > source.Balance-allocated {
+			return ErrNotEnoughUnallocated
+		}
+	}
+
+	var c model.GoalContribution
+	query := `INSERT INTO GOAL_CONTRIBUTION (goal_id, source_name, amount, note)
+			  VALUES ($1, $2, $3, NULLIF($4, ''))
+			  RETURNING contribution_id, goal_id, source_name, amount, COALESCE(note, ''), created_at;`
+	err = tx.QueryRow(context.Background(), query, goalID, req.SourceName, amount, strings.TrimSpace(req.Note)).
+		Scan(&c.ContributionID, &c.GoalID, &c.SourceName, &c.Amount, &c.Note, &c.CreatedAt)
+	if err != nil {
+		log.Printf("ERROR inserting goal contribution: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditGoalAllocate, "goal", goalID.String(), nil, c); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
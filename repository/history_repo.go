@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"finance-tracker/model"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RefreshBalanceSnapshots recomputes the end-of-day balance of every source
+// for each day from since up to yesterday and stores it in BALANCE_SNAPSHOT.
+// A day's balance is reconstructed from the current balance by undoing every
+// transaction dated after that day, so back-dated and deleted transactions
+// are picked up on the next refresh. It returns the number of rows written.
+func RefreshBalanceSnapshots(db *pgx.Conn, since time.Time) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Sources in the trash don't count towards net worth.
+	_, err = tx.Exec(context.Background(), `
+		DELETE FROM BALANCE_SNAPSHOT S
+		USING ACCOUNT A
+		WHERE A.source_name = S.source_name AND A.deleted_at IS NOT NULL AND S.snapshot_date >= $1;`, since)
+	if err != nil {
+		log.Printf("ERROR clearing snapshots of trashed sources: %v", err)
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO BALANCE_SNAPSHOT (snapshot_date, source_name, source_type, balance)
+		SELECT D.day, A.source_name, A.source_type,
+			   A.balance - COALESCE((
+				   SELECT SUM(CASE WHEN LOWER(T.category_type) = 'expense' THEN -T.amount ELSE T.amount END)
+				   FROM transaction T
+				   WHERE T.source_name = A.source_name
+					 AND T.deleted_at IS NULL
+					 AND T.transaction_date >= D.day + 1), 0)
+		FROM (SELECT d::date AS day FROM generate_series($1::date, CURRENT_DATE - 1, INTERVAL '1 day') AS d) AS D
+			JOIN account A ON A.deleted_at IS NULL
+		WHERE A.created_at::date <= D.day
+		   OR EXISTS (SELECT 1 FROM transaction T
+					  WHERE T.source_name = A.source_name AND T.deleted_at IS NULL AND T.transaction_date < D.day + 1)
+		ON CONFLICT (snapshot_date, source_name) DO UPDATE SET
+			source_type = EXCLUDED.source_type,
+			balance = EXCLUDED.balance;`
+	tag, err := tx.Exec(context.Background(), query, since)
+	if err != nil {
+		log.Printf("ERROR refreshing balance snapshots: %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(context.Background())
+}
+
+// dailyBalances combines the cached snapshots before today with the live
+// balances for today.
+const dailyBalances = `
+	WITH balances AS (
+		SELECT snapshot_date AS day, source_name, source_type, balance
+		FROM BALANCE_SNAPSHOT
+		WHERE snapshot_date BETWEEN $1 AND $2 AND snapshot_date < CURRENT_DATE
+		UNION ALL
+		SELECT CURRENT_DATE, source_name, source_type, balance
+		FROM account
+		WHERE deleted_at IS NULL AND CURRENT_DATE BETWEEN $1 AND $2
+	)`
+
+// GetNetWorthHistory returns assets, liabilities and net worth per day
+// between from and to, inclusive.
+func GetNetWorthHistory(db *pgx.Conn, from, to time.Time) ([]model.NetWorthPoint, error) {
+	query := dailyBalances + `
+	SELECT day,
+		   COALESCE(SUM(CASE WHEN source_type IN ('credit_card', 'loan') THEN 0 ELSE balance END), 0),
+		   COALESCE(SUM(CASE WHEN source_type IN ('credit_card', 'loan') THEN -balance ELSE 0 END), 0)
+	FROM balances
+	GROUP BY day
+	ORDER BY day;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying net worth history: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.NetWorthPoint
+	for rows.Next() {
+		var p model.NetWorthPoint
+		if err := rows.Scan(&p.Date, &p.Assets, &p.Liabilities); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		p.NetWorth = p.Assets - p.Liabilities
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// GetSourceBalanceHistory returns the daily balance of every source between
+// from and to, inclusive, keyed by source name.
+func GetSourceBalanceHistory(db *pgx.Conn, from, to time.Time) (map[string][]model.BalancePoint, error) {
+	query := dailyBalances + `
+	SELECT source_name, day, balance
+	FROM balances
+	ORDER BY source_name, day;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying balance history: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[string][]model.BalancePoint)
+	for rows.Next() {
+		var name string
+		var p model.BalancePoint
+		if err := rows.Scan(&name, &p.Date, &p.Balance); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		history[name] = append(history[name], p)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/loan"
+	"finance-tracker/model"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotALoan = errors.New("repository: the source is not a loan")
+var ErrInvalidLoanTerms = errors.New("repository: principal, term and frequency are required and rate cant be negative")
+var ErrLoanPaidOff = errors.New("repository: the loan is already paid off")
+
+const defaultInterestCategory = "Loan Interest"
+
+const loanPaymentColumns = "payment_id, source_name, from_source, payment_date, amount, principal, interest, transfer_id, interest_transaction_id"
+
+func loanPaymentScanTargets(p *model.LoanPayment) []any {
+	return []any{&p.PaymentID, &p.SourceName, &p.FromSource, &p.PaymentDate, &p.Amount, &p.Principal, &p.Interest,
+		&p.TransferID, &p.InterestTransactionID}
+}
+
+// loanPaymentLink matches a transaction T recorded for the loan payment P:
+// a leg of its principal transfer or its interest expense.
+const loanPaymentLink = "(T.transfer_id = P.transfer_id OR T.transaction_id = P.interest_transaction_id)"
+
+// loanPaymentTransactions returns every transaction recorded for the loan
+// payments that any of ids belongs to. A loan payment is trashed, restored
+// and purged as a whole, so that its history matches the balances.
+func loanPaymentTransactions(q queryer, ids []uuid.UUID) ([]uuid.UUID, error) {
+	query := `SELECT DISTINCT T.transaction_id
+			  FROM LOAN_PAYMENT P
+				JOIN TRANSACTION T ON ` + loanPaymentLink + `
+			  WHERE EXISTS (SELECT 1 FROM TRANSACTION L
+							WHERE L.transaction_id = ANY($1)
+							  AND (L.transfer_id = P.transfer_id OR L.transaction_id = P.interest_transaction_id));`
+	rows, err := q.Query(context.Background(), query, ids)
+	if err != nil {
+		log.Printf("ERROR querying loan payment transactions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var linked []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		linked = append(linked, id)
+	}
+	return linked, rows.Err()
+}
+
+// GetLoans returns every active loan source with its terms. Loans whose terms
+// were never entered have Configured set to false.
+func GetLoans(db *pgx.Conn) ([]model.Loan, error) {
+	query := `SELECT A.source_name, A.balance, L.source_name IS NOT NULL,
+					 COALESCE(L.principal, 0), COALESCE(L.annual_rate, 0), COALESCE(L.term_months, 0),
+					 COALESCE(L.frequency, 'monthly'), COALESCE(L.start_date, CURRENT_DATE),
+					 COALESCE(L.interest_category, $1)
+			  FROM ACCOUNT A
+				LEFT JOIN LOAN L ON L.source_name = A.source_name
+			  WHERE A.source_type = 'loan' AND A.is_active = TRUE
+			  ORDER BY A.source_name;`
+	rows, err := db.Query(context.Background(), query, defaultInterestCategory)
+	if err != nil {
+		log.Printf("ERROR querying loans: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []model.Loan
+	for rows.Next() {
+		var l model.Loan
+		err := rows.Scan(&l.SourceName, &l.Balance, &l.Configured, &l.Principal, &l.AnnualRate,
+			&l.TermMonths, &l.Frequency, &l.StartDate, &l.InterestCategory)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		loans = append(loans, l)
+	}
+	return loans, rows.Err()
+}
+
+func getLoan(q queryer, name string) (*model.Loan, error) {
+	var l model.Loan
+	query := `SELECT A.source_name, A.balance, L.principal, L.annual_rate, L.term_months,
+					 L.frequency, L.start_date, L.interest_category
+			  FROM ACCOUNT A
+				JOIN LOAN L ON L.source_name = A.source_name
+			  WHERE A.source_name = $1;`
+	err := q.QueryRow(context.Background(), query, name).Scan(&l.SourceName, &l.Balance, &l.Principal,
+		&l.AnnualRate, &l.TermMonths, &l.Frequency, &l.StartDate, &l.InterestCategory)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	l.Configured = true
+	return &l, nil
+}
+
+func SaveLoanTerms(db *pgx.Conn, actor model.Actor, req model.LoanTermsRequest) error {
+	principal, err := strconv.ParseFloat(req.Principal, 64)
+	if err != nil || principal <= 0 {
+		return ErrInvalidLoanTerms
+	}
+	rate, err := strconv.ParseFloat(req.AnnualRate, 64)
+	if err != nil || rate < 0 {
+		return ErrInvalidLoanTerms
+	}
+	if req.TermMonths <= 0 || loan.PeriodsPerYear(req.Frequency) == 0 {
+		return ErrInvalidLoanTerms
+	}
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return ErrInvalidLoanTerms
+	}
+	category := strings.TrimSpace(req.InterestCategory)
+	if category == "" {
+		category = defaultInterestCategory
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	account, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if account == nil || account.SourceType != model.SourceLoan {
+		return ErrNotALoan
+	}
+	before, err := getLoan(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO LOAN (source_name, principal, annual_rate, term_months, frequency, start_date, interest_category)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  ON CONFLICT (source_name) DO UPDATE SET
+				principal = EXCLUDED.principal,
+				annual_rate = EXCLUDED.annual_rate,
+				term_months = EXCLUDED.term_months,
+				frequency = EXCLUDED.frequency,
+				start_date = EXCLUDED.start_date,
+				interest_category = EXCLUDED.interest_category;`
+	_, err = tx.Exec(context.Background(), query, req.SourceName, principal, rate, req.TermMonths, req.Frequency, start, category)
+	if err != nil {
+		log.Printf("ERROR saving loan terms: %v", err)
+		return err
+	}
+	after, err := getLoan(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditLoanTerms, "source", req.SourceName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func GetLoanPayments(db *pgx.Conn, name string) ([]model.LoanPayment, error) {
+	// Payments whose transactions are in the trash don't count.
+	query := `SELECT ` + loanPaymentColumns + `
+			  FROM LOAN_PAYMENT P
+			  WHERE P.source_name = $1
+				AND NOT EXISTS (SELECT 1 FROM TRANSACTION T WHERE ` + loanPaymentLink + ` AND T.deleted_at IS NOT NULL)
+			  ORDER BY payment_date DESC, created_at DESC;`
+	rows, err := db.Query(context.Background(), query, name)
+	if err != nil {
+		log.Printf("ERROR querying loan payments: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []model.LoanPayment
+	for rows.Next() {
+		var p model.LoanPayment
+		err := rows.Scan(loanPaymentScanTargets(&p)...)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// NextLoanPaymentDate returns the first scheduled payment date after the last
+// recorded payment, or the loan's start date if nothing was paid yet.
+func NextLoanPaymentDate(l model.Loan, payments []model.LoanPayment) time.Time {
+	if len(payments) == 0 {
+		return l.StartDate
+	}
+	last := payments[0].PaymentDate
+	for i := 0; ; i++ {
+		d := loan.NextDate(l.StartDate, l.Frequency, i)
+		if d.After(last) {
+			return d
+		}
+	}
+}
+
+// RecordLoanPayment splits a payment into the interest accrued since the last
+// period and the principal it repays. The principal is recorded as a transfer
+// from the paying source to the loan, the interest as an expense on the paying
+// source in the loan's interest category.
+func RecordLoanPayment(db *pgx.Conn, actor model.Actor, req model.LoanPaymentRequest) (model.LoanPayment, error) {
+	var p model.LoanPayment
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil {
+		return p, err
+	}
+	if amount <= 0 {
+		return p, ErrNegativeAmount
+	}
+	date := req.TransactionDate
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return p, err
+	}
+	defer tx.Rollback(context.Background())
+
+	l, err := getLoan(tx, req.LoanName)
+	if err != nil {
+		return p, err
+	}
+	if l == nil {
+		return p, ErrNotALoan
+	}
+	if l.Outstanding() <= 0 {
+		return p, ErrLoanPaidOff
+	}
+	if req.FromSource == req.LoanName {
+		return p, ErrSameSource
+	}
+	from, err := getAccount(tx, req.FromSource)
+	if err != nil {
+		return p, err
+	}
+	if from == nil {
+		return p, ErrSourceNotFound
+	}
+	if !from.IsActive {
+		return p, ErrSourceInactive
+	}
+	if err = checkSufficientBalance(tx, req.FromSource, amount); err != nil {
+		return p, err
+	}
+
+	principal, interest := loan.Split(l.Outstanding(), l.PeriodicRate(), amount)
+	var transferID, interestID *uuid.UUID
+	if principal > 0 {
+		id, err := transferFunds(tx, actor, req.FromSource, req.LoanName, principal, date)
+		if err != nil {
+			return p, err
+		}
+		transferID = &id
+	}
+	if interest > 0 {
+		if err = adjustBalance(tx, actor, req.FromSource, -interest); err != nil {
+			return p, err
+		}
+		created, err := insertTransaction(tx, actor, newTransaction{
+			CategoryType:    "Expense",
+			CategoryName:    "Interest on " + req.LoanName,
+			Amount:          interest,
+			TransactionDate: date,
+			SourceName:      req.FromSource,
+			Category:        l.InterestCategory,
+		})
+		if err != nil {
+			return p, err
+		}
+		interestID = &created.TransactionID
+	}
+
+	query := `INSERT INTO LOAN_PAYMENT (source_name, from_source, payment_date, amount, principal, interest, transfer_id, interest_transaction_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  RETURNING ` + loanPaymentColumns + `;`
+	err = tx.QueryRow(context.Background(), query, req.LoanName, req.FromSource, date, principal+interest, principal, interest,
+		transferID, interestID).Scan(loanPaymentScanTargets(&p)...)
+	if err != nil {
+		log.Printf("ERROR inserting loan payment: %v", err)
+		return p, err
+	}
+	if err = recordAudit(tx, actor, AuditLoanPayment, "source", req.LoanName, nil, p); err != nil {
+		return p, err
+	}
+	return p, tx.Commit(context.Background())
+}
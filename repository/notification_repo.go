@@ -0,0 +1,519 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"finance-tracker/events"
+	"finance-tracker/model"
+	"finance-tracker/notify"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidRecipient = errors.New("repository: a recipient needs a name and a valid email address or http(s) webhook URL")
+var ErrDuplicateRecipient = errors.New("repository: a recipient with this name already exists")
+var ErrRecipientNotFound = errors.New("repository: notification recipient not found")
+var ErrInvalidNotificationEvent = errors.New("repository: unknown notification event")
+var ErrNotificationNotFound = errors.New("repository: no failed notification with this id")
+
+// webhookSecretPrefix makes webhook secrets easy to recognise, like API
+// tokens.
+const webhookSecretPrefix = "whsec_"
+
+// notificationLease is how long a notification being delivered is held back
+// from other deliveries. A crash mid-delivery retries it after the lease.
+const notificationLease = 5 * time.Minute
+
+// notificationBatch is how many notifications one delivery run sends at most.
+const notificationBatch = 50
+
+const recipientColumns = "recipient_id, name, COALESCE(email, ''), COALESCE(webhook_url, ''), webhook_secret, email_events, webhook_events, created_at"
+
+func recipientScanTargets(r *model.NotificationRecipient) []any {
+	return []any{&r.RecipientID, &r.Name, &r.Email, &r.WebhookURL, &r.WebhookSecret, &r.EmailEvents, &r.WebhookEvents, &r.CreatedAt}
+}
+
+// notificationColumns are read from NOTIFICATION_OUTBOX O joined with its
+// NOTIFICATION_RECIPIENT R.
+const notificationColumns = "O.notification_id, O.recipient_id, R.name, O.channel, O.event, O.subject, O.body, O.payload, O.status, O.attempts, O.next_attempt_at, COALESCE(O.last_error, ''), O.created_at, O.sent_at"
+
+func notificationScanTargets(n *model.Notification) []any {
+	return []any{&n.NotificationID, &n.RecipientID, &n.RecipientName, &n.Channel, &n.Event, &n.Subject, &n.Body, &n.Payload,
+		&n.Status, &n.Attempts, &n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.SentAt}
+}
+
+func GetRecipients(db *pgx.Conn) ([]model.NotificationRecipient, error) {
+	rows, err := db.Query(context.Background(), `SELECT `+recipientColumns+` FROM NOTIFICATION_RECIPIENT ORDER BY LOWER(name);`)
+	if err != nil {
+		log.Printf("ERROR querying notification recipients: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []model.NotificationRecipient
+	for rows.Next() {
+		var r model.NotificationRecipient
+		if err := rows.Scan(recipientScanTargets(&r)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+func getRecipient(q queryer, id uuid.UUID) (*model.NotificationRecipient, error) {
+	var r model.NotificationRecipient
+	err := q.QueryRow(context.Background(), `SELECT `+recipientColumns+` FROM NOTIFICATION_RECIPIENT WHERE recipient_id = $1;`, id).
+		Scan(recipientScanTargets(&r)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("ERROR querying notification recipient: %v", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// cleanRecipient trims and checks the name and addresses of a recipient.
+func cleanRecipient(req model.AddRecipientRequest) (model.AddRecipientRequest, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+	if req.Name == "" || len(req.Name) > 100 || (req.Email == "" && req.WebhookURL == "") {
+		return req, ErrInvalidRecipient
+	}
+	if req.Email != "" {
+		addr, err := mail.ParseAddress(req.Email)
+		if err != nil {
+			return req, ErrInvalidRecipient
+		}
+		req.Email = addr.Address
+	}
+	if req.WebhookURL != "" {
+		u, err := url.Parse(req.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return req, ErrInvalidRecipient
+		}
+	}
+	return req, nil
+}
+
+// AddRecipient adds someone to notify. They start out receiving every event
+// on every channel they have an address for, with a new webhook secret.
+func AddRecipient(db *pgx.Conn, actor model.Actor, req model.AddRecipientRequest) (model.NotificationRecipient, error) {
+	var r model.NotificationRecipient
+	req, err := cleanRecipient(req)
+	if err != nil {
+		return r, err
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return r, err
+	}
+	secret := webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	var emailEvents, webhookEvents []string
+	if req.Email != "" {
+		emailEvents = model.NotificationEvents
+	}
+	if req.WebhookURL != "" {
+		webhookEvents = model.NotificationEvents
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return r, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM NOTIFICATION_RECIPIENT WHERE LOWER(name) = LOWER($1));`, req.Name).Scan(&exists)
+	if err != nil {
+		log.Printf("ERROR checking notification recipient: %v", err)
+		return r, err
+	}
+	if exists {
+		return r, ErrDuplicateRecipient
+	}
+	err = tx.QueryRow(context.Background(),
+		`INSERT INTO NOTIFICATION_RECIPIENT (name, email, webhook_url, webhook_secret, email_events, webhook_events)
+		 VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, COALESCE($5, '{}'::text[]), COALESCE($6, '{}'::text[]))
+		 RETURNING `+recipientColumns+`;`,
+		req.Name, req.Email, req.WebhookURL, secret, emailEvents, webhookEvents).
+		Scan(recipientScanTargets(&r)...)
+	if err != nil {
+		log.Printf("ERROR inserting notification recipient: %v", err)
+		return r, err
+	}
+	if err = recordAudit(tx, actor, AuditRecipientCreate, "notification_recipient", r.RecipientID.String(), nil, r); err != nil {
+		return r, err
+	}
+	return r, tx.Commit(context.Background())
+}
+
+// UpdateRecipientPreferences replaces the events a recipient gets by email
+// and by webhook.
+func UpdateRecipientPreferences(db *pgx.Conn, actor model.Actor, req model.RecipientPreferencesRequest) error {
+	id, err := uuid.Parse(req.RecipientID)
+	if err != nil {
+		return ErrRecipientNotFound
+	}
+	for _, event := range append(append([]string{}, req.EmailEvents...), req.WebhookEvents...) {
+		if !model.ValidNotificationEvent(event) {
+			return ErrInvalidNotificationEvent
+		}
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := getRecipient(tx, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrRecipientNotFound
+	}
+	var after model.NotificationRecipient
+	err = tx.QueryRow(context.Background(),
+		`UPDATE NOTIFICATION_RECIPIENT
+		 SET email_events = COALESCE($2, '{}'::text[]), webhook_events = COALESCE($3, '{}'::text[])
+		 WHERE recipient_id = $1
+		 RETURNING `+recipientColumns+`;`,
+		id, req.EmailEvents, req.WebhookEvents).
+		Scan(recipientScanTargets(&after)...)
+	if err != nil {
+		log.Printf("ERROR updating notification preferences: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditRecipientUpdate, "notification_recipient", id.String(), before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// DeleteRecipient removes a recipient together with their notifications and
+// delivery log.
+func DeleteRecipient(db *pgx.Conn, actor model.Actor, id uuid.UUID) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := getRecipient(tx, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrRecipientNotFound
+	}
+	if _, err = tx.Exec(context.Background(), `DELETE FROM NOTIFICATION_RECIPIENT WHERE recipient_id = $1;`, id); err != nil {
+		log.Printf("ERROR deleting notification recipient: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditRecipientDelete, "notification_recipient", id.String(), before, nil); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// enqueueNotification puts a notification in the outbox for every recipient
+// who wants event, once per channel, in the transaction that caused it so it
+// is only sent if that commits. A notification with the same non-empty key
+// is only queued once per recipient and channel. It returns how many were
+// queued.
+func enqueueNotification(tx pgx.Tx, event, key, subject, body string, data any) (int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(context.Background(),
+		`INSERT INTO NOTIFICATION_OUTBOX (recipient_id, channel, event, dedupe_key, subject, body, payload)
+		 SELECT R.recipient_id, C.channel, $1::text, NULLIF($2::text, ''), $3::text, $4::text, $5::jsonb
+		 FROM NOTIFICATION_RECIPIENT R
+			 CROSS JOIN (VALUES ('email'), ('webhook')) AS C (channel)
+		 WHERE (C.channel = 'email' AND R.email IS NOT NULL AND $1::text = ANY (R.email_events))
+			OR (C.channel = 'webhook' AND R.webhook_url IS NOT NULL AND $1::text = ANY (R.webhook_events))
+		 ON CONFLICT DO NOTHING;`,
+		event, key, subject, body, payload)
+	if err != nil {
+		log.Printf("ERROR queuing notification: %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// NotifyAlert is an events.Handler queuing a notification for every
+// spending alert.
+func NotifyAlert(tx pgx.Tx, e events.Event) error {
+	a := e.(events.AlertRaised).Alert
+	subject := "Unusual expense in " + a.Category
+	if a.Kind == model.AlertCategorySpike {
+		subject = "Spending spike in " + a.Category
+	}
+	_, err := enqueueNotification(tx, model.EventAlert, "alert:"+a.AlertID.String(), subject, a.Message, a)
+	return err
+}
+
+// NotifyLowBalance is an events.Handler queuing a notification when a source
+// drops below its low-balance threshold.
+func NotifyLowBalance(tx pgx.Tx, e events.Event) error {
+	a := e.(events.LowBalance).Account
+	body := fmt.Sprintf("%s has %.2f available, below its low-balance threshold of %.2f.", a.SourceName, a.Available(), *a.LowBalanceThreshold)
+	_, err := enqueueNotification(tx, model.EventLowBalance, "", "Low balance on "+a.SourceName, body, a)
+	return err
+}
+
+// QueueTestNotification queues a test message to every address of a
+// recipient, whatever their preferences.
+func QueueTestNotification(db *pgx.Conn, id uuid.UUID) (int64, error) {
+	tag, err := db.Exec(context.Background(),
+		`INSERT INTO NOTIFICATION_OUTBOX (recipient_id, channel, event, subject, body)
+		 SELECT R.recipient_id, C.channel, $2, 'Test notification',
+				'This is a test notification from the finance tracker. If you can read it, notifications reach you.'
+		 FROM NOTIFICATION_RECIPIENT R
+			 CROSS JOIN (VALUES ('email'), ('webhook')) AS C (channel)
+		 WHERE R.recipient_id = $1
+		   AND ((C.channel = 'email' AND R.email IS NOT NULL) OR (C.channel = 'webhook' AND R.webhook_url IS NOT NULL));`,
+		id, model.EventTest)
+	if err != nil {
+		log.Printf("ERROR queuing test notification: %v", err)
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrRecipientNotFound
+	}
+	return tag.RowsAffected(), nil
+}
+
+// QueueBillReminders queues an upcoming bill notification for every bill due
+// between today and days from now. Each bill is only announced once.
+func QueueBillReminders(db *pgx.Conn, today time.Time, days int) (int64, error) {
+	bills, err := GetUpcomingBills(db, today, today.AddDate(0, 0, days))
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var queued int64
+	for _, b := range bills {
+		due := b.DueDate.Format("Monday, January 2")
+		n, err := enqueueNotification(tx, model.EventUpcomingBill, "bill:"+b.Key+":"+b.DueDate.Format("2006-01-02"),
+			fmt.Sprintf("%s due %s", b.Name, b.DueDate.Format("Jan 2")),
+			fmt.Sprintf("%s of %.2f from %s is due on %s.", b.Name, b.Amount, b.SourceName, due), b)
+		if err != nil {
+			return 0, err
+		}
+		queued += n
+	}
+	return queued, tx.Commit(context.Background())
+}
+
+// NotificationSender delivers one notification over its channel.
+type NotificationSender interface {
+	Send(n model.Notification) error
+}
+
+// DeliverNotifications sends the notifications that are due and
+// records every attempt in the delivery log. Failed ones are retried with
+// backoff until they run out of attempts.
+func DeliverNotifications(db *pgx.Conn, sender NotificationSender) (sent, failed int, err error) {
+	// Claim the due notifications by pushing their next attempt past the
+	// lease, so a delivery running at the same time skips them.
+	rows, err := db.Query(context.Background(),
+		`UPDATE NOTIFICATION_OUTBOX O
+		 SET next_attempt_at = NOW() + $1::int * INTERVAL '1 second'
+		 FROM NOTIFICATION_RECIPIENT R
+		 WHERE R.recipient_id = O.recipient_id
+		   AND O.notification_id IN (
+			   SELECT notification_id FROM NOTIFICATION_OUTBOX
+			   WHERE status = 'pending' AND next_attempt_at <= NOW()
+			   ORDER BY next_attempt_at
+			   LIMIT $2
+			   FOR UPDATE SKIP LOCKED)
+		 RETURNING `+notificationColumns+`,
+			 CASE WHEN O.channel = 'email' THEN COALESCE(R.email, '') ELSE COALESCE(R.webhook_url, '') END,
+			 R.webhook_secret;`,
+		int(notificationLease.Seconds()), notificationBatch)
+	if err != nil {
+		log.Printf("ERROR claiming notifications: %v", err)
+		return 0, 0, err
+	}
+	var due []model.Notification
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(append(notificationScanTargets(&n), &n.Address, &n.Secret)...); err != nil {
+			rows.Close()
+			log.Printf("ERROR scanning row: %v\n", err)
+			return 0, 0, err
+		}
+		due = append(due, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, n := range due {
+		start := time.Now()
+		sendErr := sender.Send(n)
+		if err := recordDelivery(db, n, sendErr, time.Since(start)); err != nil {
+			return sent, failed, err
+		}
+		if sendErr != nil {
+			log.Printf("Notification %s to %s over %s failed: %v", n.NotificationID, n.RecipientName, n.Channel, sendErr)
+			failed++
+		} else {
+			sent++
+		}
+	}
+	return sent, failed, nil
+}
+
+// recordDelivery logs an attempt and moves the notification on: sent, failed
+// for good, or pending again after a backoff.
+func recordDelivery(db *pgx.Conn, n model.Notification, sendErr error, took time.Duration) error {
+	attempt := n.Attempts + 1
+	status, lastError, next := model.NotificationSent, "", time.Now()
+	if sendErr != nil {
+		lastError = sendErr.Error()
+		status = model.NotificationPending
+		next = time.Now().Add(notify.Backoff(attempt))
+		if attempt >= notify.MaxAttempts {
+			status = model.NotificationFailed
+		}
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(),
+		`INSERT INTO NOTIFICATION_DELIVERY (notification_id, attempt, success, error, duration_ms)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5);`,
+		n.NotificationID, attempt, sendErr == nil, lastError, took.Milliseconds())
+	if err != nil {
+		log.Printf("ERROR inserting notification delivery: %v", err)
+		return err
+	}
+	_, err = tx.Exec(context.Background(),
+		`UPDATE NOTIFICATION_OUTBOX
+		 SET status = $2::text, attempts = $3, last_error = NULLIF($4, ''), next_attempt_at = $5,
+			 sent_at = CASE WHEN $2::text = 'sent' THEN NOW() END
+		 WHERE notification_id = $1;`,
+		n.NotificationID, status, attempt, lastError, next)
+	if err != nil {
+		log.Printf("ERROR updating notification: %v", err)
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// RetryNotification puts a failed notification back in the outbox with a
+// fresh set of attempts.
+func RetryNotification(db *pgx.Conn, actor model.Actor, id uuid.UUID) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	tag, err := tx.Exec(context.Background(),
+		`UPDATE NOTIFICATION_OUTBOX SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		 WHERE notification_id = $1 AND status = 'failed';`, id)
+	if err != nil {
+		log.Printf("ERROR retrying notification: %v", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotificationNotFound
+	}
+	if err = recordAudit(tx, actor, AuditNotificationRetry, "notification", id.String(), nil, nil); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// GetNotifications returns the newest notifications in the outbox, whatever
+// their status.
+func GetNotifications(db *pgx.Conn, limit int) ([]model.Notification, error) {
+	rows, err := db.Query(context.Background(),
+		`SELECT `+notificationColumns+`
+		 FROM NOTIFICATION_OUTBOX O
+			 JOIN NOTIFICATION_RECIPIENT R ON R.recipient_id = O.recipient_id
+		 ORDER BY O.created_at DESC
+		 LIMIT $1;`, limit)
+	if err != nil {
+		log.Printf("ERROR querying notifications: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []model.Notification
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(notificationScanTargets(&n)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// GetNotificationDeliveries returns the newest delivery attempts.
+func GetNotificationDeliveries(db *pgx.Conn, limit int) ([]model.NotificationDelivery, error) {
+	rows, err := db.Query(context.Background(),
+		`SELECT D.delivery_id, D.notification_id, R.name, O.channel, O.subject, D.attempt, D.success,
+				COALESCE(D.error, ''), D.duration_ms, D.attempted_at
+		 FROM NOTIFICATION_DELIVERY D
+			 JOIN NOTIFICATION_OUTBOX O ON O.notification_id = D.notification_id
+			 JOIN NOTIFICATION_RECIPIENT R ON R.recipient_id = O.recipient_id
+		 ORDER BY D.attempted_at DESC
+		 LIMIT $1;`, limit)
+	if err != nil {
+		log.Printf("ERROR querying notification deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.NotificationDelivery
+	for rows.Next() {
+		var d model.NotificationDelivery
+		err := rows.Scan(&d.DeliveryID, &d.NotificationID, &d.RecipientName, &d.Channel, &d.Subject, &d.Attempt, &d.Success,
+			&d.Error, &d.DurationMS, &d.AttemptedAt)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
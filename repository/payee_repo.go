@@ -0,0 +1,615 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/payee"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrPayeeNotFound = errors.New("repository: payee not found")
+var ErrInvalidPayee = errors.New("repository: a payee needs a name")
+var ErrDuplicatePayee = errors.New("repository: a payee with that name already exists")
+var ErrInvalidAlias = errors.New("repository: an alias needs at least one letter or digit")
+var ErrInvalidPayeeMerge = errors.New("repository: select at least two payees, including the one to keep")
+
+const payeeColumns = "payee_id, name, COALESCE(default_category, ''), created_at"
+
+func scanPayees(rows pgx.Rows, err error) ([]model.Payee, error) {
+	if err != nil {
+		log.Printf("ERROR querying payees: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payees []model.Payee
+	for rows.Next() {
+		var p model.Payee
+		if err := rows.Scan(&p.PayeeID, &p.Name, &p.DefaultCategory, &p.CreatedAt); err != nil {
+			log.Printf("ERROR scanning payee: %v", err)
+			return nil, err
+		}
+		payees = append(payees, p)
+	}
+	return payees, rows.Err()
+}
+
+func payeeNameTaken(q queryer, name string, except uuid.UUID) (bool, error) {
+	var exists bool
+	err := q.QueryRow(context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM PAYEE WHERE LOWER(name) = LOWER($1) AND payee_id <> $2);`, name, except).Scan(&exists)
+	if err != nil {
+		log.Printf("ERROR checking payee name: %v", err)
+	}
+	return exists, err
+}
+
+func insertPayee(tx pgx.Tx, actor model.Actor, name, defaultCategory string) (model.Payee, error) {
+	created, err := scanPayees(tx.Query(context.Background(),
+		`INSERT INTO PAYEE (name, default_category) VALUES ($1, NULLIF($2, '')) RETURNING `+payeeColumns+`;`,
+		name, defaultCategory))
+	if err != nil {
+		return model.Payee{}, err
+	}
+	if err = recordAudit(tx, actor, AuditPayeeCreate, "payee", created[0].PayeeID.String(), nil, created[0]); err != nil {
+		return model.Payee{}, err
+	}
+	return created[0], nil
+}
+
+// setAlias points an alias at a payee, taking it over from the payee it
+// belonged to before.
+func setAlias(tx pgx.Tx, alias string, payeeID uuid.UUID, source string) error {
+	_, err := tx.Exec(context.Background(), `
+		INSERT INTO PAYEE_ALIAS (alias, payee_id, source) VALUES ($1, $2, $3)
+		ON CONFLICT (alias) DO UPDATE SET payee_id = EXCLUDED.payee_id, source = EXCLUDED.source, created_at = NOW();`,
+		alias, payeeID, source)
+	if err != nil {
+		log.Printf("ERROR saving payee alias: %v", err)
+	}
+	return err
+}
+
+// resolvePayee returns the payee a raw transaction name maps to. A name not
+// seen before is matched to the payee of the same display name, or gets a new
+// payee, and is learned as an alias of it. Names without any letter or digit
+// have no payee.
+func resolvePayee(tx pgx.Tx, actor model.Actor, rawName string) (*model.Payee, error) {
+	alias := payee.Normalize(rawName)
+	if alias == "" {
+		return nil, nil
+	}
+	found, err := scanPayees(tx.Query(context.Background(), `
+		SELECT P.payee_id, P.name, COALESCE(P.default_category, ''), P.created_at
+		FROM PAYEE_ALIAS A
+			JOIN PAYEE P ON P.payee_id = A.payee_id
+		WHERE A.alias = $1;`, alias))
+	if err != nil {
+		return nil, err
+	}
+	if len(found) > 0 {
+		return &found[0], nil
+	}
+
+	name := payee.DisplayName(rawName)
+	found, err = scanPayees(tx.Query(context.Background(),
+		`SELECT `+payeeColumns+` FROM PAYEE WHERE LOWER(name) = LOWER($1);`, name))
+	if err != nil {
+		return nil, err
+	}
+	var p model.Payee
+	if len(found) > 0 {
+		p = found[0]
+	} else if p, err = insertPayee(tx, actor, name, ""); err != nil {
+		return nil, err
+	}
+	if err = setAlias(tx, alias, p.PayeeID, model.AliasLearned); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// transactionPayee is the audit snapshot of the payee of a transaction.
+type transactionPayee struct {
+	PayeeID *uuid.UUID `json:"payee_id"`
+}
+
+func setTransactionPayee(tx pgx.Tx, actor model.Actor, transactionID uuid.UUID, before *uuid.UUID, payeeID uuid.UUID) error {
+	_, err := tx.Exec(context.Background(), `UPDATE TRANSACTION SET payee_id = $2 WHERE transaction_id = $1;`, transactionID, payeeID)
+	if err != nil {
+		log.Printf("ERROR updating transaction payee: %v", err)
+		return err
+	}
+	return recordAudit(tx, actor, AuditTransactionPayee, "transaction", transactionID.String(),
+		transactionPayee{before}, transactionPayee{&payeeID})
+}
+
+// payeeCandidate is a transaction that can be matched to a payee, with the
+// name it was entered with.
+type payeeCandidate struct {
+	transactionID uuid.UUID
+	enteredName   string
+	payeeID       *uuid.UUID
+}
+
+// getPayeeCandidates returns the transactions that can have a payee: all but
+// transfers and the trash, or only those without a payee yet.
+func getPayeeCandidates(q queryer, unassignedOnly bool) ([]payeeCandidate, error) {
+	query := `SELECT transaction_id, COALESCE(raw_name, category_name), payee_id
+			  FROM TRANSACTION
+			  WHERE deleted_at IS NULL AND transfer_id IS NULL`
+	if unassignedOnly {
+		query += ` AND payee_id IS NULL`
+	}
+	rows, err := q.Query(context.Background(), query+` ORDER BY transaction_date, created_at;`)
+	if err != nil {
+		log.Printf("ERROR querying transactions to match to payees: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []payeeCandidate
+	for rows.Next() {
+		var c payeeCandidate
+		if err := rows.Scan(&c.transactionID, &c.enteredName, &c.payeeID); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// CountUnassignedTransactions returns how many transactions could have a
+// payee but have none, such as those entered before payees existed.
+func CountUnassignedTransactions(db *pgx.Conn) (int, error) {
+	var n int
+	err := db.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM TRANSACTION WHERE deleted_at IS NULL AND transfer_id IS NULL AND payee_id IS NULL;`).Scan(&n)
+	if err != nil {
+		log.Printf("ERROR counting transactions without a payee: %v", err)
+	}
+	return n, err
+}
+
+// MatchUnassignedTransactions gives every transaction without a payee the
+// payee its name maps to, creating payees as needed. It returns how many
+// transactions were matched.
+func MatchUnassignedTransactions(db *pgx.Conn, actor model.Actor) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	candidates, err := getPayeeCandidates(tx, true)
+	if err != nil {
+		return 0, err
+	}
+	var matched int64
+	for _, c := range candidates {
+		p, err := resolvePayee(tx, actor, c.enteredName)
+		if err != nil {
+			return 0, err
+		}
+		if p == nil {
+			continue
+		}
+		if err = setTransactionPayee(tx, actor, c.transactionID, nil, p.PayeeID); err != nil {
+			return 0, err
+		}
+		matched++
+	}
+	return matched, tx.Commit(context.Background())
+}
+
+// payeeTotals selects every payee with the totals of its transactions,
+// leaving out transfers and the trash.
+const payeeTotals = `
+	SELECT P.payee_id, P.name, COALESCE(P.default_category, ''), P.created_at,
+		   COUNT(T.transaction_id),
+		   COALESCE(SUM(T.amount) FILTER (WHERE LOWER(T.category_type) = 'expense'), 0),
+		   COALESCE(SUM(T.amount) FILTER (WHERE LOWER(T.category_type) = 'income'), 0),
+		   MAX(T.transaction_date),
+		   (SELECT COUNT(*) FROM PAYEE_ALIAS A WHERE A.payee_id = P.payee_id)
+	FROM PAYEE P
+		LEFT JOIN TRANSACTION T ON T.payee_id = P.payee_id AND T.deleted_at IS NULL AND T.transfer_id IS NULL`
+
+func scanPayeeTotals(rows pgx.Rows, err error) ([]model.Payee, error) {
+	if err != nil {
+		log.Printf("ERROR querying payees: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payees []model.Payee
+	for rows.Next() {
+		var p model.Payee
+		err := rows.Scan(&p.PayeeID, &p.Name, &p.DefaultCategory, &p.CreatedAt,
+			&p.Transactions, &p.Spent, &p.Received, &p.LastDate, &p.Aliases)
+		if err != nil {
+			log.Printf("ERROR scanning payee: %v", err)
+			return nil, err
+		}
+		payees = append(payees, p)
+	}
+	return payees, rows.Err()
+}
+
+// GetPayees returns every payee with its totals, largest spend first.
+func GetPayees(db *pgx.Conn) ([]model.Payee, error) {
+	return scanPayeeTotals(db.Query(context.Background(), payeeTotals+`
+		GROUP BY P.payee_id
+		ORDER BY 6 DESC, 7 DESC, LOWER(P.name);`))
+}
+
+// GetPayee returns a payee with its totals and aliases.
+func GetPayee(db *pgx.Conn, id uuid.UUID) (model.Payee, []model.PayeeAlias, error) {
+	payees, err := scanPayeeTotals(db.Query(context.Background(), payeeTotals+`
+		WHERE P.payee_id = $1
+		GROUP BY P.payee_id;`, id))
+	if err != nil {
+		return model.Payee{}, nil, err
+	}
+	if len(payees) == 0 {
+		return model.Payee{}, nil, ErrPayeeNotFound
+	}
+
+	rows, err := db.Query(context.Background(),
+		`SELECT alias, payee_id, source, created_at FROM PAYEE_ALIAS WHERE payee_id = $1 ORDER BY source, alias;`, id)
+	if err != nil {
+		log.Printf("ERROR querying payee aliases: %v", err)
+		return model.Payee{}, nil, err
+	}
+	defer rows.Close()
+
+	var aliases []model.PayeeAlias
+	for rows.Next() {
+		var a model.PayeeAlias
+		if err := rows.Scan(&a.Alias, &a.PayeeID, &a.Source, &a.CreatedAt); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return model.Payee{}, nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return payees[0], aliases, rows.Err()
+}
+
+// GetPayeeMonths returns what was paid to and received from a payee in every
+// month of the range, including months without transactions.
+func GetPayeeMonths(db *pgx.Conn, id uuid.UUID, from, to time.Time) ([]model.PeriodTotal, error) {
+	query := `
+		WITH months AS (
+			SELECT m::date AS month
+			FROM generate_series(DATE_TRUNC('month', $1::date), DATE_TRUNC('month', $2::date), INTERVAL '1 month') AS m
+		), totals AS (
+			SELECT DATE_TRUNC('month', transaction_date)::date AS month,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'income') AS income,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'expense') AS expense
+			` + reportTransactions + `
+			  AND payee_id = $3
+			GROUP BY 1
+		)
+		SELECT M.month, COALESCE(T.income, 0), COALESCE(T.expense, 0)
+		FROM months M
+			LEFT JOIN totals T ON T.month = M.month
+		ORDER BY M.month;`
+	rows, err := db.Query(context.Background(), query, from, to, id)
+	if err != nil {
+		log.Printf("ERROR querying payee history: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []model.PeriodTotal
+	for rows.Next() {
+		var m model.PeriodTotal
+		if err := rows.Scan(&m.Period, &m.Income, &m.Expense); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		m.Net = m.Income - m.Expense
+		months = append(months, m)
+	}
+	return months, rows.Err()
+}
+
+// CreatePayee adds a payee by hand, with its name learned as an alias.
+func CreatePayee(db *pgx.Conn, actor model.Actor, req model.CreatePayeeRequest) (model.Payee, error) {
+	name := strings.TrimSpace(req.Name)
+	alias := payee.Normalize(name)
+	if alias == "" {
+		return model.Payee{}, ErrInvalidPayee
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return model.Payee{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	taken, err := payeeNameTaken(tx, name, uuid.Nil)
+	if err != nil {
+		return model.Payee{}, err
+	}
+	if taken {
+		return model.Payee{}, ErrDuplicatePayee
+	}
+	p, err := insertPayee(tx, actor, name, strings.TrimSpace(req.DefaultCategory))
+	if err != nil {
+		return model.Payee{}, err
+	}
+	if err = setAlias(tx, alias, p.PayeeID, model.AliasManual); err != nil {
+		return model.Payee{}, err
+	}
+	return p, tx.Commit(context.Background())
+}
+
+// UpdatePayee renames a payee and sets its default category. The default
+// category applies to transactions added from then on.
+func UpdatePayee(db *pgx.Conn, actor model.Actor, id uuid.UUID, name, defaultCategory string) error {
+	name = strings.TrimSpace(name)
+	if payee.Normalize(name) == "" {
+		return ErrInvalidPayee
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := scanPayees(tx.Query(context.Background(),
+		`SELECT `+payeeColumns+` FROM PAYEE WHERE payee_id = $1 FOR UPDATE;`, id))
+	if err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return ErrPayeeNotFound
+	}
+	taken, err := payeeNameTaken(tx, name, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicatePayee
+	}
+	after, err := scanPayees(tx.Query(context.Background(),
+		`UPDATE PAYEE SET name = $2, default_category = NULLIF($3, '') WHERE payee_id = $1 RETURNING `+payeeColumns+`;`,
+		id, name, strings.TrimSpace(defaultCategory)))
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditPayeeUpdate, "payee", id.String(), before[0], after[0]); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// AddPayeeAlias maps a name to a payee by hand. The alias is normalized like
+// transaction names, and existing transactions entered under it move to the
+// payee. It returns how many transactions moved.
+func AddPayeeAlias(db *pgx.Conn, actor model.Actor, payeeID uuid.UUID, name string) (int64, error) {
+	alias := payee.Normalize(name)
+	if alias == "" {
+		return 0, ErrInvalidAlias
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM PAYEE WHERE payee_id = $1);`, payeeID).Scan(&exists)
+	if err != nil {
+		log.Printf("ERROR checking payee: %v", err)
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrPayeeNotFound
+	}
+	if err = setAlias(tx, alias, payeeID, model.AliasManual); err != nil {
+		return 0, err
+	}
+	after := model.PayeeAlias{Alias: alias, PayeeID: payeeID, Source: model.AliasManual}
+	if err = recordAudit(tx, actor, AuditPayeeAlias, "payee", payeeID.String(), nil, after); err != nil {
+		return 0, err
+	}
+
+	candidates, err := getPayeeCandidates(tx, false)
+	if err != nil {
+		return 0, err
+	}
+	var moved int64
+	for _, c := range candidates {
+		if payee.Normalize(c.enteredName) != alias || (c.payeeID != nil && *c.payeeID == payeeID) {
+			continue
+		}
+		if err = setTransactionPayee(tx, actor, c.transactionID, c.payeeID, payeeID); err != nil {
+			return 0, err
+		}
+		moved++
+	}
+	return moved, tx.Commit(context.Background())
+}
+
+// DeletePayeeAlias removes an alias. Transactions keep their payee; a new
+// transaction with the name gets a payee of its own again.
+func DeletePayeeAlias(db *pgx.Conn, actor model.Actor, alias string) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var before model.PayeeAlias
+	err = tx.QueryRow(context.Background(),
+		`DELETE FROM PAYEE_ALIAS WHERE alias = $1 RETURNING alias, payee_id, source, created_at;`, alias).
+		Scan(&before.Alias, &before.PayeeID, &before.Source, &before.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		log.Printf("ERROR deleting payee alias: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditPayeeAlias, "payee", before.PayeeID.String(), before, nil); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// AssignTransactionPayee moves a transaction to another payee, or to a new
+// payee when newPayee is given, and learns the name the transaction was
+// entered with as an alias of it, so later transactions follow.
+func AssignTransactionPayee(db *pgx.Conn, actor model.Actor, transactionID uuid.UUID, payeeID uuid.UUID, newPayee string) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var c payeeCandidate
+	err = tx.QueryRow(context.Background(), `
+		SELECT transaction_id, COALESCE(raw_name, category_name), payee_id
+		FROM TRANSACTION
+		WHERE transaction_id = $1 AND deleted_at IS NULL AND transfer_id IS NULL
+		FOR UPDATE;`, transactionID).Scan(&c.transactionID, &c.enteredName, &c.payeeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTransactionNotFound
+	} else if err != nil {
+		log.Printf("ERROR querying transaction: %v", err)
+		return err
+	}
+
+	if name := strings.TrimSpace(newPayee); name != "" {
+		if payee.Normalize(name) == "" {
+			return ErrInvalidPayee
+		}
+		found, err := scanPayees(tx.Query(context.Background(),
+			`SELECT `+payeeColumns+` FROM PAYEE WHERE LOWER(name) = LOWER($1);`, name))
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			payeeID = found[0].PayeeID
+		} else {
+			p, err := insertPayee(tx, actor, name, "")
+			if err != nil {
+				return err
+			}
+			payeeID = p.PayeeID
+		}
+	} else {
+		var exists bool
+		err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM PAYEE WHERE payee_id = $1);`, payeeID).Scan(&exists)
+		if err != nil {
+			log.Printf("ERROR checking payee: %v", err)
+			return err
+		}
+		if !exists {
+			return ErrPayeeNotFound
+		}
+	}
+
+	if alias := payee.Normalize(c.enteredName); alias != "" {
+		if err = setAlias(tx, alias, payeeID, model.AliasLearned); err != nil {
+			return err
+		}
+	}
+	if c.payeeID == nil || *c.payeeID != payeeID {
+		if err = setTransactionPayee(tx, actor, transactionID, c.payeeID, payeeID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(context.Background())
+}
+
+// payeeMerge is the audit snapshot of a payee merge.
+type payeeMerge struct {
+	Kept         model.Payee   `json:"kept"`
+	Merged       []model.Payee `json:"merged,omitempty"`
+	Transactions int64         `json:"transactions,omitempty"`
+}
+
+// MergePayees merges payees that are really the same merchant into keep: the
+// others' transactions and aliases move to it, their names become aliases of
+// it and they are deleted. The kept payee takes over a default category if
+// it has none. It returns how many transactions moved.
+func MergePayees(db *pgx.Conn, actor model.Actor, keep uuid.UUID, ids []uuid.UUID) (int64, error) {
+	if !slices.Contains(ids, keep) || len(ids) < 2 {
+		return 0, ErrInvalidPayeeMerge
+	}
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	payees, err := scanPayees(tx.Query(context.Background(),
+		`SELECT `+payeeColumns+` FROM PAYEE WHERE payee_id = ANY($1) ORDER BY created_at FOR UPDATE;`, ids))
+	if err != nil {
+		return 0, err
+	}
+	var kept model.Payee
+	var merged []model.Payee
+	var mergedIDs []uuid.UUID
+	for _, p := range payees {
+		if p.PayeeID == keep {
+			kept = p
+		} else {
+			merged = append(merged, p)
+			mergedIDs = append(mergedIDs, p.PayeeID)
+		}
+	}
+	if kept.PayeeID != keep || len(merged) == 0 {
+		return 0, ErrInvalidPayeeMerge
+	}
+
+	tag, err := tx.Exec(context.Background(), `UPDATE TRANSACTION SET payee_id = $1 WHERE payee_id = ANY($2);`, keep, mergedIDs)
+	if err != nil {
+		log.Printf("ERROR moving payee transactions: %v", err)
+		return 0, err
+	}
+	if _, err = tx.Exec(context.Background(), `UPDATE PAYEE_ALIAS SET payee_id = $1 WHERE payee_id = ANY($2);`, keep, mergedIDs); err != nil {
+		log.Printf("ERROR moving payee aliases: %v", err)
+		return 0, err
+	}
+	defaultCategory := kept.DefaultCategory
+	for _, p := range merged {
+		if alias := payee.Normalize(p.Name); alias != "" {
+			if err = setAlias(tx, alias, keep, model.AliasLearned); err != nil {
+				return 0, err
+			}
+		}
+		if defaultCategory == "" {
+			defaultCategory = p.DefaultCategory
+		}
+	}
+	if _, err = tx.Exec(context.Background(), `DELETE FROM PAYEE WHERE payee_id = ANY($1);`, mergedIDs); err != nil {
+		log.Printf("ERROR deleting merged payees: %v", err)
+		return 0, err
+	}
+	after, err := scanPayees(tx.Query(context.Background(),
+		`UPDATE PAYEE SET default_category = NULLIF($2, '') WHERE payee_id = $1 RETURNING `+payeeColumns+`;`, keep, defaultCategory))
+	if err != nil {
+		return 0, err
+	}
+	if err = recordAudit(tx, actor, AuditPayeeMerge, "payee", keep.String(),
+		payeeMerge{Kept: kept, Merged: merged}, payeeMerge{Kept: after[0], Transactions: tag.RowsAffected()}); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(context.Background())
+}
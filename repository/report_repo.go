@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"finance-tracker/model"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// reportTransactions are the transactions counted in reports: transfers
+// between sources are neither income nor expense, and trashed transactions
+// don't count. $1 and $2 are the first and last day of the range.
+const reportTransactions = `
+	FROM transaction
+	WHERE deleted_at IS NULL
+	  AND transfer_id IS NULL
+	  AND transaction_date >= $1::date
+	  AND transaction_date < $2::date + 1`
+
+// reportCategoryLines are the report transactions with split transactions
+// replaced by their split lines, so that every split counts towards its own
+// category. Transactions that were not given a category count under their
+// name. $1 and $2 are the first and last day of the range.
+const reportCategoryLines = `
+	FROM (
+		SELECT T.category_type,
+			   COALESCE(S.category, NULLIF(T.category, ''), T.category_name) AS category,
+			   COALESCE(S.amount, T.amount) AS amount
+		FROM transaction T
+			LEFT JOIN transaction_split S ON S.transaction_id = T.transaction_id
+		WHERE T.deleted_at IS NULL
+		  AND T.transfer_id IS NULL
+		  AND T.transaction_date >= $1::date
+		  AND T.transaction_date < $2::date + 1
+	) AS lines`
+
+// GetPeriodTotals returns income, expense and savings rate over the range.
+func GetPeriodTotals(db *pgx.Conn, from, to time.Time) (model.PeriodTotal, error) {
+	t := model.PeriodTotal{Period: from}
+	query := `
+		SELECT income, expense, income - expense,
+			   ROUND((income - expense) / NULLIF(income, 0) * 100, 1)
+		FROM (
+			SELECT COALESCE(SUM(amount) FILTER (WHERE LOWER(category_type) = 'income'), 0) AS income,
+				   COALESCE(SUM(amount) FILTER (WHERE LOWER(category_type) = 'expense'), 0) AS expense
+			` + reportTransactions + `
+		) AS totals;`
+	err := db.QueryRow(context.Background(), query, from, to).Scan(&t.Income, &t.Expense, &t.Net, &t.SavingsRate)
+	if err != nil {
+		log.Printf("ERROR querying period totals: %v", err)
+		return t, err
+	}
+	return t, nil
+}
+
+// GetCategoryTotals returns income and expense per category over the range,
+// largest first within each type. The lines of a split transaction count
+// separately.
+func GetCategoryTotals(db *pgx.Conn, from, to time.Time) ([]model.CategoryTotal, error) {
+	query := `
+		SELECT UPPER(category_type), category, SUM(amount), COUNT(*),
+			   COALESCE(ROUND(SUM(amount) / NULLIF(SUM(SUM(amount)) OVER (PARTITION BY UPPER(category_type)), 0) * 100, 1), 0)
+		` + reportCategoryLines + `
+		GROUP BY UPPER(category_type), category
+		ORDER BY UPPER(category_type), SUM(amount) DESC;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying category totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []model.CategoryTotal
+	for rows.Next() {
+		var c model.CategoryTotal
+		if err := rows.Scan(&c.CategoryType, &c.Category, &c.Total, &c.Count, &c.Share); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		totals = append(totals, c)
+	}
+	return totals, rows.Err()
+}
+
+// GetMonthlyTotals returns income, expense and savings rate for every month
+// in the range, including months without transactions.
+func GetMonthlyTotals(db *pgx.Conn, from, to time.Time) ([]model.PeriodTotal, error) {
+	query := `
+		WITH months AS (
+			SELECT m::date AS month
+			FROM generate_series(DATE_TRUNC('month', $1::date), DATE_TRUNC('month', $2::date), INTERVAL '1 month') AS m
+		), totals AS (
+			SELECT DATE_TRUNC('month', transaction_date)::date AS month,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'income') AS income,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'expense') AS expense
+			` + reportTransactions + `
+			GROUP BY 1
+		)
+		SELECT M.month, COALESCE(T.income, 0), COALESCE(T.expense, 0),
+			   COALESCE(T.income, 0) - COALESCE(T.expense, 0),
+			   ROUND((COALESCE(T.income, 0) - COALESCE(T.expense, 0)) / NULLIF(T.income, 0) * 100, 1)
+		FROM months M
+			LEFT JOIN totals T ON T.month = M.month
+		ORDER BY M.month;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying monthly totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []model.PeriodTotal
+	for rows.Next() {
+		var m model.PeriodTotal
+		if err := rows.Scan(&m.Period, &m.Income, &m.Expense, &m.Net, &m.SavingsRate); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		months = append(months, m)
+	}
+	return months, rows.Err()
+}
+
+// GetYearOverYear compares every month of year with the same month of the
+// year before.
+func GetYearOverYear(db *pgx.Conn, year int) ([]model.YearOverYear, error) {
+	query := `
+		WITH totals AS (
+			SELECT EXTRACT(YEAR FROM transaction_date)::int AS year,
+				   EXTRACT(MONTH FROM transaction_date)::int AS month,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'income') AS income,
+				   SUM(amount) FILTER (WHERE LOWER(category_type) = 'expense') AS expense
+			FROM transaction
+			WHERE deleted_at IS NULL
+			  AND transfer_id IS NULL
+			  AND EXTRACT(YEAR FROM transaction_date) IN ($1, $1 - 1)
+			GROUP BY 1, 2
+		)
+		SELECT M.month,
+			   COALESCE(C.expense, 0), COALESCE(P.expense, 0),
+			   COALESCE(C.income, 0), COALESCE(P.income, 0),
+			   ROUND((COALESCE(C.expense, 0) - P.expense) / NULLIF(P.expense, 0) * 100, 1)
+		FROM generate_series(1, 12) AS M(month)
+			LEFT JOIN totals C ON C.month = M.month AND C.year = $1
+			LEFT JOIN totals P ON P.month = M.month AND P.year = $1 - 1
+		ORDER BY M.month;`
+	rows, err := db.Query(context.Background(), query, year)
+	if err != nil {
+		log.Printf("ERROR querying year over year totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []model.YearOverYear
+	for rows.Next() {
+		var m model.YearOverYear
+		var month int
+		err := rows.Scan(&month, &m.Expense, &m.PreviousExpense, &m.Income, &m.PreviousIncome, &m.ExpenseChange)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		m.Month = time.Month(month)
+		months = append(months, m)
+	}
+	return months, rows.Err()
+}
+
+// GetTopNames returns the transaction names with the highest spend over the
+// range.
+func GetTopNames(db *pgx.Conn, from, to time.Time, limit int) ([]model.NameTotal, error) {
+	query := `
+		SELECT category_name, SUM(amount), COUNT(*)
+		` + reportTransactions + `
+		  AND LOWER(category_type) = 'expense'
+		GROUP BY category_name
+		ORDER BY SUM(amount) DESC
+		LIMIT $3;`
+	rows, err := db.Query(context.Background(), query, from, to, limit)
+	if err != nil {
+		log.Printf("ERROR querying top names: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []model.NameTotal
+	for rows.Next() {
+		var n model.NameTotal
+		if err := rows.Scan(&n.Name, &n.Total, &n.Count); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+// GetTagTotals returns income and expense per tag over the range, largest
+// expense first. A transaction with several tags counts towards each of them.
+func GetTagTotals(db *pgx.Conn, from, to time.Time) ([]model.TagTotal, error) {
+	query := `
+		SELECT tag,
+			   COALESCE(SUM(amount) FILTER (WHERE LOWER(category_type) = 'income'), 0),
+			   COALESCE(SUM(amount) FILTER (WHERE LOWER(category_type) = 'expense'), 0),
+			   COUNT(*)
+		FROM (
+			SELECT unnest(tags) AS tag, amount, category_type
+			` + reportTransactions + `
+		) AS tagged
+		GROUP BY tag
+		ORDER BY 3 DESC, tag;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying tag totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []model.TagTotal
+	for rows.Next() {
+		var t model.TagTotal
+		if err := rows.Scan(&t.Tag, &t.Income, &t.Expense, &t.Count); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// GetFieldTotals returns income and expense per custom field value over the
+// range. Number fields are totalled over all their values instead of being
+// grouped by value.
+func GetFieldTotals(db *pgx.Conn, from, to time.Time) ([]model.FieldTotal, error) {
+	query := `
+		SELECT F.name, F.field_type,
+			   CASE WHEN F.field_type = 'number' THEN '' ELSE ` + fieldValueText + ` END AS value,
+			   COALESCE(SUM(T.amount) FILTER (WHERE LOWER(T.category_type) = 'income'), 0),
+			   COALESCE(SUM(T.amount) FILTER (WHERE LOWER(T.category_type) = 'expense'), 0),
+			   COUNT(*),
+			   SUM(V.number_value)
+		FROM TRANSACTION_FIELD_VALUE V
+			JOIN CUSTOM_FIELD F ON F.field_id = V.field_id
+			JOIN (
+				SELECT transaction_id, amount, category_type
+				` + reportTransactions + `
+			) AS T ON T.transaction_id = V.transaction_id
+		GROUP BY F.name, F.field_type, 3
+		ORDER BY LOWER(F.name), 5 DESC, 3;`
+	rows, err := db.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying custom field totals: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []model.FieldTotal
+	for rows.Next() {
+		var t model.FieldTotal
+		if err := rows.Scan(&t.Field, &t.FieldType, &t.Value, &t.Income, &t.Expense, &t.Count, &t.Sum); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// GetReport builds the full report for the range. Year over year compares
+// the year of the range's last day with the year before.
+func GetReport(db *pgx.Conn, from, to time.Time, topNames int) (model.Report, error) {
+	report := model.Report{From: from, To: to, Year: to.Year()}
+	var err error
+	if report.Totals, err = GetPeriodTotals(db, from, to); err != nil {
+		return report, err
+	}
+	if report.Categories, err = GetCategoryTotals(db, from, to); err != nil {
+		return report, err
+	}
+	if report.Months, err = GetMonthlyTotals(db, from, to); err != nil {
+		return report, err
+	}
+	if report.YearOverYear, err = GetYearOverYear(db, report.Year); err != nil {
+		return report, err
+	}
+	if report.TopNames, err = GetTopNames(db, from, to, topNames); err != nil {
+		return report, err
+	}
+	if report.Tags, err = GetTagTotals(db, from, to); err != nil {
+		return report, err
+	}
+	if report.Fields, err = GetFieldTotals(db, from, to); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,526 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"finance-tracker/rules"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidRule = errors.New("repository: a rule needs a name, at least one condition and at least one action")
+var ErrInvalidRuleRegex = errors.New("repository: the rule's regular expression is invalid")
+var ErrDuplicateRule = errors.New("repository: a rule with that name already exists")
+
+const ruleColumns = `rule_id, name, priority, enabled, COALESCE(name_contains, ''), COALESCE(name_regex, ''),
+	min_amount, max_amount, COALESCE(source_name, ''), COALESCE(category_type, ''),
+	COALESCE(set_category, ''), COALESCE(rename_to, ''), COALESCE(add_tags, '{}'), mark_transfer, created_at`
+
+func ruleScanTargets(r *model.Rule) []any {
+	return []any{&r.RuleID, &r.Name, &r.Priority, &r.Enabled, &r.NameContains, &r.NameRegex,
+		&r.MinAmount, &r.MaxAmount, &r.SourceName, &r.CategoryType,
+		&r.SetCategory, &r.RenameTo, &r.AddTags, &r.MarkTransfer, &r.CreatedAt}
+}
+
+// getRules returns the rules in the order they are tried.
+func getRules(q queryer) ([]model.Rule, error) {
+	query := `SELECT ` + ruleColumns + ` FROM CATEGORY_RULE ORDER BY priority, created_at;`
+	rows, err := q.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying rules: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.Rule
+	for rows.Next() {
+		var r model.Rule
+		if err := rows.Scan(ruleScanTargets(&r)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// GetRules returns every rule with the number of transactions it last
+// categorized.
+func GetRules(db *pgx.Conn) ([]model.Rule, error) {
+	result, err := getRules(db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT rule_id, COUNT(*) FROM TRANSACTION WHERE rule_id IS NOT NULL AND deleted_at IS NULL GROUP BY rule_id;`)
+	if err != nil {
+		log.Printf("ERROR counting rule matches: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var id uuid.UUID
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	for i := range result {
+		result[i].Matches = counts[result[i].RuleID]
+	}
+	return result, rows.Err()
+}
+
+// applyRules runs the first matching rule on a transaction about to be
+// inserted.
+func applyRules(tx pgx.Tx, actor model.Actor, t *newTransaction) error {
+	all, err := getRules(tx)
+	if err != nil {
+		return err
+	}
+	info := model.TransactionInfo{
+		Amount:       t.Amount,
+		CategoryType: t.CategoryType,
+		CategoryName: t.CategoryName,
+		SourceName:   t.SourceName,
+		Category:     t.Category,
+		Tags:         t.Tags,
+	}
+	r, ok := rules.First(all, t.CategoryName, info)
+	if !ok {
+		return nil
+	}
+	rules.Apply(r, &info)
+	if info.CategoryName != t.CategoryName {
+		t.RawName = t.CategoryName
+	}
+	t.CategoryName, t.Category, t.Tags, t.RuleID = info.CategoryName, info.Category, info.Tags, info.RuleID
+	if r.MarkTransfer && t.TransferID == nil {
+		t.TransferID, _, err = pairTransfer(tx, actor, uuid.Nil, t.SourceName, t.CategoryType, t.Amount, t.TransactionDate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferPairDays is how many days apart the two legs of a transfer marked
+// by a rule may be booked.
+const transferPairDays = 3
+
+// transferLink is what the audit log records when a rule links or unlinks a
+// transfer leg.
+type transferLink struct {
+	TransferID *uuid.UUID `json:"transfer_id"`
+}
+
+// pairTransfer finds the other leg of a transaction a rule marks as a
+// transfer: the closest transaction of the opposite type for the same amount
+// in another source, at most transferPairDays apart, that isn't part of a
+// transfer yet. That leg gets the returned transfer_id, which the caller
+// stores on the transaction. Without another leg it returns nil, since a
+// transfer_id shared with nothing would pass the transaction off as half of
+// a transfer.
+func pairTransfer(tx pgx.Tx, actor model.Actor, id uuid.UUID, sourceName, categoryType string, amount float64, date string) (*uuid.UUID, uuid.UUID, error) {
+	transferID := uuid.New()
+	query := `UPDATE TRANSACTION SET transfer_id = $6
+			  WHERE transaction_id = (
+				SELECT transaction_id FROM TRANSACTION
+				WHERE deleted_at IS NULL AND transfer_id IS NULL AND transaction_id <> $1
+				  AND source_name <> $2 AND LOWER(category_type) <> LOWER($3) AND amount = $4
+				  AND transaction_date::date BETWEEN $5::date - $7::int AND $5::date + $7::int
+				ORDER BY ABS(transaction_date::date - $5::date), created_at
+				LIMIT 1)
+			  RETURNING transaction_id;`
+	var other uuid.UUID
+	err := tx.QueryRow(context.Background(), query, id, sourceName, categoryType, amount, date, transferID, transferPairDays).Scan(&other)
+	if err == pgx.ErrNoRows {
+		return nil, uuid.Nil, nil
+	} else if err != nil {
+		log.Printf("ERROR pairing transfer: %v", err)
+		return nil, uuid.Nil, err
+	}
+	if err := recordAudit(tx, actor, AuditTransactionRules, "transaction", other.String(), transferLink{}, transferLink{&transferID}); err != nil {
+		return nil, uuid.Nil, err
+	}
+	return &transferID, other, nil
+}
+
+// unpairTransfer unlinks the other legs of a transfer a rule no longer marks,
+// except id, and returns them.
+func unpairTransfer(tx pgx.Tx, actor model.Actor, transferID, id uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.Query(context.Background(),
+		`UPDATE TRANSACTION SET transfer_id = NULL WHERE transfer_id = $1 AND transaction_id <> $2 RETURNING transaction_id;`,
+		transferID, id)
+	if err != nil {
+		log.Printf("ERROR unpairing transfer: %v", err)
+		return nil, err
+	}
+	var others []uuid.UUID
+	for rows.Next() {
+		var other uuid.UUID
+		if err := rows.Scan(&other); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		others = append(others, other)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, other := range others {
+		if err := recordAudit(tx, actor, AuditTransactionRules, "transaction", other.String(), transferLink{&transferID}, transferLink{}); err != nil {
+			return nil, err
+		}
+	}
+	return others, nil
+}
+
+func parseOptionalAmount(s string) (*float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return nil, ErrInvalidRule
+	}
+	return &v, nil
+}
+
+func CreateRule(db *pgx.Conn, actor model.Actor, req model.CreateRuleRequest) error {
+	name := strings.TrimSpace(req.Name)
+	minAmount, err := parseOptionalAmount(req.MinAmount)
+	if err != nil {
+		return err
+	}
+	maxAmount, err := parseOptionalAmount(req.MaxAmount)
+	if err != nil {
+		return err
+	}
+	categoryType := strings.ToUpper(req.CategoryType)
+	if categoryType != "" && categoryType != "INCOME" && categoryType != "EXPENSE" {
+		return ErrInvalidRule
+	}
+	if _, err := rules.Compile(model.Rule{NameRegex: req.NameRegex}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRuleRegex, err)
+	}
+	tags := rules.ParseTags(req.AddTags)
+	hasCondition := req.NameContains != "" || req.NameRegex != "" || minAmount != nil || maxAmount != nil ||
+		req.SourceName != "" || categoryType != ""
+	hasAction := req.SetCategory != "" || req.RenameTo != "" || len(tags) > 0 || req.MarkTransfer
+	if name == "" || !hasCondition || !hasAction {
+		return ErrInvalidRule
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM CATEGORY_RULE WHERE name = $1);`, name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateRule
+	}
+	if req.SourceName != "" {
+		source, err := getAccount(tx, req.SourceName)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			return ErrSourceNotFound
+		}
+	}
+
+	var r model.Rule
+	query := `INSERT INTO CATEGORY_RULE (name, priority, name_contains, name_regex, min_amount, max_amount,
+					source_name, category_type, set_category, rename_to, add_tags, mark_transfer)
+			  VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, NULLIF($7, ''), NULLIF($8, ''),
+					NULLIF($9, ''), NULLIF($10, ''), $11, $12)
+			  RETURNING ` + ruleColumns
+	err = tx.QueryRow(context.Background(), query, name, req.Priority, strings.TrimSpace(req.NameContains), req.NameRegex,
+		minAmount, maxAmount, req.SourceName, categoryType, strings.TrimSpace(req.SetCategory),
+		strings.TrimSpace(req.RenameTo), tags, req.MarkTransfer).Scan(ruleScanTargets(&r)...)
+	if err != nil {
+		log.Printf("ERROR inserting rule: %v", err)
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditRuleCreate, "rule", r.RuleID.String(), nil, r); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// SetRulesEnabled turns rules on or off.
+func SetRulesEnabled(db *pgx.Conn, actor model.Actor, ids []uuid.UUID, enabled bool) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `UPDATE CATEGORY_RULE SET enabled = $2 WHERE rule_id = ANY($1) AND enabled <> $2 RETURNING ` + ruleColumns
+	rows, err := tx.Query(context.Background(), query, ids, enabled)
+	if err != nil {
+		return 0, err
+	}
+	var changed []model.Rule
+	for rows.Next() {
+		var r model.Rule
+		if err := rows.Scan(ruleScanTargets(&r)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		changed = append(changed, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range changed {
+		before := r
+		before.Enabled = !enabled
+		if err := recordAudit(tx, actor, AuditRuleUpdate, "rule", r.RuleID.String(), before, r); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(changed)), tx.Commit(context.Background())
+}
+
+// DeleteRules removes rules. Transactions they categorized keep their
+// category but no longer point at a rule.
+func DeleteRules(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `DELETE FROM CATEGORY_RULE WHERE rule_id = ANY($1) RETURNING ` + ruleColumns
+	rows, err := tx.Query(context.Background(), query, ids)
+	if err != nil {
+		return 0, err
+	}
+	var deleted []model.Rule
+	for rows.Next() {
+		var r model.Rule
+		if err := rows.Scan(ruleScanTargets(&r)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted = append(deleted, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range deleted {
+		if err := recordAudit(tx, actor, AuditRuleDelete, "rule", r.RuleID.String(), r, nil); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), tx.Commit(context.Background())
+}
+
+// ApplyRulesToRange re-runs the rules on the transactions dated from..to,
+// matching against the names as they were entered. Everything the rule that
+// last ran on a transaction did is undone first: its name goes back to the one
+// entered, the rule's tags are removed, the category it set falls back to the
+// payee's default and a transfer it marked is unlinked from its other leg.
+// Transfers between sources are skipped, and transactions no rule ever
+// matched are left as they are. It returns how many transactions changed.
+func ApplyRulesToRange(db *pgx.Conn, actor model.Actor, from, to time.Time) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	all, err := getRules(tx)
+	if err != nil {
+		return 0, err
+	}
+	set := rules.NewSet(all)
+
+	query := `SELECT ` + transactionColumns + `, COALESCE(raw_name, category_name), transfer_id,
+				COALESCE((SELECT P.default_category FROM PAYEE P WHERE P.payee_id = T.payee_id), '')
+			  FROM TRANSACTION T
+			  WHERE deleted_at IS NULL
+				AND (transfer_id IS NULL OR rule_id IS NOT NULL)
+				AND transaction_date >= $1::date
+				AND transaction_date < $2::date + 1;`
+	rows, err := tx.Query(context.Background(), query, from, to)
+	if err != nil {
+		log.Printf("ERROR querying transactions to categorize: %v", err)
+		return 0, err
+	}
+	type candidate struct {
+		info          model.TransactionInfo
+		rawName       string
+		transferID    *uuid.UUID
+		payeeCategory string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(append(transactionScanTargets(&c.info), &c.rawName, &c.transferID, &c.payeeCategory)...); err != nil {
+			rows.Close()
+			log.Printf("ERROR scanning row: %v\n", err)
+			return 0, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// A transfer a rule marked stays linked as long as the rule of one of its
+	// legs still marks it.
+	matched := make([]*model.Rule, len(candidates))
+	ids := make([]uuid.UUID, len(candidates))
+	marked := make(map[uuid.UUID]bool)
+	for i, c := range candidates {
+		ids[i] = c.info.TransactionID
+		if r, ok := set.First(c.rawName, c.info); ok {
+			matched[i] = &r
+			if r.MarkTransfer && c.transferID != nil {
+				marked[*c.transferID] = true
+			}
+		}
+	}
+
+	// Transfer legs linked or unlinked during this run, which candidates read
+	// before it started don't show yet.
+	relinked := make(map[uuid.UUID]*uuid.UUID)
+	var changed int64
+	for i, c := range candidates {
+		r := matched[i]
+		if r == nil && c.info.RuleID == nil {
+			continue
+		}
+		current := c.transferID
+		if id, ok := relinked[c.info.TransactionID]; ok {
+			current = id
+		}
+
+		after := c.info
+		after.CategoryName = c.rawName
+		after.Tags = slices.Clone(c.info.Tags)
+		after.RuleID = nil
+		wasTransfer := false
+		if c.info.RuleID != nil {
+			if prev, ok := set.Rule(*c.info.RuleID); ok {
+				after.Tags = rules.RemoveTags(prev, after.Tags)
+				if prev.SetCategory != "" && after.Category == prev.SetCategory {
+					after.Category = c.payeeCategory
+				}
+				wasTransfer = prev.MarkTransfer
+			}
+		}
+		if after.Tags == nil {
+			after.Tags = []string{}
+		}
+		if r != nil {
+			rules.Apply(*r, &after)
+		}
+
+		transferID := current
+		switch {
+		case r != nil && r.MarkTransfer && current == nil:
+			var other uuid.UUID
+			transferID, other, err = pairTransfer(tx, actor, c.info.TransactionID, c.info.SourceName, c.info.CategoryType,
+				c.info.Amount, c.info.TransactionDate.Format("2006-01-02"))
+			if err != nil {
+				return 0, err
+			}
+			if transferID != nil {
+				relinked[other] = transferID
+				marked[*transferID] = true
+			}
+		case (r == nil || !r.MarkTransfer) && wasTransfer && current != nil && !marked[*current]:
+			keep, err := markedOutside(tx, *current, ids)
+			if err != nil {
+				return 0, err
+			}
+			if keep {
+				break
+			}
+			others, err := unpairTransfer(tx, actor, *current, c.info.TransactionID)
+			if err != nil {
+				return 0, err
+			}
+			for _, other := range others {
+				relinked[other] = nil
+			}
+			transferID = nil
+		}
+
+		if after.CategoryName == c.info.CategoryName && after.Category == c.info.Category &&
+			slices.Equal(after.Tags, c.info.Tags) && sameID(after.RuleID, c.info.RuleID) && sameID(transferID, current) {
+			continue
+		}
+
+		rawName := ""
+		if after.CategoryName != c.rawName {
+			rawName = c.rawName
+		}
+		update := `UPDATE TRANSACTION
+				   SET category_name = $2, category = NULLIF($3, ''), tags = $4, rule_id = $5,
+					   raw_name = NULLIF($6, ''), transfer_id = $7
+				   WHERE transaction_id = $1;`
+		_, err := tx.Exec(context.Background(), update, c.info.TransactionID, after.CategoryName, after.Category,
+			after.Tags, after.RuleID, rawName, transferID)
+		if err != nil {
+			log.Printf("ERROR updating transaction: %v", err)
+			return 0, err
+		}
+		if err := recordAudit(tx, actor, AuditTransactionRules, "transaction", c.info.TransactionID.String(), c.info, after); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	return changed, tx.Commit(context.Background())
+}
+
+// markedOutside reports whether a leg of the transfer other than ids is
+// marked as a transfer by the rule that last ran on it.
+func markedOutside(q queryer, transferID uuid.UUID, ids []uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM TRANSACTION T JOIN CATEGORY_RULE R ON R.rule_id = T.rule_id
+							 WHERE T.transfer_id = $1 AND R.mark_transfer AND NOT T.transaction_id = ANY($2));`
+	var marked bool
+	if err := q.QueryRow(context.Background(), query, transferID, ids).Scan(&marked); err != nil {
+		log.Printf("ERROR checking transfer legs: %v", err)
+		return false, err
+	}
+	return marked, nil
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
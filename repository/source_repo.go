@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrSourceInactive = errors.New("repository: the source is inactive, reactivate it instead")
+var ErrSourceNotFound = errors.New("repository: the source does not exist")
+var ErrEmptySourceName = errors.New("repository: the source name cant be empty")
+var ErrSameSource = errors.New("repository: cant transfer a source to itself")
+var ErrTransferTargetRequired = errors.New("repository: choose a source to transfer the remaining balance to")
+var ErrInvalidThreshold = errors.New("repository: the low-balance threshold must be a number of zero or more")
+
+func GetInactiveSources(db *pgx.Conn) ([]model.InactiveSource, error) {
+	query := `SELECT ` + accountColumns + `, deleted_at, closed_at
+			  FROM ACCOUNT
+			  WHERE is_active = FALSE
+			  ORDER BY source_name;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying inactive sources: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.InactiveSource
+	for rows.Next() {
+		var a model.InactiveSource
+		err := rows.Scan(append(accountScanTargets(&a.Account), &a.DeletedAt, &a.ClosedAt)...)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// ReactivateSources makes inactive sources active again. Unlike re-adding a
+// source, the balance is left exactly as it was.
+func ReactivateSources(db *pgx.Conn, actor model.Actor, names []string) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var affected int64
+	for _, name := range names {
+		before, err := getAccount(tx, name)
+		if err != nil {
+			return 0, err
+		}
+		if before == nil || before.IsActive {
+			continue
+		}
+		query := `UPDATE account SET is_active = TRUE, deleted_at = NULL, deleted_batch = NULL, closed_at = NULL
+				  WHERE source_name = $1`
+		if _, err = tx.Exec(context.Background(), query, name); err != nil {
+			return 0, err
+		}
+		after, err := getAccount(tx, name)
+		if err != nil {
+			return 0, err
+		}
+		if err = recordAudit(tx, actor, AuditSourceReactivate, "source", name, before, after); err != nil {
+			return 0, err
+		}
+		affected++
+	}
+	return affected, tx.Commit(context.Background())
+}
+
+// RenameSource changes the name of a source. Every table referring to a
+// source by name follows through its ON UPDATE CASCADE foreign key (see
+// database/migrations for databases created before renaming existed), and the
+// "Transfer to/from" legs of past transfers are renamed as well.
+func RenameSource(db *pgx.Conn, actor model.Actor, req model.RenameSourceRequest) error {
+	newName := strings.TrimSpace(req.NewName)
+	if newName == "" {
+		return ErrEmptySourceName
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrSourceNotFound
+	}
+	existing, err := getAccount(tx, newName)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrDuplicateSource
+	}
+
+	_, err = tx.Exec(context.Background(), `UPDATE account SET source_name = $2 WHERE source_name = $1`, req.SourceName, newName)
+	if err != nil {
+		log.Printf("ERROR renaming source: %v", err)
+		return err
+	}
+	query := `UPDATE transaction SET category_name = CASE category_name
+				  WHEN 'Transfer to ' || $1::text THEN 'Transfer to ' || $2::text
+				  ELSE 'Transfer from ' || $2::text END
+			  WHERE transfer_id IS NOT NULL
+				AND category_name IN ('Transfer to ' || $1::text, 'Transfer from ' || $1::text)`
+	if _, err = tx.Exec(context.Background(), query, req.SourceName, newName); err != nil {
+		log.Printf("ERROR renaming transfers: %v", err)
+		return err
+	}
+	after, err := getAccount(tx, newName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditSourceRename, "source", req.SourceName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// SetLowBalanceThreshold sets the amount of available funds (or credit)
+// below which a source counts as low, or removes it when the threshold is
+// empty.
+func SetLowBalanceThreshold(db *pgx.Conn, actor model.Actor, req model.ThresholdRequest) error {
+	var threshold *float64
+	if v := strings.TrimSpace(req.Threshold); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 {
+			return ErrInvalidThreshold
+		}
+		threshold = &t
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrSourceNotFound
+	}
+	_, err = tx.Exec(context.Background(), `UPDATE account SET low_balance_threshold = $2 WHERE source_name = $1`, req.SourceName, threshold)
+	if err != nil {
+		log.Printf("ERROR setting low-balance threshold: %v", err)
+		return err
+	}
+	after, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditSourceThreshold, "source", req.SourceName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// GetLowBalanceSources returns the active sources below their low-balance
+// threshold, the furthest below first.
+func GetLowBalanceSources(db *pgx.Conn) ([]model.Account, error) {
+	sources, err := GetAllSources(db)
+	if err != nil {
+		return nil, err
+	}
+	var low []model.Account
+	for _, a := range sources {
+		if a.BelowThreshold() {
+			low = append(low, a)
+		}
+	}
+	sort.Slice(low, func(i, j int) bool {
+		return low[i].Available()-*low[i].LowBalanceThreshold < low[j].Available()-*low[j].LowBalanceThreshold
+	})
+	return low, nil
+}
+
+// transferFunds moves amount between two active sources as a pair of linked
+// transactions, an expense on the sending side and an income on the
+// receiving side, sharing one transfer_id.
+func transferFunds(tx pgx.Tx, actor model.Actor, from, to string, amount float64, date string) (uuid.UUID, error) {
+	if from == to {
+		return uuid.Nil, ErrSameSource
+	}
+	if amount <= 0 {
+		return uuid.Nil, ErrNegativeAmount
+	}
+	for _, name := range []string{from, to} {
+		a, err := getAccount(tx, name)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if a == nil {
+			return uuid.Nil, ErrSourceNotFound
+		}
+		if !a.IsActive {
+			return uuid.Nil, ErrSourceInactive
+		}
+	}
+	if err := checkSufficientBalance(tx, from, amount); err != nil {
+		return uuid.Nil, err
+	}
+
+	transferID := uuid.New()
+	legs := []newTransaction{
+		{CategoryType: "Expense", CategoryName: "Transfer to " + to, SourceName: from},
+		{CategoryType: "Income", CategoryName: "Transfer from " + from, SourceName: to},
+	}
+	for _, leg := range legs {
+		leg.Amount = amount
+		leg.TransactionDate = date
+		leg.TransferID = &transferID
+		if err := adjustBalance(tx, actor, leg.SourceName, balanceDelta(leg.CategoryType, amount)); err != nil {
+			return uuid.Nil, err
+		}
+		if _, err := insertTransaction(tx, actor, leg); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return transferID, nil
+}
+
+// TransferBetweenSources moves money from one source to another. Transfers
+// are not counted as income or expense in the summary.
+func TransferBetweenSources(db *pgx.Conn, actor model.Actor, req model.TransferRequest) (uuid.UUID, error) {
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	date := req.TransactionDate
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(context.Background())
+
+	transferID, err := transferFunds(tx, actor, req.FromSource, req.ToSource, amount, date)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return transferID, tx.Commit(context.Background())
+}
+
+// CloseSource settles a source's remaining balance against another source and
+// then deactivates it. A positive balance is moved out to TransferTo, a
+// negative one is paid off from it.
+func CloseSource(db *pgx.Conn, actor model.Actor, req model.CloseSourceRequest) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	before, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrSourceNotFound
+	}
+	if !before.IsActive {
+		return ErrSourceInactive
+	}
+
+	today := time.Now().Format("2006-01-02")
+	if before.Balance != 0 {
+		if req.TransferTo == "" {
+			return ErrTransferTargetRequired
+		}
+		if before.Balance > 0 {
+			_, err = transferFunds(tx, actor, req.SourceName, req.TransferTo, before.Balance, today)
+		} else {
+			_, err = transferFunds(tx, actor, req.TransferTo, req.SourceName, -before.Balance, today)
+		}
+		if err != nil {
+			return fmt.Errorf("settling balance of '%s': %w", req.SourceName, err)
+		}
+	}
+
+	_, err = tx.Exec(context.Background(), `UPDATE account SET is_active = FALSE, closed_at = NOW() WHERE source_name = $1`, req.SourceName)
+	if err != nil {
+		log.Printf("ERROR closing source: %v", err)
+		return err
+	}
+	after, err := getAccount(tx, req.SourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditSourceClose, "source", req.SourceName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
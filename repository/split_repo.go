@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidSplit = errors.New("repository: a split needs at least two lines, each with a category and a positive amount, adding up to the transaction amount")
+var ErrTransactionNotFound = errors.New("repository: transaction not found")
+
+// checkSplits validates split lines against the amount of their transaction.
+func checkSplits(lines []model.SplitLine, total float64) error {
+	if len(lines) < 2 {
+		return ErrInvalidSplit
+	}
+	var sum float64
+	for _, l := range lines {
+		if strings.TrimSpace(l.Category) == "" || l.Amount <= 0 {
+			return ErrInvalidSplit
+		}
+		sum += l.Amount
+	}
+	if math.Abs(sum-total) >= 0.005 {
+		return ErrInvalidSplit
+	}
+	return nil
+}
+
+const splitColumns = "split_id, transaction_id, category, amount"
+
+func scanSplits(rows pgx.Rows, err error) ([]model.Split, error) {
+	if err != nil {
+		log.Printf("ERROR querying splits: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var splits []model.Split
+	for rows.Next() {
+		var s model.Split
+		if err := rows.Scan(&s.SplitID, &s.TransactionID, &s.Category, &s.Amount); err != nil {
+			log.Printf("ERROR scanning split: %v", err)
+			return nil, err
+		}
+		splits = append(splits, s)
+	}
+	return splits, rows.Err()
+}
+
+// insertSplits stores the split lines of a transaction.
+func insertSplits(tx pgx.Tx, transactionID uuid.UUID, lines []model.SplitLine) ([]model.Split, error) {
+	var splits []model.Split
+	for _, l := range lines {
+		var s model.Split
+		err := tx.QueryRow(context.Background(),
+			`INSERT INTO TRANSACTION_SPLIT (transaction_id, category, amount) VALUES ($1, $2, $3) RETURNING `+splitColumns+`;`,
+			transactionID, strings.TrimSpace(l.Category), l.Amount).
+			Scan(&s.SplitID, &s.TransactionID, &s.Category, &s.Amount)
+		if err != nil {
+			log.Printf("ERROR inserting split: %v", err)
+			return nil, err
+		}
+		splits = append(splits, s)
+	}
+	return splits, nil
+}
+
+// GetSplits returns the split lines of a transaction, largest first.
+func GetSplits(db *pgx.Conn, transactionID uuid.UUID) ([]model.Split, error) {
+	return scanSplits(db.Query(context.Background(),
+		`SELECT `+splitColumns+` FROM TRANSACTION_SPLIT WHERE transaction_id = $1 ORDER BY amount DESC, category;`, transactionID))
+}
+
+// attachSplits fills in the split lines of the transactions.
+func attachSplits(q queryer, transactions []model.TransactionInfo) error {
+	ids := make([]uuid.UUID, len(transactions))
+	for i, t := range transactions {
+		ids[i] = t.TransactionID
+	}
+	splits, err := scanSplits(q.Query(context.Background(),
+		`SELECT `+splitColumns+` FROM TRANSACTION_SPLIT WHERE transaction_id = ANY($1) ORDER BY amount DESC, category;`, ids))
+	if err != nil {
+		return err
+	}
+	byTransaction := make(map[uuid.UUID][]model.Split)
+	for _, s := range splits {
+		byTransaction[s.TransactionID] = append(byTransaction[s.TransactionID], s)
+	}
+	for i := range transactions {
+		transactions[i].Splits = byTransaction[transactions[i].TransactionID]
+	}
+	return nil
+}
+
+// GetTransaction returns a transaction that is not in the trash, with its
+// split lines.
+func GetTransaction(db *pgx.Conn, id uuid.UUID) (model.TransactionInfo, error) {
+	transactions, err := scanTransactionInfos(db.Query(context.Background(),
+		`SELECT `+transactionColumns+` FROM TRANSACTION WHERE transaction_id = $1 AND deleted_at IS NULL;`, id))
+	if err != nil {
+		return model.TransactionInfo{}, err
+	}
+	if len(transactions) == 0 {
+		return model.TransactionInfo{}, ErrTransactionNotFound
+	}
+	if err := attachSplits(db, transactions); err != nil {
+		return model.TransactionInfo{}, err
+	}
+	return transactions[0], nil
+}
+
+// SaveSplits replaces the split lines of a transaction. Saving no lines turns
+// it back into a transaction of a single category. The source balance is not
+// touched, since the lines always add up to the amount.
+func SaveSplits(db *pgx.Conn, actor model.Actor, transactionID uuid.UUID, lines []model.SplitLine) error {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var amount float64
+	err = tx.QueryRow(context.Background(),
+		`SELECT amount FROM TRANSACTION WHERE transaction_id = $1 AND deleted_at IS NULL FOR UPDATE;`, transactionID).Scan(&amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTransactionNotFound
+	} else if err != nil {
+		return err
+	}
+	if len(lines) > 0 {
+		if err := checkSplits(lines, amount); err != nil {
+			return err
+		}
+	}
+
+	before, err := scanSplits(tx.Query(context.Background(),
+		`DELETE FROM TRANSACTION_SPLIT WHERE transaction_id = $1 RETURNING `+splitColumns+`;`, transactionID))
+	if err != nil {
+		return err
+	}
+	after, err := insertSplits(tx, transactionID, lines)
+	if err != nil {
+		return err
+	}
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+	if err = recordAudit(tx, actor, AuditTransactionSplit, "transaction", transactionID.String(), before, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
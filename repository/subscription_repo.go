@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"finance-tracker/model"
+	"finance-tracker/subscription"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// subscriptionHistoryYears is how far back charges are analyzed.
+const subscriptionHistoryYears = 3
+
+// GetSubscriptions detects recurring charges in the expense history of every
+// payee, as of today. Missed subscriptions come first, then the most
+// expensive; ended ones come last.
+func GetSubscriptions(db *pgx.Conn, today time.Time) ([]model.Subscription, error) {
+	query := `
+		SELECT T.payee_id, P.name, COALESCE(NULLIF(T.category, ''), ''), T.source_name, T.transaction_date, T.amount
+		FROM TRANSACTION T
+			JOIN PAYEE P ON P.payee_id = T.payee_id
+		WHERE T.deleted_at IS NULL
+		  AND T.transfer_id IS NULL
+		  AND LOWER(T.category_type) = 'expense'
+		  AND T.transaction_date >= $1::date
+		ORDER BY T.payee_id, T.transaction_date;`
+	rows, err := db.Query(context.Background(), query, today.AddDate(-subscriptionHistoryYears, 0, 0))
+	if err != nil {
+		log.Printf("ERROR querying charges: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The category and source of a subscription are those of the payee's
+	// latest charge.
+	type payeeCharges struct {
+		payee, category, source string
+		charges                 []subscription.Charge
+	}
+	byPayee := make(map[uuid.UUID]*payeeCharges)
+	var order []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		var name, category, source string
+		var c subscription.Charge
+		if err := rows.Scan(&id, &name, &category, &source, &c.Date, &c.Amount); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		p, ok := byPayee[id]
+		if !ok {
+			p = &payeeCharges{payee: name}
+			byPayee[id] = p
+			order = append(order, id)
+		}
+		p.category, p.source = category, source
+		p.charges = append(p.charges, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var subscriptions []model.Subscription
+	for _, id := range order {
+		p := byPayee[id]
+		s, ok := subscription.Detect(p.charges, today)
+		if !ok {
+			continue
+		}
+		s.PayeeID, s.Payee, s.Category, s.SourceName = id, p.payee, p.category, p.source
+		subscriptions = append(subscriptions, s)
+	}
+
+	rank := map[string]int{model.SubscriptionMissed: 0, model.SubscriptionActive: 1, model.SubscriptionEnded: 2}
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if rank[a.Status] != rank[b.Status] {
+			return rank[a.Status] < rank[b.Status]
+		}
+		return a.AnnualCost > b.AnnualCost
+	})
+	return subscriptions, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"finance-tracker/classify"
+	"finance-tracker/model"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// holdoutEvery is how many transactions out of each group are kept back to
+// measure the classifier's accuracy: one in five.
+const holdoutEvery = 5
+
+// minHoldout is the least number of held-out transactions an accuracy is
+// reported for.
+const minHoldout = 10
+
+// categoryModel suggests categories for new transactions. TrainCategoryModel
+// rebuilds it from history and AddTransactions teaches it every categorized
+// transaction in between.
+var categoryModel = classify.New()
+
+var (
+	holdoutMu       sync.RWMutex
+	holdoutAccuracy *float64
+	holdoutSize     int
+)
+
+// getCategorySamples returns every categorized transaction, by the name it
+// was entered with so that rule renames don't hide the merchant.
+func getCategorySamples(db *pgx.Conn) ([]classify.Sample, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT COALESCE(raw_name, category_name), amount, category_type, category
+		FROM TRANSACTION
+		WHERE category IS NOT NULL AND deleted_at IS NULL
+		ORDER BY transaction_date, created_at;`)
+	if err != nil {
+		log.Printf("ERROR querying categorized transactions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []classify.Sample
+	for rows.Next() {
+		var s classify.Sample
+		if err := rows.Scan(&s.Name, &s.Amount, &s.CategoryType, &s.Category); err != nil {
+			log.Printf("ERROR scanning categorized transaction: %v", err)
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// TrainCategoryModel retrains the category classifier from every categorized
+// transaction, picking up deletions and re-applied rules, and measures its
+// accuracy on a holdout set. It returns the number of transactions trained on.
+func TrainCategoryModel(db *pgx.Conn) (int, error) {
+	samples, err := getCategorySamples(db)
+	if err != nil {
+		return 0, err
+	}
+
+	accuracy, heldOut := classify.Evaluate(samples, holdoutEvery)
+	holdoutMu.Lock()
+	holdoutAccuracy, holdoutSize = nil, heldOut
+	if heldOut >= minHoldout {
+		holdoutAccuracy = &accuracy
+	}
+	holdoutMu.Unlock()
+
+	categoryModel.Replace(samples)
+	return len(samples), nil
+}
+
+// learnCategory teaches the classifier a transaction that was just added.
+func learnCategory(t newTransaction) {
+	name := t.CategoryName
+	if t.RawName != "" {
+		name = t.RawName
+	}
+	categoryModel.Add(classify.Sample{Name: name, Amount: t.Amount, CategoryType: t.CategoryType, Category: t.Category})
+}
+
+// SuggestCategories returns the most likely categories for a transaction,
+// learned from the categories of past transactions.
+func SuggestCategories(name string, amount float64, categoryType string, limit int) model.CategorySuggestions {
+	holdoutMu.RLock()
+	defer holdoutMu.RUnlock()
+	return model.CategorySuggestions{
+		Suggestions:     categoryModel.Suggest(strings.TrimSpace(name), amount, categoryType, limit),
+		TrainedOn:       categoryModel.Len(),
+		HoldoutAccuracy: holdoutAccuracy,
+		HoldoutSize:     holdoutSize,
+	}
+}
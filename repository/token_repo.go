@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidToken = errors.New("repository: the api token is invalid or has been revoked")
+var ErrInvalidScope = errors.New("repository: unknown token scope")
+var ErrEmptyTokenName = errors.New("repository: the token name cant be empty")
+
+// tokenPrefix makes tokens easy to recognise in scripts and secret scanners.
+const tokenPrefix = "ft_"
+
+// hashToken returns the value stored in the database for a plaintext token.
+// Only the hash is persisted, so a leaked database does not leak tokens.
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken generates a new token and stores its hash. The plaintext is
+// returned once and cannot be recovered afterwards.
+func CreateAPIToken(db *pgx.Conn, req model.CreateTokenRequest) (string, model.APIToken, error) {
+	var t model.APIToken
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", t, ErrEmptyTokenName
+	}
+	if len(req.Scopes) == 0 {
+		return "", t, ErrInvalidScope
+	}
+	for _, s := range req.Scopes {
+		if !model.ValidScope(s) {
+			return "", t, ErrInvalidScope
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", t, err
+	}
+	plaintext := tokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	query := `INSERT INTO API_TOKEN (name, token_hash, scopes)
+			  VALUES ($1, $2, $3)
+			  RETURNING token_id, name, scopes, created_at, last_used_at, revoked_at;`
+	err := db.QueryRow(context.Background(), query, name, hashToken(plaintext), req.Scopes).
+		Scan(&t.TokenID, &t.Name, &t.Scopes, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt)
+	if err != nil {
+		log.Printf("ERROR inserting api token: %v", err)
+		return "", t, err
+	}
+	return plaintext, t, nil
+}
+
+func GetAllAPITokens(db *pgx.Conn) ([]model.APIToken, error) {
+	query := `SELECT token_id, name, scopes, created_at, last_used_at, revoked_at
+			  FROM API_TOKEN
+			  ORDER BY created_at DESC;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying api tokens: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []model.APIToken
+	for rows.Next() {
+		var t model.APIToken
+		err := rows.Scan(&t.TokenID, &t.Name, &t.Scopes, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func RevokeAPITokens(db *pgx.Conn, ids []uuid.UUID) (int64, error) {
+	query := "UPDATE API_TOKEN SET revoked_at = NOW() WHERE token_id = ANY($1) AND revoked_at IS NULL"
+	result, err := db.Exec(context.Background(), query, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// AuthenticateAPIToken looks up an active token by its plaintext value and
+// records the time it was used.
+func AuthenticateAPIToken(db *pgx.Conn, plaintext string) (model.APIToken, error) {
+	var t model.APIToken
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return t, ErrInvalidToken
+	}
+
+	query := `UPDATE API_TOKEN SET last_used_at = NOW()
+			  WHERE token_hash = $1 AND revoked_at IS NULL
+			  RETURNING token_id, name, scopes, created_at, last_used_at, revoked_at;`
+	err := db.QueryRow(context.Background(), query, hashToken(plaintext)).
+		Scan(&t.TokenID, &t.Name, &t.Scopes, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return t, ErrInvalidToken
+		}
+		log.Printf("ERROR authenticating api token: %v", err)
+		return t, err
+	}
+	return t, nil
+}
@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"errors"
+	"finance-tracker/events"
 	"finance-tracker/model"
+	"finance-tracker/rules"
 	"fmt"
 	"log"
 	"strconv"
@@ -34,6 +36,45 @@ func CheckSourceActive(db *pgx.Conn, name string) (string, error) {
 }
 
 func GetAllTransactions(db *pgx.Conn) ([]model.TransactionInfo, error) {
+	return GetTransactions(db, model.TransactionFilter{})
+}
+
+// GetTransactions returns the transactions matching the filter, newest first,
+// with their split lines and custom field values.
+func GetTransactions(db *pgx.Conn, f model.TransactionFilter) ([]model.TransactionInfo, error) {
+	conditions := []string{"T.DELETED_AT IS NULL"}
+	var args []any
+	addCondition := func(format string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if f.Tag != "" {
+		addCondition("EXISTS (SELECT 1 FROM unnest(T.TAGS) AS tag WHERE LOWER(tag) = LOWER($%d))", strings.TrimSpace(f.Tag))
+	}
+	if f.Query != "" {
+		addCondition("(T.CATEGORY_NAME ILIKE $%[1]d OR T.DESCRIPTION ILIKE $%[1]d)", "%"+likeEscaper.Replace(strings.TrimSpace(f.Query))+"%")
+	}
+	if f.FieldID != "" {
+		fieldID, err := uuid.Parse(f.FieldID)
+		if err != nil {
+			return nil, ErrUnknownField
+		}
+		args = append(args, fieldID)
+		match := fmt.Sprintf("V.FIELD_ID = $%d", len(args))
+		if f.FieldValue != "" {
+			args = append(args, strings.TrimSpace(f.FieldValue))
+			match += fmt.Sprintf(" AND LOWER(%s) = LOWER($%d)", fieldValueText, len(args))
+		}
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM TRANSACTION_FIELD_VALUE V WHERE V.TRANSACTION_ID = T.TRANSACTION_ID AND "+match+")")
+	}
+	if f.Payee != "" {
+		payeeID, err := uuid.Parse(f.Payee)
+		if err != nil {
+			return nil, ErrPayeeNotFound
+		}
+		addCondition("T.PAYEE_ID = $%d", payeeID)
+	}
 
 	rows, err := db.Query(context.Background(), `SELECT
 													T.TRANSACTION_ID,
@@ -41,20 +82,31 @@ func GetAllTransactions(db *pgx.Conn) ([]model.TransactionInfo, error) {
 													T.CATEGORY_TYPE,
 													T.CATEGORY_NAME,
 													T.TRANSACTION_DATE,
-													A.SOURCE_NAME
+													A.SOURCE_NAME,
+													COALESCE(T.CATEGORY, ''),
+													COALESCE(T.TAGS, '{}'),
+													T.RULE_ID,
+													COALESCE(T.DESCRIPTION, ''),
+													T.PAYEE_ID,
+													COALESCE(R.NAME, ''),
+													COALESCE(P.NAME, '')
 												FROM TRANSACTION T
 													JOIN ACCOUNT A ON T.SOURCE_NAME = A.SOURCE_NAME
+													LEFT JOIN CATEGORY_RULE R ON R.RULE_ID = T.RULE_ID
+													LEFT JOIN PAYEE P ON P.PAYEE_ID = T.PAYEE_ID
+												WHERE `+strings.Join(conditions, " AND ")+`
 												ORDER BY T.TRANSACTION_DATE DESC, T.CREATED_AT DESC;
-												`)
+												`, args...)
 	if err != nil {
 		log.Printf("ERROR querying transactions : %v\n", err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	var AllTransactions []model.TransactionInfo
 	for rows.Next() {
 		var t model.TransactionInfo
-		err := rows.Scan(&t.TransactionID,&t.Amount, &t.CategoryType, &t.CategoryName, &t.TransactionDate, &t.SourceName)
+		err := rows.Scan(append(transactionScanTargets(&t), &t.RuleName, &t.PayeeName)...)
 		if err != nil {
 			log.Printf("ERROR scanning row: %v\n", err)
 			return nil, err
@@ -66,10 +118,19 @@ func GetAllTransactions(db *pgx.Conn) ([]model.TransactionInfo, error) {
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
+	if err := attachSplits(db, AllTransactions); err != nil {
+		return nil, err
+	}
+	if err := attachFieldValues(db, AllTransactions); err != nil {
+		return nil, err
+	}
 	return AllTransactions, nil
 }
 
-func AddTransactions(db *pgx.Conn, req model.AddTransactionRequest) error {
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func AddTransactions(db *pgx.Conn, actor model.Actor, req model.AddTransactionRequest) error {
 	amount, err := strconv.ParseFloat(req.Amount, 64)
 	if err != nil {
 		log.Printf("Error parsing string to Float64: %v\n", err)
@@ -82,6 +143,21 @@ func AddTransactions(db *pgx.Conn, req model.AddTransactionRequest) error {
 	if categoryType != "income" && categoryType != "expense" {
 		return errors.New("invalid category_type: must be 'income' or 'expense'")
 	}
+	if len(req.Splits) > 0 {
+		if err := checkSplits(req.Splits, amount); err != nil {
+			return err
+		}
+	}
+
+	t := newTransaction{
+		CategoryType:    req.CategoryType,
+		CategoryName:    req.CategoryName,
+		Amount:          amount,
+		TransactionDate: req.TransactionDate,
+		SourceName:      req.SourceName,
+		Tags:            rules.ParseTags(req.Tags),
+		Description:     strings.TrimSpace(req.Notes),
+	}
 
 	// 1. Begin a database transaction
 	tx, err := db.Begin(context.Background())
@@ -91,62 +167,207 @@ func AddTransactions(db *pgx.Conn, req model.AddTransactionRequest) error {
 	}
 	defer tx.Rollback(context.Background())
 
-	var updateQuery string
+	if !req.AllowDuplicate {
+		duplicates, err := findDuplicates(tx, t)
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return ErrPossibleDuplicate
+		}
+	}
+
 	if categoryType == "expense" {
-		var currentBalance float64
-		checkBalanceQuery := `SELECT balance FROM ACCOUNT WHERE source_name = $1;`
+		if err := checkSufficientBalance(tx, req.SourceName, amount); err != nil {
+			return err
+		}
+	}
+	if err = adjustBalance(tx, actor, req.SourceName, balanceDelta(categoryType, amount)); err != nil {
+		return err
+	}
 
-		err := db.QueryRow(context.Background(),checkBalanceQuery, req.SourceName).Scan(&currentBalance)
+	if err = applyRules(tx, actor, &t); err != nil {
+		return err
+	}
+	if t.TransferID == nil {
+		p, err := resolvePayee(tx, actor, t.enteredName())
 		if err != nil {
-			return fmt.Errorf("error checking balance for source '%s': %w", req.SourceName, err)
+			return err
 		}
-		if currentBalance < amount {
-			return ErrNotEnoughBalance
+		if p != nil {
+			t.PayeeID = &p.PayeeID
+			// The payee's default category applies when no rule set one.
+			if t.Category == "" {
+				t.Category = p.DefaultCategory
+			}
 		}
-		updateQuery = `UPDATE ACCOUNT SET balance = balance - $1 WHERE source_name = $2;` 
-	} else {
-		updateQuery = `UPDATE ACCOUNT SET balance = balance + $1 WHERE source_name = $2;`
 	}
-
-	cmdTag, err := tx.Exec(context.Background(), updateQuery, amount, req.SourceName)
+	// A category picked by hand wins over the one a rule or payee set.
+	if category := strings.TrimSpace(req.Category); category != "" {
+		t.Category = category
+	}
+	created, err := insertTransaction(tx, actor, t)
 	if err != nil {
-		log.Printf("ERROR updating balance: %v", err)
 		return err
 	}
-    
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("account with source_name '%s' not found", req.SourceName)
+	if err = setFieldValuesByName(tx, actor, created.TransactionID, req.Fields); err != nil {
+		return err
+	}
+	if len(req.Splits) > 0 {
+		splits, err := insertSplits(tx, created.TransactionID, req.Splits)
+		if err != nil {
+			return err
+		}
+		if err = recordAudit(tx, actor, AuditTransactionSplit, "transaction", created.TransactionID.String(), nil, splits); err != nil {
+			return err
+		}
+	}
+	if categoryType == "expense" && t.TransferID == nil {
+		if _, err = recordAnomalies(tx, created); err != nil {
+			return err
+		}
 	}
 
+	if err = tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	learnCategory(t)
+	log.Println("Success adding new transaction")
+	return nil
+}
 
-	insertQuery := `INSERT INTO TRANSACTION 
-					  (category_type, category_name, amount, transaction_date, source_name)
-					  VALUES ($1, $2, $3, $4, $5);`
+// transactionColumns are the TRANSACTION columns read into a
+// model.TransactionInfo, in the order expected by transactionScanTargets.
+const transactionColumns = "transaction_id, amount, category_type, category_name, transaction_date, source_name, COALESCE(category, ''), COALESCE(tags, '{}'), rule_id, COALESCE(description, ''), payee_id"
+
+func transactionScanTargets(t *model.TransactionInfo) []any {
+	return []any{&t.TransactionID, &t.Amount, &t.CategoryType, &t.CategoryName, &t.TransactionDate, &t.SourceName, &t.Category, &t.Tags, &t.RuleID, &t.Notes, &t.PayeeID}
+}
+
+// newTransaction holds the columns of a transaction row about to be inserted.
+type newTransaction struct {
+	CategoryType    string
+	CategoryName    string
+	Amount          float64
+	TransactionDate string
+	SourceName      string
+	TransferID      *uuid.UUID
+	Category        string
+	// RawName is the name as entered, kept when a rule renamed the transaction.
+	RawName string
+	Tags    []string
+	RuleID  *uuid.UUID
+	// Description holds the notes of the transaction.
+	Description string
+	PayeeID     *uuid.UUID
+}
+
+// enteredName is the name the transaction was entered with, before any rule
+// renamed it.
+func (t newTransaction) enteredName() string {
+	if t.RawName != "" {
+		return t.RawName
+	}
+	return t.CategoryName
+}
 
-	_, err = tx.Exec(context.Background(), insertQuery, req.CategoryType, req.CategoryName, amount, req.TransactionDate, req.SourceName)
+// insertTransaction inserts a transaction row and records it in the audit log.
+// It does not touch the source balance; callers apply that separately.
+func insertTransaction(tx pgx.Tx, actor model.Actor, t newTransaction) (model.TransactionInfo, error) {
+	insertQuery := `INSERT INTO TRANSACTION 
+					  (category_type, category_name, amount, transaction_date, source_name, transfer_id, category, raw_name, tags, rule_id, description, payee_id)
+					  VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, NULLIF($11, ''), $12)
+					  RETURNING ` + transactionColumns + `;`
+
+	var created model.TransactionInfo
+	err := tx.QueryRow(context.Background(), insertQuery, t.CategoryType, t.CategoryName, t.Amount, t.TransactionDate, t.SourceName,
+		t.TransferID, t.Category, t.RawName, t.Tags, t.RuleID, t.Description, t.PayeeID).
+		Scan(transactionScanTargets(&created)...)
 	if err != nil {
 		log.Printf("ERROR inserting transaction: %v", err)
-		return err
+		return created, err
 	}
 
-	log.Println("Success adding new transaction")
-	return tx.Commit(context.Background())
+	if err = recordAudit(tx, actor, AuditTransactionCreate, "transaction", created.TransactionID.String(), nil, created); err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+// checkSufficientBalance returns ErrNotEnoughBalance if the source can't cover
+// taking amount out of it.
+func checkSufficientBalance(q queryer, sourceName string, amount float64) error {
+	account, err := getAccount(q, sourceName)
+	if err != nil {
+		return fmt.Errorf("error checking balance for source '%s': %w", sourceName, err)
+	}
+	if account == nil {
+		return fmt.Errorf("error checking balance for source '%s': %w", sourceName, ErrSourceNotFound)
+	}
+	// Asset sources can't go below zero, credit cards and loans can't go
+	// below minus their credit limit.
+	if account.Available() < amount {
+		return ErrNotEnoughBalance
+	}
+	return nil
+}
+
+// balanceDelta returns how a transaction changes the balance of its source.
+func balanceDelta(categoryType string, amount float64) float64 {
+	if strings.EqualFold(categoryType, "expense") {
+		return -amount
+	}
+	return amount
+}
+
+// adjustBalance adds delta to a source's balance, records the change in the
+// audit log and publishes events.LowBalance when the source drops below its
+// low-balance threshold.
+func adjustBalance(tx pgx.Tx, actor model.Actor, sourceName string, delta float64) error {
+	before, err := getAccount(tx, sourceName)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return fmt.Errorf("account with source_name '%s' not found", sourceName)
+	}
+	_, err = tx.Exec(context.Background(), `UPDATE ACCOUNT SET balance = balance + $1 WHERE source_name = $2;`, delta, sourceName)
+	if err != nil {
+		log.Printf("ERROR updating balance: %v", err)
+		return err
+	}
+	after, err := getAccount(tx, sourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditSourceBalance, "source", sourceName, before, after); err != nil {
+		return err
+	}
+	// Announce crossing the low-balance threshold, not every change below it.
+	if after.BelowThreshold() && !before.BelowThreshold() {
+		log.Printf("Source %s dropped below its low-balance threshold", sourceName)
+		return events.Publish(tx, events.LowBalance{Account: *after})
+	}
+	return nil
 }
 
 var ErrDuplicateSource = errors.New("repository: source with that name already exists")
 var ErrInvalidBalance = errors.New("repository: initial balance cannot be negative")
 var ErrNotEnoughBalance = errors.New("repository: the choosen source doesnt have enough in balance")
 var ErrNegativeAmount = errors.New("repository: The transaction amount cant be negative")
+var ErrInvalidSourceType = errors.New("repository: unknown source type")
+var ErrCreditLimitRequired = errors.New("repository: credit cards and loans need a positive credit limit")
 
-func AddSource(db *pgx.Conn,a model.AddSourceRequest) error {
+func AddSource(db *pgx.Conn, actor model.Actor, a model.AddSourceRequest) error {
 	var SourceQuery string
 	status,err := CheckSourceActive(db,a.SourceName);
 	if status == "active" {
 		return ErrDuplicateSource
 	} else if status == "inactive" {
-		SourceQuery = "UPDATE account set is_active = true, balance = balance + $1 WHERE source_name = $2"
+		// Reactivating must be explicit, see ReactivateSources.
+		return ErrSourceInactive
 	} else if  status == "not_found" {
-		SourceQuery = "INSERT INTO ACCOUNT (balance,source_name) VALUES ($1,$2);"
+		SourceQuery = "INSERT INTO ACCOUNT (balance,source_name,source_type,credit_limit) VALUES ($1,$2,$3,$4);"
 	} else {
 		return err
 	}
@@ -163,26 +384,70 @@ func AddSource(db *pgx.Conn,a model.AddSourceRequest) error {
 		}
 	}
 
-	if balance < 0 {
+	sourceType := a.SourceType
+	if sourceType == "" {
+		sourceType = model.SourceChecking
+	}
+	if !model.ValidSourceType(sourceType) {
+		return ErrInvalidSourceType
+	}
+
+	var creditLimit *float64
+	if model.IsLiability(sourceType) {
+		limit, err := strconv.ParseFloat(a.CreditLimit, 64)
+		if err != nil || limit <= 0 {
+			return ErrCreditLimitRequired
+		}
+		creditLimit = &limit
+		// A credit card or loan may start out owing money, up to its limit.
+		if balance < -limit {
+			return ErrInvalidBalance
+		}
+	} else if balance < 0 {
         return ErrInvalidBalance
     }
-	_,err = db.Exec(context.Background(),SourceQuery,balance,a.SourceName)
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_,err = tx.Exec(context.Background(),SourceQuery,balance,a.SourceName,sourceType,creditLimit)
 	if err != nil {
 		log.Printf("Error adding new source: %v\n",err)
 		return err
 	}
-	return nil
+	after, err := getAccount(tx, a.SourceName)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(tx, actor, AuditSourceCreate, "source", a.SourceName, nil, after); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
 }
 
 
 
-func GetSummary(db *pgx.Conn) (balance, monthIncome, monthExpense float64, Error error) {
-	BalanceQuery := `SELECT COALESCE(SUM(balance), 0) FROM account WHERE is_active = TRUE;` 
+// GetSummary totals the active sources, separating assets from liabilities
+// (money owed on credit cards and loans), and this month's income and expense.
+func GetSummary(db *pgx.Conn) (model.Summary, error) {
+	var summary model.Summary
+	BalanceQuery := `
+		SELECT
+			COALESCE(SUM(CASE WHEN source_type IN ('credit_card', 'loan') THEN 0 ELSE balance END), 0),
+			COALESCE(SUM(CASE WHEN source_type IN ('credit_card', 'loan') THEN -balance ELSE 0 END), 0)
+		FROM account
+		WHERE is_active = TRUE;`
 
-	err := db.QueryRow(context.Background(), BalanceQuery).Scan(&balance)
+	err := db.QueryRow(context.Background(), BalanceQuery).Scan(&summary.Assets, &summary.Liabilities)
 	if err != nil {
 		log.Printf("ERROR querying total balance: %v\n", err)
+		return summary, err
 	}
+	summary.NetWorth = summary.Assets - summary.Liabilities
 
 	monthlyQuery := `
 		SELECT 
@@ -191,16 +456,19 @@ func GetSummary(db *pgx.Conn) (balance, monthIncome, monthExpense float64, Error
 		FROM 
 			transaction
 		WHERE 
-			DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE);
+			DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
+			AND deleted_at IS NULL
+			AND transfer_id IS NULL;
 	`
-	err = db.QueryRow(context.Background(), monthlyQuery).Scan(&monthIncome, &monthExpense)
+	err = db.QueryRow(context.Background(), monthlyQuery).Scan(&summary.MonthIncome, &summary.MonthExpense)
 	if err != nil {
 		log.Printf("ERROR querying monthly summary: %v\n", err)
+		return summary, err
 	}
-	return
+	return summary, nil
 }
 func GetAllSources(db *pgx.Conn) ([]model.Account, error) {
-	query := `SELECT * FROM ACCOUNT WHERE is_active = TRUE`
+	query := `SELECT ` + accountColumns + ` FROM ACCOUNT WHERE is_active = TRUE`
 	rows, err := db.Query(context.Background(), query)
 	if err != nil {
 		log.Printf("ERROR querying: %v", err)
@@ -208,7 +476,7 @@ func GetAllSources(db *pgx.Conn) ([]model.Account, error) {
 	var AllSource []model.Account
 	for rows.Next() {
 		var a model.Account
-		err := rows.Scan(&a.SourceName, &a.Balance, &a.CreatedAt,&a.IsActive)
+		err := rows.Scan(accountScanTargets(&a)...)
 		if err != nil {
 			log.Printf("ERROR scanning row: %v\n", err)
 			return nil, err
@@ -243,23 +511,111 @@ func GetAllSoucesName(db *pgx.Conn) ([]string, error) {
 	}
 	return Name, nil
 }
-func DeleteTransactionsByIDs(db *pgx.Conn, ids []uuid.UUID) (int64, error) {
-    query := "DELETE FROM transaction WHERE transaction_id = ANY($1)"
-    
-    result, err := db.Exec(context.Background(), query, ids)
+// DeleteTransactionsByIDs moves transactions to the trash and reverses their
+// effect on the source balances. All rows deleted by one call share a batch
+// ID, which RestoreBatch uses to undo the deletion.
+func DeleteTransactionsByIDs(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (uuid.UUID, int64, error) {
+    batch := uuid.New()
+    tx, err := db.Begin(context.Background())
     if err != nil {
-        return 0, err
+        log.Printf("ERROR begin a transaction: %v", err)
+        return uuid.Nil, 0, err
     }
+    defer tx.Rollback(context.Background())
 
-    return result.RowsAffected(), nil
+    n, err := trashTransactions(tx, actor, ids, batch)
+    if err != nil {
+        return uuid.Nil, 0, err
+    }
+    if err = tx.Commit(context.Background()); err != nil {
+        return uuid.Nil, 0, err
+    }
+    return batch, n, nil
 }
 
-func InactiveSources(db *pgx.Conn, names []string) (int64, error) {
-    query := "UPDATE account SET is_active = FALSE WHERE source_name = ANY($1)"
-    result, err := db.Exec(context.Background(), query, names)
+// trashTransactions moves transactions to the trash as part of batch and
+// reverses their effect on the source balances. The other leg of a transfer
+// and the other transactions of a loan payment go with them.
+func trashTransactions(tx pgx.Tx, actor model.Actor, ids []uuid.UUID, batch uuid.UUID) (int64, error) {
+    linked, err := linkedTransactions(tx, ids)
     if err != nil {
         return 0, err
     }
+    ids = append(ids, linked...)
+
+    query := `UPDATE transaction SET deleted_at = NOW(), deleted_batch = $2
+              WHERE transaction_id = ANY($1) AND deleted_at IS NULL
+              RETURNING ` + transactionColumns
+    deleted, err := scanTransactionInfos(tx.Query(context.Background(), query, ids, batch))
+    if err != nil {
+        return 0, err
+    }
+
+    for _, t := range deleted {
+        if err = recordAudit(tx, actor, AuditTransactionDelete, "transaction", t.TransactionID.String(), t, nil); err != nil {
+            return 0, err
+        }
+        // Restoring needs an active source, so a transaction of an inactive
+        // one, such as the settlement leg of a closed source, stays put.
+        source, err := getAccount(tx, t.SourceName)
+        if err != nil {
+            return 0, err
+        }
+        if source == nil || !source.IsActive {
+            return 0, ErrSourceInactive
+        }
+        // Taking back an income must not overdraw the source, the same as
+        // adding an expense.
+        delta := -balanceDelta(t.CategoryType, t.Amount)
+        if delta < 0 {
+            if err = checkSufficientBalance(tx, t.SourceName, -delta); err != nil {
+                return 0, err
+            }
+        }
+        if err = adjustBalance(tx, actor, t.SourceName, delta); err != nil {
+            return 0, err
+        }
+    }
+    return int64(len(deleted)), nil
+}
+
+// InactiveSources moves sources to the trash. Their balance and transactions
+// are kept so they can be restored until the trash is purged.
+func InactiveSources(db *pgx.Conn, actor model.Actor, names []string) (uuid.UUID, int64, error) {
+    batch := uuid.New()
+    tx, err := db.Begin(context.Background())
+    if err != nil {
+        log.Printf("ERROR begin a transaction: %v", err)
+        return uuid.Nil, 0, err
+    }
+    defer tx.Rollback(context.Background())
 
-    return result.RowsAffected(), nil
-}
\ No newline at end of file
+    var affected int64
+    for _, name := range names {
+        before, err := getAccount(tx, name)
+        if err != nil {
+            return uuid.Nil, 0, err
+        }
+        if before == nil || !before.IsActive {
+            continue
+        }
+        query := "UPDATE account SET is_active = FALSE, deleted_at = NOW(), deleted_batch = $2 WHERE source_name = $1"
+        _, err = tx.Exec(context.Background(), query, name, batch)
+        if err != nil {
+            return uuid.Nil, 0, err
+        }
+        after, err := getAccount(tx, name)
+        if err != nil {
+            return uuid.Nil, 0, err
+        }
+        if err = recordAudit(tx, actor, AuditSourceDeactivate, "source", name, before, after); err != nil {
+            return uuid.Nil, 0, err
+        }
+        affected++
+    }
+
+    if err = tx.Commit(context.Background()); err != nil {
+        return uuid.Nil, 0, err
+    }
+    return batch, affected, nil
+}
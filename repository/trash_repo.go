@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"finance-tracker/model"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrSourceInTrash = errors.New("repository: restore the source of this transaction first")
+
+// scanTransactionInfos reads rows of transactionColumns.
+func scanTransactionInfos(rows pgx.Rows, err error) ([]model.TransactionInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TransactionInfo
+	for rows.Next() {
+		var t model.TransactionInfo
+		if err := rows.Scan(transactionScanTargets(&t)...); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// linkedTransactions returns the transactions that go in and out of the trash
+// together with ids: the other leg of each transfer, which covers card
+// payments and the settlements of closed sources, and the other transactions
+// of each loan payment. Moving only one leg would create or destroy money.
+func linkedTransactions(q queryer, ids []uuid.UUID) ([]uuid.UUID, error) {
+	query := `SELECT T.transaction_id
+			  FROM TRANSACTION T
+			  WHERE T.transfer_id IN (SELECT transfer_id FROM TRANSACTION
+									  WHERE transaction_id = ANY($1) AND transfer_id IS NOT NULL);`
+	rows, err := q.Query(context.Background(), query, ids)
+	if err != nil {
+		log.Printf("ERROR querying transfer legs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var linked []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		linked = append(linked, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	payments, err := loanPaymentTransactions(q, ids)
+	if err != nil {
+		return nil, err
+	}
+	return append(linked, payments...), nil
+}
+
+func GetDeletedTransactions(db *pgx.Conn) ([]model.TrashedTransaction, error) {
+	query := `SELECT ` + transactionColumns + `, deleted_at
+			  FROM TRANSACTION
+			  WHERE deleted_at IS NOT NULL
+			  ORDER BY deleted_at DESC;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying deleted transactions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TrashedTransaction
+	for rows.Next() {
+		var t model.TrashedTransaction
+		err := rows.Scan(append(transactionScanTargets(&t.TransactionInfo), &t.DeletedAt)...)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func GetDeletedSources(db *pgx.Conn) ([]model.TrashedSource, error) {
+	query := `SELECT ` + accountColumns + `, deleted_at
+			  FROM ACCOUNT
+			  WHERE deleted_at IS NOT NULL
+			  ORDER BY deleted_at DESC;`
+	rows, err := db.Query(context.Background(), query)
+	if err != nil {
+		log.Printf("ERROR querying deleted sources: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.TrashedSource
+	for rows.Next() {
+		var a model.TrashedSource
+		err := rows.Scan(append(accountScanTargets(&a.Account), &a.DeletedAt)...)
+		if err != nil {
+			log.Printf("ERROR scanning row: %v\n", err)
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// restoreTransactionsWhere takes the matching trashed transactions out of the
+// trash and re-applies their balance effect, together with the other
+// transactions of their transfers and loan payments. Restoring an expense follows the same
+// rule as adding one, so it fails with ErrNotEnoughBalance if the source can
+// no longer cover it.
+func restoreTransactionsWhere(tx pgx.Tx, actor model.Actor, condition string, arg any) (int64, error) {
+	query := `UPDATE transaction SET deleted_at = NULL, deleted_batch = NULL
+			  WHERE deleted_at IS NOT NULL AND ` + condition + `
+			  RETURNING ` + transactionColumns
+	restored, err := scanTransactionInfos(tx.Query(context.Background(), query, arg))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range restored {
+		source, err := getAccount(tx, t.SourceName)
+		if err != nil {
+			return 0, err
+		}
+		if source == nil || !source.IsActive {
+			return 0, ErrSourceInTrash
+		}
+		delta := balanceDelta(t.CategoryType, t.Amount)
+		if delta < 0 {
+			if err := checkSufficientBalance(tx, t.SourceName, -delta); err != nil {
+				return 0, err
+			}
+		}
+		if err := adjustBalance(tx, actor, t.SourceName, delta); err != nil {
+			return 0, err
+		}
+		if err := recordAudit(tx, actor, AuditTransactionRestore, "transaction", t.TransactionID.String(), nil, t); err != nil {
+			return 0, err
+		}
+	}
+	if len(restored) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uuid.UUID, len(restored))
+	for i, t := range restored {
+		ids[i] = t.TransactionID
+	}
+	linked, err := linkedTransactions(tx, ids)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(len(restored))
+	if len(linked) > 0 {
+		// Those just restored are no longer in the trash and are skipped.
+		more, err := restoreTransactionsWhere(tx, actor, "transaction_id = ANY($1)", linked)
+		if err != nil {
+			return 0, err
+		}
+		n += more
+	}
+	return n, nil
+}
+
+func restoreSourcesWhere(tx pgx.Tx, actor model.Actor, condition string, arg any) (int64, error) {
+	query := `UPDATE account SET is_active = TRUE, deleted_at = NULL, deleted_batch = NULL
+			  WHERE deleted_at IS NOT NULL AND ` + condition + `
+			  RETURNING ` + accountColumns
+	rows, err := tx.Query(context.Background(), query, arg)
+	if err != nil {
+		return 0, err
+	}
+	var restored []model.Account
+	for rows.Next() {
+		var a model.Account
+		if err := rows.Scan(accountScanTargets(&a)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		restored = append(restored, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, a := range restored {
+		if err := recordAudit(tx, actor, AuditSourceRestore, "source", a.SourceName, nil, a); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(restored)), nil
+}
+
+func RestoreTransactions(db *pgx.Conn, actor model.Actor, ids []uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	n, err := restoreTransactionsWhere(tx, actor, "transaction_id = ANY($1)", ids)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit(context.Background())
+}
+
+func RestoreSources(db *pgx.Conn, actor model.Actor, names []string) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	n, err := restoreSourcesWhere(tx, actor, "source_name = ANY($1)", names)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit(context.Background())
+}
+
+// RestoreBatch undoes one bulk deletion. Sources are restored before
+// transactions so that transactions of restored sources can be re-applied.
+func RestoreBatch(db *pgx.Conn, actor model.Actor, batch uuid.UUID) (int64, error) {
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	sources, err := restoreSourcesWhere(tx, actor, "deleted_batch = $1", batch)
+	if err != nil {
+		return 0, err
+	}
+	transactions, err := restoreTransactionsWhere(tx, actor, "deleted_batch = $1", batch)
+	if err != nil {
+		return 0, err
+	}
+	return sources + transactions, tx.Commit(context.Background())
+}
+
+// PurgeTrash permanently deletes transactions that have been in the trash for
+// longer than the retention period, and trashed sources that no longer have
+// any transactions.
+func PurgeTrash(db *pgx.Conn, retention time.Duration) (transactions, sources int64, err error) {
+	cutoff := time.Now().Add(-retention)
+
+	tx, err := db.Begin(context.Background())
+	if err != nil {
+		log.Printf("ERROR begin a transaction: %v", err)
+		return 0, 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Loan payments go with their transactions; they are trashed together, so
+	// none is left behind with part of its transactions.
+	paymentQuery := `DELETE FROM LOAN_PAYMENT P
+					 WHERE EXISTS (SELECT 1 FROM TRANSACTION T WHERE ` + loanPaymentLink + ` AND T.deleted_at < $1);`
+	if _, err = tx.Exec(context.Background(), paymentQuery, cutoff); err != nil {
+		log.Printf("ERROR purging loan payments: %v", err)
+		return 0, 0, err
+	}
+
+	query := `DELETE FROM transaction WHERE deleted_at < $1
+			  RETURNING ` + transactionColumns
+	purged, err := scanTransactionInfos(tx.Query(context.Background(), query, cutoff))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, t := range purged {
+		if err = recordAudit(tx, model.SystemActor, AuditTransactionPurge, "transaction", t.TransactionID.String(), t, nil); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	sourceQuery := `DELETE FROM account A
+					WHERE A.deleted_at < $1
+					  AND NOT EXISTS (SELECT 1 FROM transaction T WHERE T.source_name = A.source_name)
+					RETURNING ` + accountColumns
+	rows, err := tx.Query(context.Background(), sourceQuery, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	var purgedSources []model.Account
+	for rows.Next() {
+		var a model.Account
+		if err = rows.Scan(accountScanTargets(&a)...); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		purgedSources = append(purgedSources, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, a := range purgedSources {
+		if err = recordAudit(tx, model.SystemActor, AuditSourcePurge, "source", a.SourceName, a, nil); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		return 0, 0, err
+	}
+	return int64(len(purged)), int64(len(purgedSources)), nil
+}
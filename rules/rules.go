@@ -0,0 +1,147 @@
+// Package rules evaluates categorization rules against transactions.
+package rules
+
+import (
+	"finance-tracker/model"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Compile compiles the rule's name pattern, or returns nil if it has none.
+// Patterns are checked when a rule is saved, so an error here means the rule
+// was stored some other way.
+func Compile(r model.Rule) (*regexp.Regexp, error) {
+	if r.NameRegex == "" {
+		return nil, nil
+	}
+	return regexp.Compile(r.NameRegex)
+}
+
+// Set is a list of rules, ordered by priority, with their name patterns
+// compiled once so it can be matched against many transactions.
+type Set struct {
+	rules   []model.Rule
+	regexes []*regexp.Regexp
+	invalid []bool
+}
+
+// NewSet compiles the patterns of rules. A rule whose pattern doesn't compile
+// never matches.
+func NewSet(rules []model.Rule) *Set {
+	s := &Set{rules: rules, regexes: make([]*regexp.Regexp, len(rules)), invalid: make([]bool, len(rules))}
+	for i, r := range rules {
+		re, err := Compile(r)
+		if err != nil {
+			log.Printf("Skipping rule %q: invalid regular expression: %v", r.Name, err)
+			s.invalid[i] = true
+		}
+		s.regexes[i] = re
+	}
+	return s
+}
+
+// Rule returns the rule with the given id.
+func (s *Set) Rule(id uuid.UUID) (model.Rule, bool) {
+	for _, r := range s.rules {
+		if r.RuleID == id {
+			return r, true
+		}
+	}
+	return model.Rule{}, false
+}
+
+// First returns the first enabled rule that matches.
+func (s *Set) First(name string, t model.TransactionInfo) (model.Rule, bool) {
+	for i, r := range s.rules {
+		if r.Enabled && !s.invalid[i] && matches(r, s.regexes[i], name, t) {
+			return r, true
+		}
+	}
+	return model.Rule{}, false
+}
+
+// matches reports whether every condition set on the rule holds for the
+// transaction. name is the transaction name as it was entered, before any
+// rule renamed it, and re is the rule's compiled pattern.
+func matches(r model.Rule, re *regexp.Regexp, name string, t model.TransactionInfo) bool {
+	if r.NameContains != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(r.NameContains)) {
+		return false
+	}
+	if re != nil && !re.MatchString(name) {
+		return false
+	}
+	if r.MinAmount != nil && t.Amount < *r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != nil && t.Amount > *r.MaxAmount {
+		return false
+	}
+	if r.SourceName != "" && r.SourceName != t.SourceName {
+		return false
+	}
+	if r.CategoryType != "" && !strings.EqualFold(r.CategoryType, t.CategoryType) {
+		return false
+	}
+	return true
+}
+
+// First returns the first enabled rule that matches. rules must be ordered by
+// priority.
+func First(rules []model.Rule, name string, t model.TransactionInfo) (model.Rule, bool) {
+	return NewSet(rules).First(name, t)
+}
+
+// Apply runs the rule's actions on the transaction: it sets the category,
+// renames it and adds tags it doesn't have yet. Marking as a transfer is left
+// to the caller, which owns the transfer id.
+func Apply(r model.Rule, t *model.TransactionInfo) {
+	if r.SetCategory != "" {
+		t.Category = r.SetCategory
+	}
+	if r.RenameTo != "" {
+		t.CategoryName = r.RenameTo
+	}
+	for _, tag := range r.AddTags {
+		if !hasTag(t.Tags, tag) {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	id := r.RuleID
+	t.RuleID = &id
+}
+
+// RemoveTags returns tags without the ones the rule adds.
+func RemoveTags(r model.Rule, tags []string) []string {
+	var kept []string
+	for _, tag := range tags {
+		if !hasTag(r.AddTags, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags splits a comma separated list, dropping empty entries and
+// duplicates.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
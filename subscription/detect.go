@@ -0,0 +1,139 @@
+// Package subscription finds recurring charges, such as streaming services
+// or gym memberships, in the expense history of a payee: charges at a regular
+// interval with similar amounts.
+package subscription
+
+import (
+	"finance-tracker/model"
+	"math"
+	"sort"
+	"time"
+)
+
+// Charge is one expense of a payee.
+type Charge struct {
+	Date   time.Time
+	Amount float64
+}
+
+// cadence is an interval subscriptions are commonly charged at.
+type cadence struct {
+	name string
+	// days is the typical length of the interval and tolerance how far an
+	// interval may deviate from it, in days.
+	days, tolerance int
+	perYear         float64
+	// next returns the date of the charge after one on t; months keep the
+	// day, clamped to the last day of shorter months.
+	next func(time.Time) time.Time
+}
+
+var cadences = []cadence{
+	{model.CadenceWeekly, 7, 2, 52, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{model.CadenceBiweekly, 14, 3, 26, func(t time.Time) time.Time { return t.AddDate(0, 0, 14) }},
+	{model.CadenceMonthly, 30, 5, 12, func(t time.Time) time.Time { return model.AddMonths(t, 1) }},
+	{model.CadenceQuarterly, 91, 10, 4, func(t time.Time) time.Time { return model.AddMonths(t, 3) }},
+	{model.CadenceYearly, 365, 15, 1, func(t time.Time) time.Time { return model.AddMonths(t, 12) }},
+}
+
+const (
+	// MinCharges is how many charges it takes to call something a
+	// subscription; yearly ones only need two.
+	MinCharges = 3
+	// amountSpread is how far, as a fraction, a charge may be from the latest
+	// amount to count as the same subscription. It leaves room for price
+	// changes while ignoring unrelated purchases from the same payee.
+	amountSpread = 0.3
+	// regularShare is the share of intervals that must match the cadence.
+	regularShare = 0.75
+	// endedCycles is after how many cycles without a charge a subscription
+	// is taken to be cancelled rather than missing a charge.
+	endedCycles = 2
+)
+
+// Detect decides whether charges, in any order, form a subscription and
+// describes it as of today. Only the payee and category fields are left for
+// the caller to fill in.
+func Detect(charges []Charge, today time.Time) (model.Subscription, bool) {
+	if len(charges) < 2 {
+		return model.Subscription{}, false
+	}
+	sorted := make([]Charge, len(charges))
+	copy(sorted, charges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	latest := sorted[len(sorted)-1].Amount
+	var matching []Charge
+	for _, c := range sorted {
+		if math.Abs(c.Amount-latest) <= latest*amountSpread {
+			matching = append(matching, c)
+		}
+	}
+	if len(matching) < 2 {
+		return model.Subscription{}, false
+	}
+
+	intervals := make([]int, len(matching)-1)
+	for i := 1; i < len(matching); i++ {
+		intervals[i-1] = days(matching[i].Date.Sub(matching[i-1].Date))
+	}
+	c, ok := matchCadence(intervals)
+	if !ok || (len(matching) < MinCharges && c.name != model.CadenceYearly) {
+		return model.Subscription{}, false
+	}
+
+	first, last := matching[0], matching[len(matching)-1]
+	s := model.Subscription{
+		Cadence:      c.name,
+		Charges:      len(matching),
+		FirstDate:    first.Date,
+		LastDate:     last.Date,
+		LastAmount:   last.Amount,
+		NextExpected: c.next(last.Date),
+		AnnualCost:   math.Round(last.Amount*c.perYear*100) / 100,
+		Status:       model.SubscriptionActive,
+	}
+	for i := 1; i < len(matching); i++ {
+		if math.Abs(matching[i].Amount-matching[i-1].Amount) >= 0.005 {
+			s.PriceChanges = append(s.PriceChanges, model.PriceChange{
+				Date: matching[i].Date, From: matching[i-1].Amount, To: matching[i].Amount,
+			})
+		}
+	}
+
+	overdue := days(today.Sub(s.NextExpected))
+	switch {
+	case overdue > c.days*(endedCycles-1)+c.tolerance:
+		s.Status = model.SubscriptionEnded
+	case overdue > c.tolerance:
+		s.Status = model.SubscriptionMissed
+	}
+	return s, true
+}
+
+// matchCadence returns the cadence most intervals match, if enough do.
+func matchCadence(intervals []int) (cadence, bool) {
+	for _, c := range cadences {
+		regular := 0
+		for _, d := range intervals {
+			if abs(d-c.days) <= c.tolerance {
+				regular++
+			}
+		}
+		if float64(regular) >= float64(len(intervals))*regularShare {
+			return c, true
+		}
+	}
+	return cadence{}, false
+}
+
+func days(d time.Duration) int {
+	return int(math.Round(d.Hours() / 24))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package subscription
+
+import (
+	"finance-tracker/model"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// charges returns one charge of amount on each date.
+func charges(amount float64, dates ...string) []Charge {
+	result := make([]Charge, len(dates))
+	for i, d := range dates {
+		result[i] = Charge{Date: day(d), Amount: amount}
+	}
+	return result
+}
+
+func TestDetectCadences(t *testing.T) {
+	tests := []struct {
+		name    string
+		charges []Charge
+		today   string
+		cadence string
+		next    string
+		annual  float64
+	}{
+		{"weekly", charges(12, "2025-03-03", "2025-03-10", "2025-03-17", "2025-03-24"), "2025-03-27",
+			model.CadenceWeekly, "2025-03-31", 624},
+		{"every two weeks", charges(20, "2025-03-01", "2025-03-15", "2025-03-29", "2025-04-12"), "2025-04-14",
+			model.CadenceBiweekly, "2025-04-26", 520},
+		{"monthly, a day or two off", charges(9.99, "2025-01-05", "2025-02-06", "2025-03-05", "2025-04-04"), "2025-04-20",
+			model.CadenceMonthly, "2025-05-04", 119.88},
+		{"monthly on the 31st", charges(15, "2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"), "2025-05-02",
+			model.CadenceMonthly, "2025-05-30", 180},
+		{"quarterly", charges(30, "2024-05-31", "2024-08-31", "2024-11-30", "2025-02-28"), "2025-03-10",
+			model.CadenceQuarterly, "2025-05-28", 120},
+		{"yearly needs only two", charges(99, "2024-02-29", "2025-02-28"), "2025-06-01",
+			model.CadenceYearly, "2026-02-28", 99},
+		{"unordered", charges(12, "2025-03-17", "2025-03-03", "2025-03-24", "2025-03-10"), "2025-03-27",
+			model.CadenceWeekly, "2025-03-31", 624},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := Detect(tt.charges, day(tt.today))
+			if !ok {
+				t.Fatal("not detected")
+			}
+			if s.Cadence != tt.cadence || s.Charges != len(tt.charges) || s.Status != model.SubscriptionActive {
+				t.Errorf("got %s with %d charges, %s; want %s with %d, active", s.Cadence, s.Charges, s.Status, tt.cadence, len(tt.charges))
+			}
+			if got := s.NextExpected.Format("2006-01-02"); got != tt.next {
+				t.Errorf("NextExpected = %s, want %s", got, tt.next)
+			}
+			if s.AnnualCost != tt.annual {
+				t.Errorf("AnnualCost = %.2f, want %.2f", s.AnnualCost, tt.annual)
+			}
+		})
+	}
+}
+
+func TestDetectRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		charges []Charge
+	}{
+		{"one charge", charges(10, "2025-01-01")},
+		{"two monthly charges", charges(10, "2025-01-01", "2025-02-01")},
+		{"irregular", charges(10, "2025-01-01", "2025-01-04", "2025-02-20", "2025-03-01", "2025-05-17")},
+		{"amounts all over the place", []Charge{
+			{day("2025-01-01"), 5}, {day("2025-02-01"), 80}, {day("2025-03-01"), 23}, {day("2025-04-01"), 140},
+		}},
+	}
+	for _, tt := range tests {
+		if s, ok := Detect(tt.charges, day("2025-04-02")); ok {
+			t.Errorf("%s: detected %+v", tt.name, s)
+		}
+	}
+}
+
+func TestDetectPriceChange(t *testing.T) {
+	history := charges(9.99, "2025-01-10", "2025-02-10", "2025-03-10")
+	history = append(history, charges(12.99, "2025-04-10", "2025-05-10")...)
+	// A one-off purchase from the same payee is not part of the subscription.
+	history = append(history, Charge{Date: day("2025-03-22"), Amount: 249})
+
+	s, ok := Detect(history, day("2025-05-20"))
+	if !ok {
+		t.Fatal("not detected")
+	}
+	if s.Charges != 5 || s.LastAmount != 12.99 || s.AnnualCost != 155.88 {
+		t.Errorf("got %d charges, last %.2f, annual %.2f; want 5, 12.99, 155.88", s.Charges, s.LastAmount, s.AnnualCost)
+	}
+	if len(s.PriceChanges) != 1 {
+		t.Fatalf("got price changes %+v, want one", s.PriceChanges)
+	}
+	if c := s.PriceChanges[0]; !c.Date.Equal(day("2025-04-10")) || c.From != 9.99 || c.To != 12.99 {
+		t.Errorf("price change = %+v, want 9.99 to 12.99 on 2025-04-10", c)
+	}
+}
+
+func TestDetectStatus(t *testing.T) {
+	// Charged on the last day of the month: the next charge is due Feb 28,
+	// not Mar 3.
+	history := charges(15, "2024-10-31", "2024-11-30", "2024-12-31", "2025-01-31")
+	tests := []struct {
+		today string
+		want  string
+	}{
+		{"2025-02-28", model.SubscriptionActive},
+		{"2025-03-05", model.SubscriptionActive}, // 5 days late, within tolerance
+		{"2025-03-06", model.SubscriptionMissed},
+		{"2025-04-04", model.SubscriptionMissed}, // one cycle plus tolerance
+		{"2025-04-05", model.SubscriptionEnded},
+	}
+	for _, tt := range tests {
+		s, ok := Detect(history, day(tt.today))
+		if !ok {
+			t.Fatalf("%s: not detected", tt.today)
+		}
+		if s.Status != tt.want {
+			t.Errorf("on %s: status %s, want %s (next expected %s)", tt.today, s.Status, tt.want, s.NextExpected.Format("2006-01-02"))
+		}
+	}
+}